@@ -0,0 +1,356 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Các trạng thái của một lần leo thang cảnh báo
+const (
+	EscalationActive    = "active"
+	EscalationStopped   = "stopped"   // Cảnh báo đã được xử lý trước khi hết các bước
+	EscalationCompleted = "completed" // Đã thực hiện hết các bước
+)
+
+// escalationPollInterval là chu kỳ kiểm tra các bước leo thang đến hạn
+const escalationPollInterval = 15 * time.Second
+
+// EscalationPolicy là chính sách leo thang áp dụng cho cảnh báo chưa được xác nhận.
+// Điều kiện để trống nghĩa là không giới hạn; chính sách khớp đầu tiên (theo id) được áp dụng.
+type EscalationPolicy struct {
+	ID          uint             `gorm:"primaryKey" json:"id"`
+	Name        string           `json:"name"`
+	Statuses    pq.StringArray   `gorm:"type:text[]" json:"statuses"`
+	MinSeverity string           `json:"min_severity"`
+	Zones       pq.StringArray   `gorm:"type:text[]" json:"zones"`
+	Disabled    bool             `json:"disabled"`
+	Steps       []EscalationStep `gorm:"foreignKey:PolicyID" json:"steps"`
+	UpdatedAt   time.Time        `json:"updated_at"`
+}
+
+// EscalationStep là một bước leo thang: sau DelayMinutes phút kể từ khi có cảnh báo mà chưa được xác nhận
+// thì thông báo cho người đang trực theo lịch ScheduleID và/hoặc các người nhận RecipientIDs
+type EscalationStep struct {
+	ID           uint           `gorm:"primaryKey" json:"id"`
+	PolicyID     uint           `gorm:"index" json:"policy_id"`
+	DelayMinutes int            `json:"delay_minutes"`
+	ScheduleID   *uint          `json:"schedule_id"`
+	RecipientIDs pq.Int64Array  `gorm:"type:bigint[]" json:"recipient_ids"`
+	Channels     pq.StringArray `gorm:"type:text[]" json:"channels"` // Trống là mọi kênh
+}
+
+// AlertEscalation theo dõi tiến trình leo thang của một cảnh báo. Các bước được chụp lại khi bắt đầu
+// leo thang nên sửa chính sách giữa chừng không làm leo thang đang chạy bỏ qua, lặp lại hay vượt quá bước.
+type AlertEscalation struct {
+	ID        uint             `gorm:"primaryKey" json:"id"`
+	AlertID   uint             `gorm:"uniqueIndex" json:"alert_id"`
+	PolicyID  uint             `json:"policy_id"`
+	Steps     []EscalationStep `gorm:"serializer:json;type:jsonb" json:"steps"` // Các bước đã sắp theo thời gian chờ
+	NextStep  int              `json:"next_step"`                               // Chỉ số bước tiếp theo trong Steps
+	NextRunAt time.Time        `gorm:"index" json:"next_run_at"`
+	Status    string           `gorm:"index" json:"status"`
+	StartedAt time.Time        `json:"started_at"`
+	UpdatedAt time.Time        `json:"updated_at"`
+}
+
+// escalationWake đánh thức worker khi có cảnh báo mới cần leo thang
+var escalationWake = make(chan struct{}, 1)
+
+// validate kiểm tra cấu hình chính sách leo thang
+func (p *EscalationPolicy) validate() error {
+	if p.Name == "" {
+		return errors.New("name is required")
+	}
+	if _, ok := severityRank[p.MinSeverity]; p.MinSeverity != "" && !ok {
+		return errors.New("invalid min_severity")
+	}
+	if len(p.Steps) == 0 {
+		return errors.New("steps must not be empty")
+	}
+	for i, step := range p.Steps {
+		if step.DelayMinutes < 0 {
+			return fmt.Errorf("step %d: delay_minutes must not be negative", i+1)
+		}
+		if step.ScheduleID == nil && len(step.RecipientIDs) == 0 {
+			return fmt.Errorf("step %d: schedule_id or recipient_ids is required", i+1)
+		}
+		for _, ch := range step.Channels {
+			if _, ok := notifierFactories[ch]; !ok {
+				return fmt.Errorf("step %d: unknown channel %q", i+1, ch)
+			}
+		}
+	}
+	return nil
+}
+
+// matches kiểm tra cảnh báo có thuộc phạm vi của chính sách hay không
+func (p *EscalationPolicy) matches(alert Alert) bool {
+	if len(p.Statuses) > 0 && !containsString(p.Statuses, alert.Status) {
+		return false
+	}
+	if p.MinSeverity != "" && severityRank[alert.Severity] < severityRank[p.MinSeverity] {
+		return false
+	}
+	if len(p.Zones) > 0 && !containsString(p.Zones, alert.Zone) {
+		return false
+	}
+	return true
+}
+
+// sortedSteps trả về các bước theo thứ tự thời gian chờ tăng dần
+func (p *EscalationPolicy) sortedSteps() []EscalationStep {
+	steps := append([]EscalationStep(nil), p.Steps...)
+	sort.SliceStable(steps, func(i, j int) bool { return steps[i].DelayMinutes < steps[j].DelayMinutes })
+	return steps
+}
+
+// startEscalation gắn chính sách leo thang khớp đầu tiên cho cảnh báo mới, trong cùng giao dịch tạo cảnh báo
+func startEscalation(tx *gorm.DB, alert Alert) error {
+	var policies []EscalationPolicy
+	if err := tx.Preload("Steps").Where("disabled = ?", false).Order("id").Find(&policies).Error; err != nil {
+		return err
+	}
+	for _, policy := range policies {
+		if !policy.matches(alert) || len(policy.Steps) == 0 {
+			continue
+		}
+		now := time.Now()
+		steps := policy.sortedSteps()
+		return tx.Create(&AlertEscalation{
+			AlertID:   alert.ID,
+			PolicyID:  policy.ID,
+			Steps:     steps,
+			NextRunAt: now.Add(time.Duration(steps[0].DelayMinutes) * time.Minute),
+			Status:    EscalationActive,
+			StartedAt: now,
+		}).Error
+	}
+	return nil
+}
+
+// stopEscalation dừng leo thang khi cảnh báo đã được xác nhận hoặc xử lý
+func stopEscalation(tx *gorm.DB, alertID uint) error {
+	return tx.Model(&AlertEscalation{}).
+		Where("alert_id = ? AND status = ?", alertID, EscalationActive).
+		Update("status", EscalationStopped).Error
+}
+
+// errNoActiveEscalation báo cảnh báo không có leo thang nào đang chạy
+var errNoActiveEscalation = errors.New("alert has no active escalation")
+
+// escalateNow cho bước leo thang tiếp theo của cảnh báo chạy ngay, không chờ hết thời gian
+func escalateNow(alertID uint) error {
+	result := db.Model(&AlertEscalation{}).
+		Where("alert_id = ? AND status = ?", alertID, EscalationActive).
+		Update("next_run_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errNoActiveEscalation
+	}
+	wakeEscalations()
+	return nil
+}
+
+// wakeEscalations báo cho worker có leo thang mới
+func wakeEscalations() {
+	select {
+	case escalationWake <- struct{}{}:
+	default:
+	}
+}
+
+// runEscalations liên tục thực hiện các bước leo thang đến hạn; khi dịch vụ tắt thì thực hiện nốt các bước đến hạn rồi thoát
+func runEscalations() {
+	for !app.DrainExpired() {
+		ok, err := escalateNext()
+		if err != nil {
+			slog.Error("Error processing escalation", "error", err)
+		}
+		if ok {
+			continue
+		}
+		if app.IsStopping() {
+			return
+		}
+		select {
+		case <-escalationWake:
+		case <-time.After(escalationPollInterval):
+		case <-app.Stopping():
+		}
+	}
+}
+
+// escalateNext nhận một leo thang đến hạn (SKIP LOCKED) và thực hiện bước tiếp theo.
+// Thông báo được xếp vào outbox trong cùng giao dịch nên không mất hay gửi trùng khi lỗi.
+func escalateNext() (bool, error) {
+	found := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var esc AlertEscalation
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_run_at <= ?", EscalationActive, time.Now()).
+			Order("next_run_at").
+			Limit(1).
+			Find(&esc)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		found = true
+
+		var alert Alert
+		if err := tx.Omit("face_snapshot").First(&alert, esc.AlertID).Error; err != nil {
+			return tx.Model(&esc).Update("status", EscalationStopped).Error
+		}
+		if alert.State != AlertStateOpen {
+			return tx.Model(&esc).Update("status", EscalationStopped).Error
+		}
+
+		steps := esc.Steps
+		if esc.NextStep >= len(steps) {
+			return tx.Model(&esc).Update("status", EscalationCompleted).Error
+		}
+
+		step := steps[esc.NextStep]
+		targets, err := stepTargets(tx, step)
+		if err != nil {
+			return err
+		}
+		// Silence hoặc bảo trì bắt đầu sau khi có cảnh báo thì bỏ qua bước này nhưng vẫn giữ lịch leo thang
+		suppressedBy, err := findSuppression(tx, alert, time.Now())
+		if err != nil {
+			return err
+		}
+		if suppressedBy != "" {
+			slog.Info("Escalation step suppressed", "alert_id", esc.AlertID, "step", esc.NextStep+1, "suppressed_by", suppressedBy)
+			targets = nil
+		} else if len(targets) == 0 {
+			slog.Warn("Escalation step has no reachable recipient", "alert_id", esc.AlertID, "step", esc.NextStep+1)
+		}
+		if _, err := createDeliveries(tx, esc.AlertID, targets); err != nil {
+			return err
+		}
+		slog.Info("Alert escalated", "alert_id", esc.AlertID, "step", esc.NextStep+1, "deliveries", len(targets))
+
+		updates := map[string]interface{}{"next_step": esc.NextStep + 1}
+		if esc.NextStep+1 < len(steps) {
+			next := steps[esc.NextStep+1]
+			updates["next_run_at"] = esc.StartedAt.Add(time.Duration(next.DelayMinutes) * time.Minute)
+		} else {
+			updates["status"] = EscalationCompleted
+		}
+		return tx.Model(&esc).Updates(updates).Error
+	})
+	if found && err == nil {
+		wakeOutbox()
+	}
+	return found, err
+}
+
+// stepTargets tra địa chỉ nhận của một bước: người đang trực theo lịch và các người nhận chỉ định
+func stepTargets(tx *gorm.DB, step EscalationStep) ([]deliveryTarget, error) {
+	allowed := channelAllowance{}
+	allowed.add(step.RecipientIDs, step.Channels)
+	if step.ScheduleID != nil {
+		var schedule OnCallSchedule
+		if err := tx.First(&schedule, *step.ScheduleID).Error; err == nil && len(schedule.RecipientIDs) > 0 {
+			allowed.add([]int64{int64(schedule.onCall(time.Now()))}, step.Channels)
+		}
+	}
+	if len(allowed) == 0 {
+		return nil, nil
+	}
+	return recipientTargets(tx, allowed)
+}
+
+// getEscalationPoliciesHandler lấy danh sách chính sách leo thang cùng các bước
+func getEscalationPoliciesHandler(c *gin.Context) {
+	var policies []EscalationPolicy
+	if err := db.Preload("Steps").Order("id").Find(&policies).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error fetching escalation policies", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, policies)
+}
+
+// saveEscalationPolicyHandler tạo mới hoặc cập nhật chính sách leo thang, thay toàn bộ các bước.
+// Bước mới chỉ áp dụng cho các leo thang bắt đầu sau đó.
+func saveEscalationPolicyHandler(c *gin.Context) {
+	var policy EscalationPolicy
+	if err := c.ShouldBindJSON(&policy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if id := c.Param("id"); id != "" {
+		if _, err := fmt.Sscan(id, &policy.ID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid policy id"})
+			return
+		}
+	}
+	if err := policy.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Steps").Save(&policy).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("policy_id = ?", policy.ID).Delete(&EscalationStep{}).Error; err != nil {
+			return err
+		}
+		for i := range policy.Steps {
+			policy.Steps[i].ID = 0
+			policy.Steps[i].PolicyID = policy.ID
+		}
+		return tx.Create(&policy.Steps).Error
+	})
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error saving escalation policy", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save escalation policy"})
+		return
+	}
+	c.JSON(http.StatusOK, policy)
+}
+
+// deleteEscalationPolicyHandler xóa chính sách leo thang và dừng các leo thang đang chạy theo chính sách
+func deleteEscalationPolicyHandler(c *gin.Context) {
+	policyID := c.Param("id")
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&AlertEscalation{}).
+			Where("policy_id = ? AND status = ?", policyID, EscalationActive).
+			Update("status", EscalationStopped).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("policy_id = ?", policyID).Delete(&EscalationStep{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&EscalationPolicy{}, policyID).Error
+	})
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error deleting escalation policy", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete escalation policy"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Escalation policy deleted successfully"})
+}
+
+// getAlertEscalationHandler trả về tiến trình leo thang của một cảnh báo
+func getAlertEscalationHandler(c *gin.Context) {
+	var esc AlertEscalation
+	if err := db.Where("alert_id = ?", c.Param("id")).First(&esc).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Alert has no escalation"})
+		return
+	}
+	c.JSON(http.StatusOK, esc)
+}
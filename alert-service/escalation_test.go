@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/lib/pq"
+	"gorm.io/gorm/schema"
+)
+
+func TestAlertEscalationStoresStepSnapshot(t *testing.T) {
+	s, err := schema.Parse(&AlertEscalation{}, &sync.Map{}, schema.NamingStrategy{})
+	if err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+	// Steps là cột jsonb của leo thang, không phải quan hệ tới escalation_steps
+	if len(s.Relationships.Relations) != 0 {
+		t.Fatalf("relations = %v, want none", s.Relationships.Relations)
+	}
+	field := s.LookUpField("steps")
+	if field == nil || field.DataType != "jsonb" {
+		t.Fatalf("steps field = %+v, want jsonb column", field)
+	}
+}
+
+func TestEscalationStepSnapshotKeys(t *testing.T) {
+	// Migration 0005 dựng snapshot bằng jsonb_build_object với các khóa này
+	scheduleID := uint(3)
+	data, err := json.Marshal(EscalationStep{ID: 1, PolicyID: 2, DelayMinutes: 5, ScheduleID: &scheduleID,
+		RecipientIDs: pq.Int64Array{7}, Channels: pq.StringArray{"sms"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys map[string]interface{}
+	json.Unmarshal(data, &keys)
+	for _, key := range []string{"id", "policy_id", "delay_minutes", "schedule_id", "recipient_ids", "channels"} {
+		if _, ok := keys[key]; !ok {
+			t.Errorf("step JSON has no %q key: %s", key, data)
+		}
+	}
+	if len(keys) != 6 {
+		t.Errorf("step JSON has %d keys, want 6: %s", len(keys), data)
+	}
+}
+
+func TestSortedSteps(t *testing.T) {
+	policy := EscalationPolicy{Steps: []EscalationStep{
+		{ID: 1, DelayMinutes: 30},
+		{ID: 2, DelayMinutes: 0},
+		{ID: 3, DelayMinutes: 30},
+		{ID: 4, DelayMinutes: 10},
+	}}
+	var got []uint
+	for _, step := range policy.sortedSteps() {
+		got = append(got, step.ID)
+	}
+	want := []uint{2, 4, 1, 3}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("sortedSteps() = %v, want %v", got, want)
+		}
+	}
+	if policy.Steps[0].ID != 1 {
+		t.Error("sortedSteps modified the policy")
+	}
+}
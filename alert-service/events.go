@@ -0,0 +1,29 @@
+package main
+
+import (
+	"encoding/json"
+
+	"gorm.io/gorm"
+
+	"isafe/shared/domain"
+)
+
+// Các loại sự kiện cảnh báo phát cho identity-verification
+const (
+	EventAlertCreated = domain.EventAlertCreated
+	EventAlertUpdated = domain.EventAlertUpdated
+)
+
+// publishAlertEvent ghi sự kiện cảnh báo vào alert_events và phát qua Postgres NOTIFY trong giao dịch tx.
+// NOTIFY chỉ được gửi khi tx commit, nên dashboard và webhook không thấy thay đổi đã bị hoàn tác.
+// Ảnh chụp không được gửi kèm vì NOTIFY giới hạn payload 8000 byte.
+func publishAlertEvent(tx *gorm.DB, eventType string, alert Alert) error {
+	payload, err := json.Marshal(domain.AlertEvent{Type: eventType, Alert: alert.Summary()})
+	if err != nil {
+		return err
+	}
+	if err := tx.Create(&domain.AlertEventRecord{Type: eventType, Payload: string(payload)}).Error; err != nil {
+		return err
+	}
+	return tx.Exec("SELECT pg_notify(?, ?)", domain.AlertEventsChannel, string(payload)).Error
+}
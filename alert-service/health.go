@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// healthCheckTimeout giới hạn thời gian mỗi phép kiểm tra của /readyz
+const healthCheckTimeout = 2 * time.Second
+
+// healthzHandler cho biết tiến trình còn chạy (liveness), không kiểm tra phụ thuộc
+func healthzHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// readyzHandler cho biết dịch vụ có nhận cảnh báo được không: cơ sở dữ liệu phản hồi, có kênh thông báo,
+// secret ký /send_alert đã cấu hình và dịch vụ chưa bắt đầu tắt
+func readyzHandler(c *gin.Context) {
+	checks := gin.H{
+		"database":       checkResult(checkDatabase(c.Request.Context())),
+		"notifiers":      checkResult(checkNotifiers()),
+		"ingress_secret": checkResult(checkIngressSecret()),
+	}
+	ready := true
+	for _, result := range checks {
+		if result != "ok" {
+			ready = false
+		}
+	}
+	if app.IsShuttingDown() {
+		checks["shutdown"] = "in progress"
+		ready = false
+	}
+
+	body := gin.H{"status": "ok", "checks": checks, "notifiers": enabledNotifiers()}
+	if !ready {
+		body["status"] = "unavailable"
+		c.JSON(http.StatusServiceUnavailable, body)
+		return
+	}
+	c.JSON(http.StatusOK, body)
+}
+
+// checkResult chuyển kết quả kiểm tra thành chuỗi hiển thị
+func checkResult(err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return "ok"
+}
+
+// checkDatabase ping cơ sở dữ liệu
+func checkDatabase(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// checkNotifiers kiểm tra có ít nhất một kênh thông báo được bật.
+// Cấu hình sai của từng notifier đã làm dịch vụ dừng ngay khi khởi động (xem loadNotifiers).
+func checkNotifiers() error {
+	if len(channels) == 0 {
+		return errors.New("no notifier enabled")
+	}
+	return nil
+}
+
+// checkIngressSecret kiểm tra secret ký /send_alert đã được cấu hình
+func checkIngressSecret() error {
+	if len(alertIngressSecrets) == 0 {
+		return errors.New("ALERT_INGRESS_SECRET is not configured")
+	}
+	return nil
+}
+
+// enabledNotifiers liệt kê tên các notifier đang bật
+func enabledNotifiers() []string {
+	names := make([]string, 0, len(channels))
+	for _, ch := range channels {
+		names = append(names, ch.notifier.Name())
+	}
+	return names
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"isafe/shared/alertapi"
+	"isafe/shared/signing"
+)
+
+var (
+	// alertIngressSecrets là các secret được chấp nhận (phân tách bằng dấu phẩy để xoay vòng secret)
+	alertIngressSecrets = splitList(os.Getenv("ALERT_INGRESS_SECRET"))
+	// alertSignatureTolerance là độ lệch tối đa giữa timestamp của chữ ký và giờ máy chủ
+	alertSignatureTolerance = envDuration("ALERT_SIGNATURE_TOLERANCE", 5*time.Minute)
+	// alertMaxBodyBytes giới hạn kích thước body của /send_alert
+	alertMaxBodyBytes = int64(envInt("ALERT_MAX_BODY_BYTES", 8<<20))
+	// alertMaxSnapshotBytes giới hạn kích thước ảnh chụp sau khi giải mã base64
+	alertMaxSnapshotBytes = envInt("ALERT_MAX_SNAPSHOT_BYTES", 5<<20)
+)
+
+// alertStatusPattern là dạng hợp lệ của loại cảnh báo, ví dụ unrecognized, visitor_zone_violation
+var alertStatusPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+// alertMaxClockSkew là độ lệch tối đa cho phép khi timestamp của cảnh báo ở tương lai
+const alertMaxClockSkew = 5 * time.Minute
+
+// ingressError là lỗi từ chối payload kèm mã lỗi và trường bị lỗi (nếu có)
+type ingressError struct {
+	Status  int
+	Code    string
+	Field   string
+	Message string
+}
+
+func (e *ingressError) Error() string { return e.Message }
+
+// respond ghi lỗi theo định dạng chung {"error", "code", "field"}
+func (e *ingressError) respond(c *gin.Context) {
+	alertsRejected.WithLabelValues(e.Code).Inc()
+	c.AbortWithStatusJSON(e.Status, alertapi.ErrorResponse{Error: e.Message, Code: e.Code, Field: e.Field})
+}
+
+func fieldError(code, field, message string) *ingressError {
+	return &ingressError{Status: http.StatusBadRequest, Code: code, Field: field, Message: message}
+}
+
+// verifyAlertSignature là middleware xác thực bên gửi bằng HMAC trên toàn bộ body.
+// Body được đọc với giới hạn kích thước rồi đặt lại để handler đọc tiếp.
+func verifyAlertSignature(c *gin.Context) {
+	if len(alertIngressSecrets) == 0 {
+		(&ingressError{Status: http.StatusServiceUnavailable, Code: alertapi.ErrCodeIngressDisabled,
+			Message: "ALERT_INGRESS_SECRET is not configured"}).respond(c)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, alertMaxBodyBytes))
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			(&ingressError{Status: http.StatusRequestEntityTooLarge, Code: alertapi.ErrCodePayloadTooLarge,
+				Message: fmt.Sprintf("Request body exceeds %d bytes", alertMaxBodyBytes)}).respond(c)
+			return
+		}
+		(&ingressError{Status: http.StatusBadRequest, Code: alertapi.ErrCodeInvalidJSON, Message: "Failed to read request body"}).respond(c)
+		return
+	}
+
+	if err := checkSignature(c.GetHeader(alertapi.SignatureHeader), body, time.Now()); err != nil {
+		slog.WarnContext(c.Request.Context(), "Rejected /send_alert signature", "client_ip", c.ClientIP(), "error", err)
+		err.respond(c)
+		return
+	}
+
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	c.Next()
+}
+
+// checkSignature kiểm tra header chữ ký với mọi secret đang được chấp nhận
+func checkSignature(header string, body []byte, now time.Time) *ingressError {
+	err := signing.Verify(header, body, alertIngressSecrets, alertSignatureTolerance, now)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, signing.ErrMissing):
+		return &ingressError{Status: http.StatusUnauthorized, Code: alertapi.ErrCodeMissingSignature,
+			Message: "Missing " + alertapi.SignatureHeader + " header"}
+	case errors.Is(err, signing.ErrExpired):
+		return &ingressError{Status: http.StatusUnauthorized, Code: alertapi.ErrCodeSignatureExpired,
+			Message: "Signature timestamp is outside the allowed window"}
+	case errors.Is(err, signing.ErrMalformed):
+		return &ingressError{Status: http.StatusUnauthorized, Code: alertapi.ErrCodeInvalidSignature, Message: "Malformed signature header"}
+	}
+	return &ingressError{Status: http.StatusUnauthorized, Code: alertapi.ErrCodeInvalidSignature, Message: "Signature does not match"}
+}
+
+// alertRequest là payload /send_alert đã kiểm tra, kèm timestamp đã phân tích
+type alertRequest struct {
+	alertapi.SendAlertRequest
+	parsedTime time.Time
+}
+
+// parseAlertRequest giải mã và kiểm tra payload /send_alert
+func parseAlertRequest(c *gin.Context) (alertRequest, *ingressError) {
+	var req alertRequest
+	decoder := json.NewDecoder(c.Request.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req.SendAlertRequest); err != nil {
+		return req, fieldError(alertapi.ErrCodeInvalidJSON, "", "Invalid JSON: "+err.Error())
+	}
+	return req, req.validate(time.Now())
+}
+
+// validate kiểm tra từng trường của payload và suy ra giá trị mặc định
+func (r *alertRequest) validate(now time.Time) *ingressError {
+	if r.SchemaVersion != alertapi.SchemaVersion {
+		return fieldError(alertapi.ErrCodeUnsupportedVersion, "schema_version",
+			fmt.Sprintf("Unsupported schema_version %d, expected %d", r.SchemaVersion, alertapi.SchemaVersion))
+	}
+
+	required := map[string]string{
+		"event_id":      r.EventID,
+		"alert_message": r.AlertMessage,
+		"face_snapshot": r.FaceSnapshot,
+		"timestamp":     r.Timestamp,
+		"status":        r.Status,
+	}
+	for _, field := range []string{"event_id", "alert_message", "face_snapshot", "timestamp", "status"} {
+		if required[field] == "" {
+			return fieldError(alertapi.ErrCodeMissingField, field, field+" is required")
+		}
+	}
+	if r.Similarity == nil {
+		return fieldError(alertapi.ErrCodeMissingField, "similarity", "similarity is required")
+	}
+
+	limits := []struct {
+		field string
+		value string
+		max   int
+	}{
+		{"event_id", r.EventID, 64},
+		{"alert_message", r.AlertMessage, 1000},
+		{"device_id", r.DeviceID, 128},
+		{"zone", r.Zone, 128},
+	}
+	for _, l := range limits {
+		if len(l.value) > l.max {
+			return fieldError(alertapi.ErrCodeInvalidField, l.field, fmt.Sprintf("%s must be at most %d bytes", l.field, l.max))
+		}
+	}
+
+	if math.IsNaN(*r.Similarity) || *r.Similarity < -1 || *r.Similarity > 1 {
+		return fieldError(alertapi.ErrCodeInvalidField, "similarity", "similarity must be between -1 and 1")
+	}
+	if !alertStatusPattern.MatchString(r.Status) {
+		return fieldError(alertapi.ErrCodeInvalidField, "status", "status must be a lowercase identifier")
+	}
+	if r.Severity == "" {
+		r.Severity = defaultSeverity(r.Status)
+	} else if _, ok := severityRank[r.Severity]; !ok {
+		return fieldError(alertapi.ErrCodeInvalidField, "severity", "Invalid severity")
+	}
+
+	parsedTime, err := time.Parse(time.RFC3339, r.Timestamp)
+	if err != nil {
+		return fieldError(alertapi.ErrCodeInvalidField, "timestamp", "timestamp must be RFC 3339")
+	}
+	if parsedTime.After(now.Add(alertMaxClockSkew)) {
+		return fieldError(alertapi.ErrCodeInvalidField, "timestamp", "timestamp is in the future")
+	}
+	r.parsedTime = parsedTime
+
+	return r.validateSnapshot()
+}
+
+// validateSnapshot kiểm tra ảnh chụp là base64 hợp lệ của ảnh JPEG hoặc PNG trong giới hạn kích thước
+func (r *alertRequest) validateSnapshot() *ingressError {
+	encoded := stripDataURL(r.FaceSnapshot)
+	if base64.StdEncoding.DecodedLen(len(encoded)) > alertMaxSnapshotBytes+2 {
+		return &ingressError{Status: http.StatusRequestEntityTooLarge, Code: alertapi.ErrCodeSnapshotTooLarge, Field: "face_snapshot",
+			Message: fmt.Sprintf("face_snapshot exceeds %d bytes", alertMaxSnapshotBytes)}
+	}
+	image, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return fieldError(alertapi.ErrCodeInvalidSnapshot, "face_snapshot", "face_snapshot is not valid base64")
+	}
+	if len(image) > alertMaxSnapshotBytes {
+		return &ingressError{Status: http.StatusRequestEntityTooLarge, Code: alertapi.ErrCodeSnapshotTooLarge, Field: "face_snapshot",
+			Message: fmt.Sprintf("face_snapshot exceeds %d bytes", alertMaxSnapshotBytes)}
+	}
+	switch http.DetectContentType(image) {
+	case "image/jpeg", "image/png":
+		return nil
+	}
+	return fieldError(alertapi.ErrCodeInvalidSnapshot, "face_snapshot", "face_snapshot must be a JPEG or PNG image")
+}
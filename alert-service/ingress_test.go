@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"isafe/shared/alertapi"
+	"isafe/shared/signing"
+)
+
+var (
+	jpegSnapshot = base64.StdEncoding.EncodeToString([]byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00"))
+	pngSnapshot  = base64.StdEncoding.EncodeToString([]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR"))
+)
+
+// stubIngress đặt secret và giới hạn của /send_alert trong thời gian chạy test
+func stubIngress(t *testing.T, secrets []string, maxBody int64, maxSnapshot int) {
+	t.Helper()
+	prevSecrets, prevBody, prevSnapshot := alertIngressSecrets, alertMaxBodyBytes, alertMaxSnapshotBytes
+	alertIngressSecrets, alertMaxBodyBytes, alertMaxSnapshotBytes = secrets, maxBody, maxSnapshot
+	t.Cleanup(func() {
+		alertIngressSecrets, alertMaxBodyBytes, alertMaxSnapshotBytes = prevSecrets, prevBody, prevSnapshot
+	})
+}
+
+// ingressRouter dựng /send_alert với middleware chữ ký thật; handler chỉ kiểm tra payload, không ghi database
+func ingressRouter() *gin.Engine {
+	router := gin.New()
+	router.POST(alertapi.SendAlertPath, verifyAlertSignature, func(c *gin.Context) {
+		req, err := parseAlertRequest(c)
+		if err != nil {
+			err.respond(c)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"severity": req.Severity, "timestamp": req.parsedTime})
+	})
+	return router
+}
+
+// validAlert trả về payload hợp lệ dạng map để từng test sửa một trường
+func validAlert() map[string]interface{} {
+	return map[string]interface{}{
+		"schema_version": alertapi.SchemaVersion,
+		"event_id":       "0123456789abcdef",
+		"similarity":     0.42,
+		"alert_message":  "Unrecognized face detected",
+		"face_snapshot":  jpegSnapshot,
+		"timestamp":      time.Now().Format(time.RFC3339),
+		"status":         "unrecognized",
+		"device_id":      "cam-gate-01",
+		"zone":           "main-gate",
+	}
+}
+
+func postAlert(t *testing.T, router *gin.Engine, body []byte, signature string) (int, alertapi.ErrorResponse) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, alertapi.SendAlertPath, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if signature != "" {
+		req.Header.Set(alertapi.SignatureHeader, signature)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var resp alertapi.ErrorResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return w.Code, resp
+}
+
+func TestSendAlertSignature(t *testing.T) {
+	stubIngress(t, []string{"current", "previous"}, 1<<20, 1<<20)
+	router := ingressRouter()
+	body, _ := json.Marshal(validAlert())
+	now := time.Now()
+
+	tests := []struct {
+		name      string
+		body      []byte
+		signature string
+		status    int
+		code      string
+	}{
+		{"valid", body, signing.Sign("current", now, body), http.StatusOK, ""},
+		{"rotated secret", body, signing.Sign("previous", now, body), http.StatusOK, ""},
+		{"missing signature", body, "", http.StatusUnauthorized, alertapi.ErrCodeMissingSignature},
+		{"malformed signature", body, "v1=abc", http.StatusUnauthorized, alertapi.ErrCodeInvalidSignature},
+		{"wrong secret", body, signing.Sign("attacker", now, body), http.StatusUnauthorized, alertapi.ErrCodeInvalidSignature},
+		{"tampered body", bytes.Replace(body, []byte("0.42"), []byte("0.99"), 1), signing.Sign("current", now, body),
+			http.StatusUnauthorized, alertapi.ErrCodeInvalidSignature},
+		{"expired", body, signing.Sign("current", now.Add(-alertSignatureTolerance-time.Minute), body),
+			http.StatusUnauthorized, alertapi.ErrCodeSignatureExpired},
+		{"from the future", body, signing.Sign("current", now.Add(alertSignatureTolerance+time.Minute), body),
+			http.StatusUnauthorized, alertapi.ErrCodeSignatureExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, resp := postAlert(t, router, tt.body, tt.signature)
+			if status != tt.status || resp.Code != tt.code {
+				t.Errorf("got %d %q, want %d %q (%s)", status, resp.Code, tt.status, tt.code, resp.Error)
+			}
+		})
+	}
+}
+
+func TestSendAlertBodyLimit(t *testing.T) {
+	stubIngress(t, []string{"current"}, 512, 1<<20)
+	body, _ := json.Marshal(map[string]interface{}{"alert_message": strings.Repeat("x", 1024)})
+
+	// Body quá lớn bị từ chối trước khi kiểm tra chữ ký
+	status, resp := postAlert(t, ingressRouter(), body, signing.Sign("current", time.Now(), body))
+	if status != http.StatusRequestEntityTooLarge || resp.Code != alertapi.ErrCodePayloadTooLarge {
+		t.Fatalf("got %d %q, want 413 %q", status, resp.Code, alertapi.ErrCodePayloadTooLarge)
+	}
+}
+
+func TestSendAlertIngressDisabled(t *testing.T) {
+	stubIngress(t, nil, 1<<20, 1<<20)
+	body, _ := json.Marshal(validAlert())
+
+	status, resp := postAlert(t, ingressRouter(), body, signing.Sign("", time.Now(), body))
+	if status != http.StatusServiceUnavailable || resp.Code != alertapi.ErrCodeIngressDisabled {
+		t.Fatalf("got %d %q, want 503 %q", status, resp.Code, alertapi.ErrCodeIngressDisabled)
+	}
+}
+
+func TestSendAlertValidation(t *testing.T) {
+	stubIngress(t, []string{"current"}, 1<<20, 64)
+	router := ingressRouter()
+
+	tests := []struct {
+		name   string
+		modify func(a map[string]interface{})
+		status int
+		code   string
+		field  string
+	}{
+		{"valid", func(a map[string]interface{}) {}, http.StatusOK, "", ""},
+		{"png data URL", func(a map[string]interface{}) { a["face_snapshot"] = "data:image/png;base64," + pngSnapshot },
+			http.StatusOK, "", ""},
+		{"unknown field", func(a map[string]interface{}) { a["trusted"] = true },
+			http.StatusBadRequest, alertapi.ErrCodeInvalidJSON, ""},
+		{"unsupported schema version", func(a map[string]interface{}) { a["schema_version"] = 2 },
+			http.StatusBadRequest, alertapi.ErrCodeUnsupportedVersion, "schema_version"},
+		{"missing schema version", func(a map[string]interface{}) { delete(a, "schema_version") },
+			http.StatusBadRequest, alertapi.ErrCodeUnsupportedVersion, "schema_version"},
+		{"missing event_id", func(a map[string]interface{}) { delete(a, "event_id") },
+			http.StatusBadRequest, alertapi.ErrCodeMissingField, "event_id"},
+		{"missing similarity", func(a map[string]interface{}) { delete(a, "similarity") },
+			http.StatusBadRequest, alertapi.ErrCodeMissingField, "similarity"},
+		{"zero similarity is present", func(a map[string]interface{}) { a["similarity"] = 0 }, http.StatusOK, "", ""},
+		{"similarity out of range", func(a map[string]interface{}) { a["similarity"] = 1.5 },
+			http.StatusBadRequest, alertapi.ErrCodeInvalidField, "similarity"},
+		{"event_id too long", func(a map[string]interface{}) { a["event_id"] = strings.Repeat("a", 65) },
+			http.StatusBadRequest, alertapi.ErrCodeInvalidField, "event_id"},
+		{"invalid status", func(a map[string]interface{}) { a["status"] = "Unrecognized Face" },
+			http.StatusBadRequest, alertapi.ErrCodeInvalidField, "status"},
+		{"invalid severity", func(a map[string]interface{}) { a["severity"] = "urgent" },
+			http.StatusBadRequest, alertapi.ErrCodeInvalidField, "severity"},
+		{"timestamp not RFC 3339", func(a map[string]interface{}) { a["timestamp"] = "2026-10-19 08:00:00" },
+			http.StatusBadRequest, alertapi.ErrCodeInvalidField, "timestamp"},
+		{"timestamp in the future", func(a map[string]interface{}) {
+			a["timestamp"] = time.Now().Add(alertMaxClockSkew + time.Minute).Format(time.RFC3339)
+		}, http.StatusBadRequest, alertapi.ErrCodeInvalidField, "timestamp"},
+		{"snapshot too large", func(a map[string]interface{}) {
+			a["face_snapshot"] = base64.StdEncoding.EncodeToString(append([]byte("\xff\xd8\xff"), make([]byte, 64)...))
+		}, http.StatusRequestEntityTooLarge, alertapi.ErrCodeSnapshotTooLarge, "face_snapshot"},
+		{"snapshot not base64", func(a map[string]interface{}) { a["face_snapshot"] = "not base64!" },
+			http.StatusBadRequest, alertapi.ErrCodeInvalidSnapshot, "face_snapshot"},
+		{"snapshot not an image", func(a map[string]interface{}) {
+			a["face_snapshot"] = base64.StdEncoding.EncodeToString([]byte("<html></html>"))
+		}, http.StatusBadRequest, alertapi.ErrCodeInvalidSnapshot, "face_snapshot"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alert := validAlert()
+			tt.modify(alert)
+			body, _ := json.Marshal(alert)
+			status, resp := postAlert(t, router, body, signing.Sign("current", time.Now(), body))
+			if status != tt.status || resp.Code != tt.code || resp.Field != tt.field {
+				t.Errorf("got %d %q field %q, want %d %q field %q (%s)",
+					status, resp.Code, resp.Field, tt.status, tt.code, tt.field, resp.Error)
+			}
+		})
+	}
+}
+
+func TestAlertRequestDefaultSeverity(t *testing.T) {
+	similarity := 0.5
+	tests := []struct {
+		status   string
+		severity string
+		want     string
+	}{
+		{"unrecognized", "", SeverityHigh},
+		{"visitor_zone_violation", "", SeverityHigh},
+		{"tailgating", "", SeverityMedium},
+		{"unrecognized", SeverityLow, SeverityLow},
+	}
+	for _, tt := range tests {
+		r := alertRequest{SendAlertRequest: alertapi.SendAlertRequest{
+			SchemaVersion: alertapi.SchemaVersion, EventID: "e1", Similarity: &similarity, AlertMessage: "m",
+			FaceSnapshot: jpegSnapshot, Timestamp: time.Now().Format(time.RFC3339), Status: tt.status, Severity: tt.severity,
+		}}
+		if err := r.validate(time.Now()); err != nil {
+			t.Fatalf("%s: validate() = %v", tt.status, err)
+		}
+		if r.Severity != tt.want {
+			t.Errorf("%s/%q: severity = %q, want %q", tt.status, tt.severity, r.Severity, tt.want)
+		}
+	}
+}
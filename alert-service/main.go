@@ -4,37 +4,52 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/ses"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
-	"github.com/sfreiberg/gotwilio"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	gormtracing "gorm.io/plugin/opentelemetry/tracing"
+
+	"isafe/shared/domain"
+	"isafe/shared/lifecycle"
+	"isafe/shared/logging"
+	"isafe/shared/tracing"
 )
 
-type Alert struct {
-	ID           uint      `gorm:"primaryKey" json:"id"`
-	Similarity   float64   `json:"similarity"`
-	AlertMessage string    `json:"alert_message"`
-	FaceSnapshot string    `json:"face_snapshot"` // Base64 string
-	Timestamp    time.Time `json:"timestamp"`
-	Status       string    `json:"status"`
-}
+// Alert là cảnh báo dùng chung với identity-verification; alert-service là nơi duy nhất quản lý schema bảng alerts
+type Alert = domain.Alert
+
+// Các trạng thái xử lý của cảnh báo
+const (
+	AlertStateOpen          = domain.AlertStateOpen
+	AlertStateAcknowledged  = domain.AlertStateAcknowledged
+	AlertStateResolved      = domain.AlertStateResolved
+	AlertStateFalsePositive = domain.AlertStateFalsePositive
+)
 
 var db *gorm.DB
-var twilioClient *gotwilio.Twilio
-var sesClient *ses.Client
-var emailSender string
-var emailRecipient string
+
+// serviceName là tên dịch vụ trong trace và metrics
+const serviceName = "alert-service"
+
+// tracer tạo span cho xử lý cảnh báo và gửi thông báo
+var tracer = tracing.Tracer(serviceName)
+
+// app theo dõi worker nền và điều phối tắt dịch vụ; SHUTDOWN_TIMEOUT là thời gian drain tối đa
+var app = lifecycle.New(envDuration("SHUTDOWN_TIMEOUT", 30*time.Second))
 
 func main() {
+	// Log JSON có request_id, mức log theo LOG_LEVEL
+	logging.Setup(serviceName)
 
 	os.Setenv("DB_HOST", "localhost")
 	os.Setenv("DB_PORT", "5433")
@@ -52,137 +67,253 @@ func main() {
 	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable TimeZone=Asia/Ho_Chi_Minh",
 		host, user, password, dbname, port)
 
-	fmt.Println("dsn", dsn)
-	//database, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
-	var err error
-	db, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	slog.Info("Connecting to database", "host", host, "port", port, "user", user, "database", dbname)
+	// Tracing OpenTelemetry, exporter cấu hình qua OTEL_TRACES_EXPORTER và OTEL_EXPORTER_OTLP_ENDPOINT
+	shutdownTracing, err := tracing.Init(context.Background(), serviceName)
 	if err != nil {
-		panic("Failed to connect to database!")
+		logging.Fatal("Failed to configure tracing", "error", err)
 	}
 
-	// Tự động migrate schema
-	db.AutoMigrate(&Alert{})
+	//database, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	db, err = gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: dbLogger()})
+	if err != nil {
+		logging.Fatal("Failed to connect to database", "error", err)
+	}
+	// Mỗi truy vấn có span riêng; không ghi giá trị tham số vì chứa ảnh chụp
+	if err := db.Use(gormtracing.NewPlugin(gormtracing.WithoutMetrics(), gormtracing.WithoutQueryVariables())); err != nil {
+		logging.Fatal("Failed to enable database tracing", "error", err)
+	}
 
-	// Cấu hình Twilio
-	twilioClient = gotwilio.NewTwilioClient("TWILIO_ACCOUNT_SID", "TWILIO_AUTH_TOKEN")
+	// Cập nhật schema bằng migration SQL có phiên bản (xem migrations/)
+	if runMigrations() {
+		return
+	}
 
-	// Cấu hình AWS SES
-	awsCfg, err := config.LoadDefaultConfig(context.TODO(),
-		config.WithRegion("AWS_REGION"),
-	)
-	if err != nil {
-		panic("Failed to load AWS configuration")
+	// Bật các kênh thông báo theo cấu hình NOTIFIERS
+	if err := loadNotifiers(); err != nil {
+		logging.Fatal("Failed to configure notifiers", "error", err)
 	}
-	sesClient = ses.NewFromConfig(awsCfg)
 
-	emailSender = "EMAIL_SENDER"       // Lấy từ biến môi trường
-	emailRecipient = "EMAIL_RECIPIENT" // Lấy từ biến môi trường
+	// Worker gửi thông báo từ outbox, số lượng cấu hình qua OUTBOX_WORKERS
+	startOutboxWorkers(envInt("OUTBOX_WORKERS", 4))
+
+	// Leo thang các cảnh báo chưa được xác nhận theo chính sách
+	app.Go(runEscalations)
+
+	// Gửi thông báo tổng hợp cho các thông báo bị giới hạn tần suất
+	app.Go(runRollups)
 
-	router := gin.Default()
+	router := gin.New()
+	router.Use(gin.Recovery())
 
 	configCors := cors.Config{
 		AllowOrigins:     []string{"http://202.92.6.77:3000", "http://localhost:3000", "https://insight.io.vn"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", logging.RequestIDHeader},
+		ExposeHeaders:    []string{"Content-Length", logging.RequestIDHeader},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}
 
 	router.Use(cors.New(configCors))
+	// Span của request nối tiếp trace từ header traceparent do identity-verification gửi
+	router.Use(otelgin.Middleware(serviceName, otelgin.WithFilter(func(r *http.Request) bool {
+		return !isProbePath(r.URL.Path)
+	})))
+	router.Use(metricsMiddleware)
+	router.Use(requestLogMiddleware)
 
-	router.POST("/send_alert", sendAlertHandler)
+	router.GET("/healthz", healthzHandler)
+	router.GET("/readyz", readyzHandler)
+	router.GET("/metrics", metricsHandler)
+	router.POST("/send_alert", verifyAlertSignature, sendAlertHandler)
+	router.PUT("/alerts/:id/state", updateAlertStateHandler)
+	router.GET("/alerts/:id/deliveries", getAlertDeliveriesHandler)
+	router.GET("/dead_letters", getDeadLettersHandler)
+	router.POST("/dead_letters/:id/retry", retryDeadLetterHandler)
+	router.GET("/recipients", getRecipientsHandler)
+	router.POST("/recipients", saveRecipientHandler)
+	router.PUT("/recipients/:id", saveRecipientHandler)
+	router.DELETE("/recipients/:id", deleteRecipientHandler)
+	router.GET("/routing_rules", getRoutingRulesHandler)
+	router.POST("/routing_rules", saveRoutingRuleHandler)
+	router.PUT("/routing_rules/:id", saveRoutingRuleHandler)
+	router.DELETE("/routing_rules/:id", deleteRoutingRuleHandler)
+	router.GET("/oncall_schedules", getOnCallSchedulesHandler)
+	router.POST("/oncall_schedules", saveOnCallScheduleHandler)
+	router.PUT("/oncall_schedules/:id", saveOnCallScheduleHandler)
+	router.DELETE("/oncall_schedules/:id", deleteOnCallScheduleHandler)
+	router.GET("/oncall_schedules/:id/current", getCurrentOnCallHandler)
+	router.GET("/escalation_policies", getEscalationPoliciesHandler)
+	router.POST("/escalation_policies", saveEscalationPolicyHandler)
+	router.PUT("/escalation_policies/:id", saveEscalationPolicyHandler)
+	router.DELETE("/escalation_policies/:id", deleteEscalationPolicyHandler)
+	router.GET("/alerts/:id/escalation", getAlertEscalationHandler)
+	router.GET("/silences", getSilencesHandler)
+	router.POST("/silences", saveSilenceHandler)
+	router.PUT("/silences/:id", saveSilenceHandler)
+	router.DELETE("/silences/:id", expireSilenceHandler)
+	router.GET("/maintenance_windows", getMaintenanceWindowsHandler)
+	router.POST("/maintenance_windows", saveMaintenanceWindowHandler)
+	router.PUT("/maintenance_windows/:id", saveMaintenanceWindowHandler)
+	router.DELETE("/maintenance_windows/:id", deleteMaintenanceWindowHandler)
+	router.GET("/notification_templates", getNotificationTemplatesHandler)
+	router.POST("/notification_templates", saveNotificationTemplateHandler)
+	router.PUT("/notification_templates/:id", saveNotificationTemplateHandler)
+	router.DELETE("/notification_templates/:id", deleteNotificationTemplateHandler)
+	router.POST("/notification_templates/preview", previewNotificationTemplateHandler)
+	router.POST("/telegram/webhook", telegramWebhookHandler)
 
-	router.Run(":8081")
+	// Chạy server trên cổng 8081 cho tới khi nhận SIGTERM, sau đó chờ request và outbox xử lý xong
+	srv := &http.Server{Addr: ":8081", Handler: router, ReadHeaderTimeout: 10 * time.Second}
+	if err := app.Run(srv, shutdownTracing, closeDatabase); err != nil {
+		logging.Fatal("Failed to run server", "error", err)
+	}
+}
+
+// closeDatabase đóng các kết nối cơ sở dữ liệu khi tắt dịch vụ
+func closeDatabase(context.Context) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
 }
 func sendAlertHandler(c *gin.Context) {
-	var req struct {
-		Similarity   float64 `json:"similarity"`
-		AlertMessage string  `json:"alert_message"`
-		FaceSnapshot string  `json:"face_snapshot"` // Base64 string
-		Timestamp    string  `json:"timestamp"`     // ISO format string
-		Status       string  `json:"status"`        // e.g., "unrecognized"
+	req, rejectErr := parseAlertRequest(c)
+	if rejectErr != nil {
+		slog.WarnContext(c.Request.Context(), "Rejected alert payload", "code", rejectErr.Code, "field", rejectErr.Field, "reason", rejectErr.Message)
+		rejectErr.respond(c)
+		return
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		log.Printf("Error binding JSON: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+	alert := Alert{
+		EventID:      &req.EventID,
+		Similarity:   *req.Similarity,
+		AlertMessage: req.AlertMessage,
+		FaceSnapshot: req.FaceSnapshot,
+		Timestamp:    req.parsedTime,
+		Status:       req.Status,
+		DeviceID:     req.DeviceID,
+		Zone:         req.Zone,
+		Severity:     req.Severity,
+		State:        AlertStateOpen,
 	}
 
-	// Validate required fields
-	if req.AlertMessage == "" || req.FaceSnapshot == "" || req.Timestamp == "" || req.Status == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing required fields"})
+	// Lưu cảnh báo và xếp hàng các lần gửi thông báo trong cùng một giao dịch
+	// Cảnh báo đã tồn tại với cùng event_id (bên gửi thử lại) thì trả về bản cũ, không gửi thông báo lần nữa
+	var deliveries []NotificationDelivery
+	duplicate := false
+	err := db.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		// Cảnh báo bị silence hoặc thiết bị đang bảo trì vẫn được lưu nhưng không gửi thông báo
+		suppressedBy, err := findSuppression(tx, alert, time.Now())
+		if err != nil {
+			return err
+		}
+		alert.SuppressedBy = suppressedBy
+
+		result := tx.Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "event_id"}}, DoNothing: true}).Create(&alert)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			duplicate = true
+			if err := tx.Where("event_id = ?", req.EventID).First(&alert).Error; err != nil {
+				return err
+			}
+			return tx.Where("alert_id = ?", alert.ID).Order("id").Find(&deliveries).Error
+		}
+		if err := publishAlertEvent(tx, EventAlertCreated, alert); err != nil {
+			return err
+		}
+		if alert.SuppressedBy != "" {
+			return nil
+		}
+		if deliveries, err = enqueueDeliveries(tx, alert); err != nil {
+			return err
+		}
+		return startEscalation(tx, alert)
+	})
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error creating alert in database", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create alert"})
 		return
 	}
 
-	// Parse timestamp
-	parsedTime, err := time.Parse(time.RFC3339, req.Timestamp)
-	if err != nil {
-		log.Printf("Error parsing timestamp: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid timestamp format"})
+	if duplicate {
+		slog.InfoContext(c.Request.Context(), "Duplicate alert event", "event_id", req.EventID, "alert_id", alert.ID)
+		alertsReceived.WithLabelValues(alert.Status, alert.Severity, "duplicate").Inc()
+		c.JSON(http.StatusOK, gin.H{"status": "Alert already received", "id": alert.ID, "deliveries": deliveries})
 		return
 	}
 
-	alert := Alert{
-		Similarity:   req.Similarity,
-		AlertMessage: req.AlertMessage,
-		FaceSnapshot: req.FaceSnapshot,
-		Timestamp:    parsedTime,
-		Status:       req.Status,
+	result := "created"
+	if alert.SuppressedBy != "" {
+		result = "suppressed"
 	}
+	alertsReceived.WithLabelValues(alert.Status, alert.Severity, result).Inc()
 
-	if err := db.Create(&alert).Error; err != nil {
-		log.Printf("Error creating alert in database: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create alert"})
+	wakeOutbox()
+	wakeEscalations()
+
+	c.JSON(http.StatusOK, gin.H{"status": "Alert queued", "id": alert.ID, "suppressed_by": alert.SuppressedBy, "deliveries": deliveries})
+}
+
+// updateAlertStateHandler cập nhật trạng thái xử lý của cảnh báo (xác nhận, đóng, báo nhầm)
+func updateAlertStateHandler(c *gin.Context) {
+	var req struct {
+		State string `json:"state"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
 		return
 	}
 
-	// Send SMS via Twilio
-	twilioPhoneNumber := os.Getenv("TWILIO_PHONE_NUMBER")
-	recipientPhoneNumber := os.Getenv("RECIPIENT_PHONE_NUMBER")
-	if twilioPhoneNumber == "" || recipientPhoneNumber == "" {
-		log.Printf("Twilio phone numbers are not set")
-	} else {
-		_, _, err := twilioClient.SendSMS(twilioPhoneNumber, recipientPhoneNumber, alert.AlertMessage, "", "")
-		if err != nil {
-			log.Printf("Error sending SMS: %v", err)
-		}
+	switch req.State {
+	case AlertStateOpen, AlertStateAcknowledged, AlertStateResolved, AlertStateFalsePositive:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid state"})
+		return
 	}
 
-	// Send Email via AWS SES
-	err = sendEmail(alert.AlertMessage)
+	alert, err := setAlertState(c.Param("id"), req.State)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Alert not found"})
+		return
+	}
 	if err != nil {
-		log.Printf("Error sending email: %v", err)
+		slog.ErrorContext(c.Request.Context(), "Error updating alert state", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update alert"})
+		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"status": "Alert sent"})
+	c.JSON(http.StatusOK, gin.H{"id": alert.ID, "state": alert.State})
 }
 
-func sendEmail(message string) error {
-	//input := &ses.SendEmailInput{
-	//	Destination: &ses.Destination{
-	//		ToAddresses: []string{emailRecipient},
-	//	},
-	//	Message: &ses.Message{
-	//		Body: &ses.Body{
-	//			Text: &ses.Content{
-	//				Charset: aws.String("UTF-8"),
-	//				Data:    aws.String(message),
-	//			},
-	//		},
-	//		Subject: &ses.Content{
-	//			Charset: aws.String("UTF-8"),
-	//			Data:    aws.String("Security Alert"),
-	//		},
-	//	},
-	//	Source: aws.String(emailSender),
-	//}
-	//
-	//_, err := sesClient.SendEmail(context.TODO(), input)
-	_, err := sesClient.SendEmail(context.TODO(), nil)
+// setAlertState đổi trạng thái xử lý của cảnh báo và phát sự kiện cập nhật.
+// Cảnh báo đã được xác nhận hoặc xử lý thì dừng leo thang.
+func setAlertState(id interface{}, state string) (Alert, error) {
+	var alert Alert
+	if err := db.Omit("face_snapshot").First(&alert, id).Error; err != nil {
+		return alert, err
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&alert).Update("state", state).Error; err != nil {
+			return err
+		}
+		alert.State = state
+		if err := publishAlertEvent(tx, EventAlertUpdated, alert); err != nil {
+			return err
+		}
+		if state == AlertStateOpen {
+			return nil
+		}
+		return stopEscalation(tx, alert.ID)
+	})
 	if err != nil {
-		return err
+		return alert, err
 	}
-	return nil
+	alertStateChanges.WithLabelValues(state).Inc()
+	return alert, nil
 }
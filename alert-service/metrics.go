@@ -0,0 +1,79 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "isafe_http_request_duration_seconds",
+		Help:    "HTTP request latency by route and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	alertsReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "isafe_alerts_received_total",
+		Help: "Alerts accepted on /send_alert by status, severity and result (created, suppressed, duplicate).",
+	}, []string{"status", "severity", "result"})
+
+	alertsRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "isafe_alerts_rejected_total",
+		Help: "Payloads rejected on /send_alert by error code.",
+	}, []string{"code"})
+
+	alertStateChanges = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "isafe_alert_state_changes_total",
+		Help: "Alert state transitions by new state.",
+	}, []string{"state"})
+
+	notificationDeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "isafe_notification_deliveries_total",
+		Help: "Notification delivery attempts by channel and outcome (delivered, retry, dead, rolled_up).",
+	}, []string{"channel", "outcome"})
+
+	notificationSendDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "isafe_notification_send_duration_seconds",
+		Help:    "Time spent sending one notification by channel.",
+		Buckets: []float64{.05, .1, .25, .5, 1, 2, 5, 10, 30},
+	}, []string{"channel"})
+)
+
+func init() {
+	// Số thông báo đang chờ gửi được đếm khi Prometheus scrape
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "isafe_notification_outbox_pending",
+		Help: "Notification deliveries waiting to be sent or retried.",
+	}, func() float64 {
+		if db == nil {
+			return 0
+		}
+		var count int64
+		if err := db.Model(&NotificationDelivery{}).Where("status IN ?", []string{DeliveryPending, DeliverySending}).
+			Count(&count).Error; err != nil {
+			return 0
+		}
+		return float64(count)
+	})
+}
+
+// metricsMiddleware đo thời gian xử lý mỗi request theo route đã khớp (không theo URL thật để tránh bùng nhãn)
+func metricsMiddleware(c *gin.Context) {
+	start := time.Now()
+	c.Next()
+
+	route := c.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+	httpRequestDuration.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).
+		Observe(time.Since(start).Seconds())
+}
+
+// metricsHandler trả metrics theo định dạng Prometheus
+var metricsHandler = gin.WrapH(promhttp.Handler())
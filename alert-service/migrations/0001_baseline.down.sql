@@ -0,0 +1,13 @@
+DROP TABLE IF EXISTS "notification_templates";
+DROP TABLE IF EXISTS "maintenance_windows";
+DROP TABLE IF EXISTS "silences";
+DROP TABLE IF EXISTS "alert_escalations";
+DROP TABLE IF EXISTS "escalation_steps";
+DROP TABLE IF EXISTS "escalation_policies";
+DROP TABLE IF EXISTS "on_call_schedules";
+DROP TABLE IF EXISTS "routing_rules";
+DROP TABLE IF EXISTS "recipient_contacts";
+DROP TABLE IF EXISTS "recipients";
+DROP TABLE IF EXISTS "dead_letters";
+DROP TABLE IF EXISTS "notification_deliveries";
+DROP TABLE IF EXISTS "alerts";
@@ -0,0 +1,176 @@
+-- Schema của alert-service tại thời điểm bỏ AutoMigrate.
+-- Dùng IF NOT EXISTS để cơ sở dữ liệu đã được AutoMigrate tạo trước đó chuyển sang migration mà không lỗi.
+
+CREATE TABLE IF NOT EXISTS "alerts" (
+    "id" bigserial,
+    "event_id" text,
+    "similarity" decimal,
+    "alert_message" text,
+    "face_snapshot" text,
+    "timestamp" timestamptz,
+    "status" text,
+    "device_id" text,
+    "zone" text,
+    "severity" text,
+    "suppressed_by" text,
+    "state" text DEFAULT 'open',
+    "updated_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_alerts_event_id" ON "alerts" ("event_id");
+
+CREATE TABLE IF NOT EXISTS "notification_deliveries" (
+    "id" bigserial,
+    "alert_id" bigint,
+    "recipient_id" bigint,
+    "channel" text,
+    "recipient" text,
+    "status" text,
+    "attempts" bigint,
+    "next_attempt_at" timestamptz,
+    "last_error" text,
+    "delivered_at" timestamptz,
+    "summary_count" bigint,
+    "providers" text[],
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_delivery_due" ON "notification_deliveries" ("status","next_attempt_at");
+CREATE INDEX IF NOT EXISTS "idx_notification_deliveries_alert_id" ON "notification_deliveries" ("alert_id");
+
+CREATE TABLE IF NOT EXISTS "dead_letters" (
+    "id" bigserial,
+    "delivery_id" bigint,
+    "alert_id" bigint,
+    "channel" text,
+    "recipient" text,
+    "attempts" bigint,
+    "last_error" text,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_dead_letters_alert_id" ON "dead_letters" ("alert_id");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_dead_letters_delivery_id" ON "dead_letters" ("delivery_id");
+
+CREATE TABLE IF NOT EXISTS "recipients" (
+    "id" bigserial,
+    "name" text,
+    "language" text,
+    "disabled" boolean,
+    "rate_limit" bigint,
+    "sms_providers" text[],
+    "updated_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+
+CREATE TABLE IF NOT EXISTS "recipient_contacts" (
+    "id" bigserial,
+    "recipient_id" bigint,
+    "channel" text,
+    "address" text,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_recipients_contacts" FOREIGN KEY ("recipient_id") REFERENCES "recipients"("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_recipient_contacts_recipient_id" ON "recipient_contacts" ("recipient_id");
+
+CREATE TABLE IF NOT EXISTS "routing_rules" (
+    "id" bigserial,
+    "name" text,
+    "statuses" text[],
+    "min_severity" text,
+    "zones" text[],
+    "start_time" text,
+    "end_time" text,
+    "recipient_ids" bigint[],
+    "channels" text[],
+    "disabled" boolean,
+    "updated_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+
+CREATE TABLE IF NOT EXISTS "on_call_schedules" (
+    "id" bigserial,
+    "name" text,
+    "recipient_ids" bigint[],
+    "rotation_start" timestamptz,
+    "shift_hours" bigint,
+    "updated_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+
+CREATE TABLE IF NOT EXISTS "escalation_policies" (
+    "id" bigserial,
+    "name" text,
+    "statuses" text[],
+    "min_severity" text,
+    "zones" text[],
+    "disabled" boolean,
+    "updated_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+
+CREATE TABLE IF NOT EXISTS "escalation_steps" (
+    "id" bigserial,
+    "policy_id" bigint,
+    "delay_minutes" bigint,
+    "schedule_id" bigint,
+    "recipient_ids" bigint[],
+    "channels" text[],
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_escalation_policies_steps" FOREIGN KEY ("policy_id") REFERENCES "escalation_policies"("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_escalation_steps_policy_id" ON "escalation_steps" ("policy_id");
+
+CREATE TABLE IF NOT EXISTS "alert_escalations" (
+    "id" bigserial,
+    "alert_id" bigint,
+    "policy_id" bigint,
+    "next_step" bigint,
+    "next_run_at" timestamptz,
+    "status" text,
+    "started_at" timestamptz,
+    "updated_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_alert_escalations_status" ON "alert_escalations" ("status");
+CREATE INDEX IF NOT EXISTS "idx_alert_escalations_next_run_at" ON "alert_escalations" ("next_run_at");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_alert_escalations_alert_id" ON "alert_escalations" ("alert_id");
+
+CREATE TABLE IF NOT EXISTS "silences" (
+    "id" bigserial,
+    "device_ids" text[],
+    "zones" text[],
+    "statuses" text[],
+    "starts_at" timestamptz,
+    "ends_at" timestamptz,
+    "comment" text,
+    "created_by" text,
+    "updated_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_silences_ends_at" ON "silences" ("ends_at");
+CREATE INDEX IF NOT EXISTS "idx_silences_starts_at" ON "silences" ("starts_at");
+
+CREATE TABLE IF NOT EXISTS "maintenance_windows" (
+    "id" bigserial,
+    "device_id" text,
+    "starts_at" timestamptz,
+    "ends_at" timestamptz,
+    "reason" text,
+    "updated_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_maintenance_windows_device_id" ON "maintenance_windows" ("device_id");
+
+CREATE TABLE IF NOT EXISTS "notification_templates" (
+    "id" bigserial,
+    "channel" text,
+    "locale" text,
+    "subject" text,
+    "body" text,
+    "html_body" text,
+    "updated_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_template_channel_locale" ON "notification_templates" ("channel","locale");
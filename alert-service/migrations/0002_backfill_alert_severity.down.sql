@@ -0,0 +1,2 @@
+-- Dữ liệu đã điền không phân biệt được với dữ liệu gốc nên không hoàn tác; chỉ gỡ phiên bản.
+SELECT 1;
@@ -0,0 +1,10 @@
+-- Cảnh báo tạo trước khi có định tuyến theo mức độ không có severity/state,
+-- điền theo cùng quy tắc với defaultSeverity để quy tắc định tuyến và leo thang so khớp được.
+UPDATE "alerts" SET "severity" = CASE "status"
+    WHEN 'unrecognized' THEN 'high'
+    WHEN 'visitor_zone_violation' THEN 'high'
+    ELSE 'medium'
+END
+WHERE "severity" IS NULL OR "severity" = '';
+
+UPDATE "alerts" SET "state" = 'open' WHERE "state" IS NULL OR "state" = '';
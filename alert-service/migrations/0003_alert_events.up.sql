@@ -0,0 +1,11 @@
+-- Sự kiện cảnh báo ghi cùng giao dịch với thay đổi cảnh báo. identity-verification xếp hàng webhook
+-- từ bảng này thay vì từ NOTIFY, để sự kiện không bị mất và chỉ được xếp hàng một lần dù có nhiều bản sao.
+CREATE TABLE IF NOT EXISTS "alert_events" (
+    "id" bigserial,
+    "type" text,
+    "payload" text,
+    "created_at" timestamptz,
+    "webhooks_enqueued_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_alert_events_pending_webhooks" ON "alert_events" ("id") WHERE "webhooks_enqueued_at" IS NULL;
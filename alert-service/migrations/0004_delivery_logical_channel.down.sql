@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS "idx_notification_deliveries_rate";
+ALTER TABLE "notification_deliveries" DROP COLUMN IF EXISTS "logical_channel";
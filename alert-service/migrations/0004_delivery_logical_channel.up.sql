@@ -0,0 +1,7 @@
+-- Kênh theo định tuyến của lần gửi: "sms" với chuỗi nhà cung cấp dự phòng, còn lại trùng channel.
+-- Không đổi khi failover nên giới hạn tần suất và thông báo tổng hợp tính đúng cho mỗi người nhận.
+ALTER TABLE "notification_deliveries" ADD COLUMN IF NOT EXISTS "logical_channel" text;
+UPDATE "notification_deliveries"
+SET "logical_channel" = CASE WHEN cardinality("providers") > 0 THEN 'sms' ELSE "channel" END
+WHERE "logical_channel" IS NULL;
+CREATE INDEX IF NOT EXISTS "idx_notification_deliveries_rate" ON "notification_deliveries" ("recipient","logical_channel","created_at");
@@ -0,0 +1 @@
+ALTER TABLE "alert_escalations" DROP COLUMN IF EXISTS "steps";
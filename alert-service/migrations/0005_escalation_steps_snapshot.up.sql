@@ -0,0 +1,17 @@
+-- Chụp lại các bước của chính sách trên từng leo thang để sửa chính sách không làm lệch chỉ số next_step
+-- của leo thang đang chạy. Leo thang cũ lấy các bước hiện tại của chính sách, sắp như sortedSteps.
+ALTER TABLE "alert_escalations" ADD COLUMN IF NOT EXISTS "steps" jsonb;
+UPDATE "alert_escalations" e
+SET "steps" = (
+    SELECT jsonb_agg(jsonb_build_object(
+        'id', s."id",
+        'policy_id', s."policy_id",
+        'delay_minutes', s."delay_minutes",
+        'schedule_id', s."schedule_id",
+        'recipient_ids', s."recipient_ids",
+        'channels', s."channels"
+    ) ORDER BY s."delay_minutes", s."id")
+    FROM "escalation_steps" s
+    WHERE s."policy_id" = e."policy_id"
+)
+WHERE e."steps" IS NULL;
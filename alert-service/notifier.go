@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// notifySendTimeout là thời gian tối đa cho một lần gửi thông báo
+const notifySendTimeout = 15 * time.Second
+
+// Notification là một thông báo cảnh báo gửi tới một người nhận, nội dung đã dựng từ mẫu theo ngôn ngữ
+type Notification struct {
+	Alert   Alert
+	To      string // Địa chỉ nhận tùy kênh: số điện thoại, email, URL webhook...
+	Subject string
+	Text    string
+	HTML    string // Chỉ có khi mẫu của kênh có phần HTML
+	Locale  string // Ngôn ngữ của người nhận, dùng cho các thành phần riêng của kênh (ví dụ nút bấm)
+}
+
+// Notifier gửi thông báo qua một kênh cụ thể
+type Notifier interface {
+	// Name là tên kênh, trùng với tên dùng trong biến môi trường NOTIFIERS
+	Name() string
+	Send(ctx context.Context, n Notification) error
+}
+
+// notifierFactory tạo notifier từ biến môi trường, trả về kèm danh sách người nhận mặc định
+type notifierFactory func() (Notifier, []string, error)
+
+// notifierFactories chứa các notifier đã đăng ký, theo tên kênh
+var notifierFactories = map[string]notifierFactory{}
+
+// registerNotifier đăng ký một loại notifier để có thể bật qua NOTIFIERS
+func registerNotifier(name string, factory notifierFactory) {
+	notifierFactories[name] = factory
+}
+
+// notificationChannel là một kênh đã bật cùng người nhận mặc định
+type notificationChannel struct {
+	notifier   Notifier
+	recipients []string
+}
+
+// channels là các kênh thông báo đang bật
+var channels []notificationChannel
+
+// loadNotifiers bật các kênh liệt kê trong NOTIFIERS (mặc định "log")
+func loadNotifiers() error {
+	names := splitList(os.Getenv("NOTIFIERS"))
+	if len(names) == 0 {
+		names = []string{"log"}
+	}
+
+	channels = nil
+	for _, name := range names {
+		factory, ok := notifierFactories[name]
+		if !ok {
+			return fmt.Errorf("unknown notifier %q (available: %s)", name, strings.Join(availableNotifiers(), ", "))
+		}
+		notifier, recipients, err := factory()
+		if err != nil {
+			return fmt.Errorf("configure notifier %q: %w", name, err)
+		}
+		if len(recipients) == 0 {
+			slog.Warn("Notifier has no default recipients", "notifier", name)
+		}
+		channels = append(channels, notificationChannel{notifier: notifier, recipients: recipients})
+		slog.Info("Notifier enabled", "notifier", name, "recipients", len(recipients))
+	}
+	return nil
+}
+
+// availableNotifiers liệt kê tên các notifier đã đăng ký
+func availableNotifiers() []string {
+	names := make([]string, 0, len(notifierFactories))
+	for name := range notifierFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// findNotifier trả về notifier đang bật theo tên kênh, nil nếu kênh không bật
+func findNotifier(name string) Notifier {
+	for _, ch := range channels {
+		if ch.notifier.Name() == name {
+			return ch.notifier
+		}
+	}
+	return nil
+}
+
+// postJSON gửi body dạng JSON tới url, giải mã phản hồi vào out. setHeaders (nếu có) dùng để thêm xác thực.
+func postJSON(ctx context.Context, client *http.Client, url string, body interface{}, setHeaders func(*http.Request), out interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if setHeaders != nil {
+		setHeaders(req)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s returned status %s: %s", req.URL.Host, resp.Status, strings.TrimSpace(string(data)))
+	}
+	if out != nil {
+		if err := json.Unmarshal(data, out); err != nil {
+			return fmt.Errorf("invalid response from %s: %w", req.URL.Host, err)
+		}
+	}
+	return nil
+}
+
+// requireEnv đọc các biến môi trường bắt buộc, báo lỗi liệt kê các biến còn thiếu
+func requireEnv(keys ...string) (map[string]string, error) {
+	values := make(map[string]string, len(keys))
+	var missing []string
+	for _, key := range keys {
+		v := os.Getenv(key)
+		if v == "" {
+			missing = append(missing, key)
+		}
+		values[key] = v
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing environment variables: %s", strings.Join(missing, ", "))
+	}
+	return values, nil
+}
+
+// splitList tách chuỗi phân tách bằng dấu phẩy, bỏ phần tử rỗng
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
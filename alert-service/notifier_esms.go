@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// esmsNotifier gửi SMS qua gateway eSMS.vn (API SendMultipleMessage_V4_post_json)
+type esmsNotifier struct {
+	client    *http.Client
+	url       string
+	apiKey    string
+	secretKey string
+	brandname string
+	smsType   string
+}
+
+func init() {
+	registerNotifier("esms", func() (Notifier, []string, error) {
+		env, err := requireEnv("ESMS_API_KEY", "ESMS_SECRET_KEY")
+		if err != nil {
+			return nil, nil, err
+		}
+		apiURL := strings.TrimRight(os.Getenv("ESMS_API_URL"), "/")
+		if apiURL == "" {
+			apiURL = "https://rest.esms.vn"
+		}
+		// SmsType 2 là tin chăm sóc khách hàng bằng brandname, 8 là đầu số cố định (không cần brandname)
+		smsType := os.Getenv("ESMS_SMS_TYPE")
+		if smsType == "" {
+			smsType = "2"
+		}
+		return &esmsNotifier{
+			client:    &http.Client{},
+			url:       apiURL + "/MainService.svc/json/SendMultipleMessage_V4_post_json/",
+			apiKey:    env["ESMS_API_KEY"],
+			secretKey: env["ESMS_SECRET_KEY"],
+			brandname: os.Getenv("ESMS_BRANDNAME"),
+			smsType:   smsType,
+		}, splitList(os.Getenv("RECIPIENT_PHONE_NUMBER")), nil
+	})
+}
+
+func (e *esmsNotifier) Name() string { return "esms" }
+
+func (e *esmsNotifier) Send(ctx context.Context, n Notification) error {
+	var resp struct {
+		CodeResult   string `json:"CodeResult"`
+		ErrorMessage string `json:"ErrorMessage"`
+		SMSID        string `json:"SMSID"`
+	}
+	err := postJSON(ctx, e.client, e.url, map[string]string{
+		"ApiKey":    e.apiKey,
+		"SecretKey": e.secretKey,
+		"Phone":     normalizeVNPhone(n.To),
+		"Content":   n.Text,
+		"Brandname": e.brandname,
+		"SmsType":   e.smsType,
+		"IsUnicode": "1",
+	}, nil, &resp)
+	if err != nil {
+		return err
+	}
+	// CodeResult 100 là gửi thành công, các mã khác là lỗi (sai khóa, hết tiền, brandname chưa đăng ký...)
+	if resp.CodeResult != "100" {
+		return fmt.Errorf("esms error %s: %s", resp.CodeResult, resp.ErrorMessage)
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+)
+
+// logNotifier chỉ ghi cảnh báo ra log, dùng khi phát triển
+type logNotifier struct{}
+
+func init() {
+	registerNotifier("log", func() (Notifier, []string, error) {
+		return logNotifier{}, []string{"log"}, nil
+	})
+}
+
+func (logNotifier) Name() string { return "log" }
+
+func (logNotifier) Send(ctx context.Context, n Notification) error {
+	slog.InfoContext(ctx, "Notification", "notifier", "log", "to", n.To, "alert_id", n.Alert.ID, "text", n.Text)
+	return nil
+}
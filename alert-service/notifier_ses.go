@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ses"
+	"github.com/aws/aws-sdk-go-v2/service/ses/types"
+)
+
+// sesNotifier gửi email qua AWS SES
+type sesNotifier struct {
+	client *ses.Client
+	sender string
+}
+
+func init() {
+	registerNotifier("ses", func() (Notifier, []string, error) {
+		env, err := requireEnv("AWS_REGION", "EMAIL_SENDER")
+		if err != nil {
+			return nil, nil, err
+		}
+		awsCfg, err := config.LoadDefaultConfig(context.Background(), config.WithRegion(env["AWS_REGION"]))
+		if err != nil {
+			return nil, nil, err
+		}
+		return &sesNotifier{
+			client: ses.NewFromConfig(awsCfg),
+			sender: env["EMAIL_SENDER"],
+		}, splitList(os.Getenv("EMAIL_RECIPIENT")), nil
+	})
+}
+
+func (s *sesNotifier) Name() string { return "ses" }
+
+func (s *sesNotifier) Send(ctx context.Context, n Notification) error {
+	input := &ses.SendEmailInput{
+		Destination: &types.Destination{
+			ToAddresses: []string{n.To},
+		},
+		Message: &types.Message{
+			Body: &types.Body{
+				Text: &types.Content{
+					Charset: aws.String("UTF-8"),
+					Data:    aws.String(n.Text),
+				},
+			},
+			Subject: &types.Content{
+				Charset: aws.String("UTF-8"),
+				Data:    aws.String(n.Subject),
+			},
+		},
+		Source: aws.String(s.sender),
+	}
+
+	if n.HTML != "" {
+		input.Message.Body.Html = &types.Content{
+			Charset: aws.String("UTF-8"),
+			Data:    aws.String(n.HTML),
+		}
+	}
+	_, err := s.client.SendEmail(ctx, input)
+	return err
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"strings"
+)
+
+// smsChannel là kênh ảo dùng trong danh bạ: địa chỉ là số điện thoại,
+// nhà cung cấp thực sự được chọn theo chuỗi ưu tiên và tự chuyển khi gửi lỗi
+const smsChannel = "sms"
+
+// smsProviderNames là các notifier gửi SMS, theo thứ tự ưu tiên mặc định
+var smsProviderNames = []string{"speedsms", "esms", "twilio"}
+
+// isSMSProvider kiểm tra notifier có phải nhà cung cấp SMS hay không
+func isSMSProvider(name string) bool {
+	return containsString(smsProviderNames, name)
+}
+
+// smsChain trả về chuỗi nhà cung cấp SMS đang bật theo thứ tự ưu tiên:
+// preferred (cấu hình của người nhận), rồi SMS_PROVIDERS, rồi thứ tự mặc định
+func smsChain(preferred []string) []string {
+	order := preferred
+	if len(order) == 0 {
+		order = splitList(os.Getenv("SMS_PROVIDERS"))
+	}
+	if len(order) == 0 {
+		order = smsProviderNames
+	}
+
+	var chain []string
+	for _, name := range order {
+		if isSMSProvider(name) && findNotifier(name) != nil && !containsString(chain, name) {
+			chain = append(chain, name)
+		}
+	}
+	return chain
+}
+
+// nextProvider trả về nhà cung cấp kế tiếp sau current trong chuỗi;
+// wrapped cho biết đã quay lại đầu chuỗi (mọi nhà cung cấp đều đã thử)
+func nextProvider(chain []string, current string) (next string, wrapped bool) {
+	for i, name := range chain {
+		if name == current {
+			if i+1 < len(chain) {
+				return chain[i+1], false
+			}
+			break
+		}
+	}
+	return chain[0], true
+}
+
+// normalizeVNPhone chuẩn hóa số điện thoại Việt Nam về dạng 84xxxxxxxxx mà các gateway trong nước yêu cầu
+func normalizeVNPhone(phone string) string {
+	var digits strings.Builder
+	for _, r := range phone {
+		if r >= '0' && r <= '9' {
+			digits.WriteRune(r)
+		}
+	}
+	number := digits.String()
+	if strings.HasPrefix(number, "0") {
+		return "84" + number[1:]
+	}
+	return number
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// enableChannels bật các kênh giả theo tên cùng người nhận mặc định trong thời gian chạy test
+func enableChannels(t *testing.T, recipients map[string][]string, names ...string) {
+	t.Helper()
+	previous := channels
+	channels = nil
+	for _, name := range names {
+		channels = append(channels, notificationChannel{notifier: &fakeNotifier{name: name}, recipients: recipients[name]})
+	}
+	t.Cleanup(func() { channels = previous })
+}
+
+func TestSMSChain(t *testing.T) {
+	enableChannels(t, nil, "log", "esms", "twilio", "telegram")
+	tests := []struct {
+		name      string
+		env       string
+		preferred []string
+		want      []string
+	}{
+		{"default order of enabled providers", "", nil, []string{"esms", "twilio"}},
+		{"SMS_PROVIDERS order", "twilio, esms", nil, []string{"twilio", "esms"}},
+		{"recipient preference wins", "twilio,esms", []string{"esms"}, []string{"esms"}},
+		{"disabled provider skipped", "", []string{"speedsms", "twilio"}, []string{"twilio"}},
+		{"non-SMS channel skipped", "telegram,esms", nil, []string{"esms"}},
+		{"duplicates removed", "", []string{"twilio", "esms", "twilio"}, []string{"twilio", "esms"}},
+		{"nothing enabled", "speedsms", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SMS_PROVIDERS", tt.env)
+			if got := smsChain(tt.preferred); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("smsChain(%v) = %v, want %v", tt.preferred, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextProvider(t *testing.T) {
+	chain := []string{"speedsms", "esms", "twilio"}
+	tests := []struct {
+		current     string
+		want        string
+		wantWrapped bool
+	}{
+		{"speedsms", "esms", false},
+		{"esms", "twilio", false},
+		{"twilio", "speedsms", true},
+		{"zalo", "speedsms", true}, // Kênh không còn trong chuỗi thì bắt đầu lại từ đầu
+	}
+	for _, tt := range tests {
+		if got, wrapped := nextProvider(chain, tt.current); got != tt.want || wrapped != tt.wantWrapped {
+			t.Errorf("nextProvider(%q) = %q, %v; want %q, %v", tt.current, got, wrapped, tt.want, tt.wantWrapped)
+		}
+	}
+}
+
+func TestPlanRetryFailover(t *testing.T) {
+	now := time.Now()
+	chain := []string{"speedsms", "esms", "twilio"}
+
+	// Còn nhà cung cấp chưa thử thì chuyển ngay, không chờ backoff
+	retry := planRetry(NotificationDelivery{Channel: "speedsms", Providers: chain, Attempts: 1}, now)
+	if retry.Dead || retry.Channel != "esms" || !retry.At.Equal(now) {
+		t.Errorf("first failover = %+v, want esms now", retry)
+	}
+
+	// Mọi nhà cung cấp đều lỗi thì quay lại đầu chuỗi sau backoff
+	retry = planRetry(NotificationDelivery{Channel: "twilio", Providers: chain, Attempts: 3}, now)
+	if retry.Dead || retry.Channel != "speedsms" || !retry.At.After(now) {
+		t.Errorf("wrapped failover = %+v, want speedsms after backoff", retry)
+	}
+
+	// Chuỗi một nhà cung cấp thì thử lại chính nó
+	retry = planRetry(NotificationDelivery{Channel: "esms", Providers: []string{"esms"}, Attempts: 1}, now)
+	if retry.Channel != "esms" || !retry.At.After(now) {
+		t.Errorf("single provider retry = %+v, want esms after backoff", retry)
+	}
+
+	if retry := planRetry(NotificationDelivery{Channel: "esms", Providers: chain, Attempts: outboxMaxAttempts}, now); !retry.Dead {
+		t.Error("failover continued after outboxMaxAttempts")
+	}
+}
+
+func TestDefaultTargetsSMS(t *testing.T) {
+	t.Setenv("SMS_PROVIDERS", "")
+	enableChannels(t, map[string][]string{
+		"telegram": {"ops-chat"},
+		"speedsms": {"0901234567"},
+		"twilio":   {"0901234567", "+84987654321"},
+	}, "telegram", "speedsms", "twilio")
+
+	chain := []string{"speedsms", "twilio"}
+	want := []deliveryTarget{
+		{Channel: "telegram", Address: "ops-chat"},
+		{Channel: "speedsms", Address: "0901234567", Providers: chain},
+		{Channel: "speedsms", Address: "+84987654321", Providers: chain},
+	}
+	if got := defaultTargets(); !reflect.DeepEqual(got, want) {
+		t.Errorf("defaultTargets() = %+v, want %+v", got, want)
+	}
+
+	// Nhà cung cấp không có trong SMS_PROVIDERS gửi riêng như kênh thường
+	t.Setenv("SMS_PROVIDERS", "speedsms")
+	want = []deliveryTarget{
+		{Channel: "telegram", Address: "ops-chat"},
+		{Channel: "speedsms", Address: "0901234567", Providers: []string{"speedsms"}},
+		{Channel: "twilio", Address: "0901234567"},
+		{Channel: "twilio", Address: "+84987654321"},
+	}
+	if got := defaultTargets(); !reflect.DeepEqual(got, want) {
+		t.Errorf("defaultTargets() with SMS_PROVIDERS = %+v, want %+v", got, want)
+	}
+}
+
+func TestNormalizeVNPhone(t *testing.T) {
+	tests := map[string]string{
+		"0901234567":      "84901234567",
+		"+84 901 234 567": "84901234567",
+		"84-90-123-4567":  "84901234567",
+		"(090) 123.45.67": "84901234567",
+		"+1 415 555 0100": "14155550100",
+		"":                "",
+	}
+	for in, want := range tests {
+		if got := normalizeVNPhone(in); got != want {
+			t.Errorf("normalizeVNPhone(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+)
+
+// snapshotContentID là Content-ID của ảnh chụp được nhúng trong email
+const snapshotContentID = "snapshot@isafe"
+
+// smtpNotifier gửi email HTML kèm ảnh chụp nhúng qua máy chủ SMTP
+type smtpNotifier struct {
+	host string
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+func init() {
+	registerNotifier("smtp", func() (Notifier, []string, error) {
+		env, err := requireEnv("SMTP_HOST", "SMTP_FROM")
+		if err != nil {
+			return nil, nil, err
+		}
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "25"
+		}
+
+		n := &smtpNotifier{
+			host: env["SMTP_HOST"],
+			addr: net.JoinHostPort(env["SMTP_HOST"], port),
+			from: env["SMTP_FROM"],
+		}
+		// Không cấu hình tài khoản thì gửi không xác thực (ví dụ MailHog khi phát triển)
+		if username := os.Getenv("SMTP_USERNAME"); username != "" {
+			n.auth = smtp.PlainAuth("", username, os.Getenv("SMTP_PASSWORD"), env["SMTP_HOST"])
+		}
+		return n, splitList(os.Getenv("EMAIL_RECIPIENT")), nil
+	})
+}
+
+func (s *smtpNotifier) Name() string { return "smtp" }
+
+func (s *smtpNotifier) Send(ctx context.Context, n Notification) error {
+	msg, err := s.buildMessage(n)
+	if err != nil {
+		return err
+	}
+
+	// net/smtp không hỗ trợ context, chạy trong goroutine để tôn trọng timeout
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- smtp.SendMail(s.addr, s.auth, s.from, []string{n.To}, msg)
+	}()
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// buildMessage tạo email MIME multipart/related gồm bản văn bản, bản HTML và ảnh chụp nhúng
+func (s *smtpNotifier) buildMessage(n Notification) ([]byte, error) {
+	snapshot, _ := base64.StdEncoding.DecodeString(stripDataURL(n.Alert.FaceSnapshot))
+	text := strings.ReplaceAll(n.Text, "\n", "\r\n") + "\r\n"
+
+	var buf bytes.Buffer
+	related := multipart.NewWriter(&buf)
+	altBoundary := multipart.NewWriter(io.Discard).Boundary()
+
+	fmt.Fprintf(&buf, "From: %s\r\n", s.from)
+	fmt.Fprintf(&buf, "To: %s\r\n", n.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("UTF-8", n.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <alert-%d-%d@%s>\r\n", n.Alert.ID, time.Now().UnixNano(), s.host)
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/related; type=\"multipart/alternative\"; boundary=%s\r\n\r\n", related.Boundary())
+
+	// Phần multipart/alternative chứa bản văn bản và bản HTML
+	altPart, err := related.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {fmt.Sprintf("multipart/alternative; boundary=%s", altBoundary)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	alternative := multipart.NewWriter(altPart)
+	if err := alternative.SetBoundary(altBoundary); err != nil {
+		return nil, err
+	}
+	type body struct {
+		contentType string
+		content     string
+	}
+	bodies := []body{{"text/plain; charset=UTF-8", text}}
+	if n.HTML != "" {
+		bodies = append(bodies, body{"text/html; charset=UTF-8", n.HTML})
+	}
+	for _, body := range bodies {
+		part, err := alternative.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {body.contentType},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		writeBase64(part, []byte(body.content))
+	}
+	if err := alternative.Close(); err != nil {
+		return nil, err
+	}
+
+	// Ảnh chụp khuôn mặt nhúng inline, được tham chiếu bằng cid trong HTML
+	if len(snapshot) > 0 {
+		contentType := http.DetectContentType(snapshot)
+		part, err := related.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {contentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-ID":                {"<" + snapshotContentID + ">"},
+			"Content-Disposition":       {"inline; filename=snapshot.jpg"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		writeBase64(part, snapshot)
+	}
+
+	if err := related.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeBase64 ghi dữ liệu mã hóa base64, ngắt dòng 76 ký tự theo RFC 2045
+func writeBase64(w io.Writer, data []byte) {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		io.WriteString(w, encoded[:76]+"\r\n")
+		encoded = encoded[76:]
+	}
+	io.WriteString(w, encoded+"\r\n")
+}
+
+// stripDataURL bỏ tiền tố data URL (ví dụ "data:image/jpeg;base64,") nếu có
+func stripDataURL(encoded string) string {
+	if idx := strings.Index(encoded, ","); idx != -1 {
+		return encoded[idx+1:]
+	}
+	return encoded
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// speedSMSNotifier gửi SMS qua gateway SpeedSMS.vn
+type speedSMSNotifier struct {
+	client  *http.Client
+	url     string
+	token   string
+	sender  string
+	smsType int
+}
+
+func init() {
+	registerNotifier("speedsms", func() (Notifier, []string, error) {
+		env, err := requireEnv("SPEEDSMS_ACCESS_TOKEN")
+		if err != nil {
+			return nil, nil, err
+		}
+		apiURL := strings.TrimRight(os.Getenv("SPEEDSMS_API_URL"), "/")
+		if apiURL == "" {
+			apiURL = "https://api.speedsms.vn/index.php"
+		}
+		// sms_type 2 là tin CSKH đầu số ngẫu nhiên, 3 là brandname (cần SPEEDSMS_SENDER)
+		smsType, err := strconv.Atoi(os.Getenv("SPEEDSMS_SMS_TYPE"))
+		if err != nil {
+			smsType = 2
+		}
+		return &speedSMSNotifier{
+			client:  &http.Client{},
+			url:     apiURL + "/sms/send",
+			token:   env["SPEEDSMS_ACCESS_TOKEN"],
+			sender:  os.Getenv("SPEEDSMS_SENDER"),
+			smsType: smsType,
+		}, splitList(os.Getenv("RECIPIENT_PHONE_NUMBER")), nil
+	})
+}
+
+func (s *speedSMSNotifier) Name() string { return "speedsms" }
+
+func (s *speedSMSNotifier) Send(ctx context.Context, n Notification) error {
+	var resp struct {
+		Status  string `json:"status"`
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+	body := map[string]interface{}{
+		"to":       []string{normalizeVNPhone(n.To)},
+		"content":  n.Text,
+		"sms_type": s.smsType,
+	}
+	if s.sender != "" {
+		body["sender"] = s.sender
+	}
+	// SpeedSMS xác thực bằng Basic Auth với access token làm username
+	err := postJSON(ctx, s.client, s.url, body, func(req *http.Request) {
+		req.SetBasicAuth(s.token, "x")
+	}, &resp)
+	if err != nil {
+		return err
+	}
+	if resp.Status != "success" {
+		return fmt.Errorf("speedsms error %s: %s", resp.Code, resp.Message)
+	}
+	return nil
+}
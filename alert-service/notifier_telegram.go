@@ -0,0 +1,371 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// telegramCaptionLimit là độ dài tối đa của caption ảnh theo Bot API
+const telegramCaptionLimit = 1024
+
+// telegramPollTimeout là thời gian long polling của getUpdates (giây)
+const telegramPollTimeout = 30
+
+// Các thao tác của nút bấm inline, mã hóa trong callback_data dạng "<action>:<alert id>"
+const (
+	telegramActionAck      = "ack"
+	telegramActionFalse    = "fp"
+	telegramActionEscalate = "esc"
+)
+
+// telegramLabels là nhãn nút bấm và phản hồi theo ngôn ngữ
+var telegramLabels = map[string]map[string]string{
+	"vi": {
+		telegramActionAck:      "✅ Xác nhận",
+		telegramActionFalse:    "🚫 Báo nhầm",
+		telegramActionEscalate: "⏫ Leo thang",
+		"acknowledged":         "Đã xác nhận cảnh báo #%d",
+		"false_positive":       "Đã đánh dấu báo nhầm cảnh báo #%d",
+		"escalated":            "Đã leo thang cảnh báo #%d",
+		"no_escalation":        "Cảnh báo #%d không có chính sách leo thang đang chạy",
+		"failed":               "Không xử lý được cảnh báo #%d",
+	},
+	"en": {
+		telegramActionAck:      "✅ Acknowledge",
+		telegramActionFalse:    "🚫 False positive",
+		telegramActionEscalate: "⏫ Escalate",
+		"acknowledged":         "Alert #%d acknowledged",
+		"false_positive":       "Alert #%d marked as false positive",
+		"escalated":            "Alert #%d escalated",
+		"no_escalation":        "Alert #%d has no active escalation",
+		"failed":               "Could not update alert #%d",
+	},
+}
+
+// telegramNotifier gửi ảnh chụp kèm caption qua Telegram Bot API, có nút xử lý cảnh báo ngay trong chat
+type telegramNotifier struct {
+	baseURL string         // <TELEGRAM_API_URL>/bot<token>
+	secret  string         // So khớp header X-Telegram-Bot-Api-Secret-Token của webhook, trống thì webhook bị tắt
+	chatIDs map[int64]bool // Các chat trong TELEGRAM_CHAT_IDS được phép bấm nút xử lý cảnh báo
+	client  *http.Client
+}
+
+func init() {
+	registerNotifier("telegram", func() (Notifier, []string, error) {
+		env, err := requireEnv("TELEGRAM_BOT_TOKEN")
+		if err != nil {
+			return nil, nil, err
+		}
+		// TELEGRAM_API_URL cho phép trỏ tới máy chủ Bot API giả lập khi kiểm thử
+		apiURL := strings.TrimRight(os.Getenv("TELEGRAM_API_URL"), "/")
+		if apiURL == "" {
+			apiURL = "https://api.telegram.org"
+		}
+
+		chats := splitList(os.Getenv("TELEGRAM_CHAT_IDS"))
+		n := &telegramNotifier{
+			baseURL: apiURL + "/bot" + env["TELEGRAM_BOT_TOKEN"],
+			secret:  os.Getenv("TELEGRAM_WEBHOOK_SECRET"),
+			chatIDs: make(map[int64]bool, len(chats)),
+			client:  &http.Client{Timeout: (telegramPollTimeout + 10) * time.Second},
+		}
+		for _, chat := range chats {
+			id, err := strconv.ParseInt(chat, 10, 64)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid TELEGRAM_CHAT_IDS entry %q", chat)
+			}
+			n.chatIDs[id] = true
+		}
+		// Không có địa chỉ public để nhận webhook thì dùng long polling
+		if os.Getenv("TELEGRAM_POLLING") == "true" {
+			app.Go(n.poll)
+		} else if n.secret == "" {
+			slog.Warn("TELEGRAM_WEBHOOK_SECRET is not set, Telegram webhook is disabled and buttons will not work")
+		}
+		return n, chats, nil
+	})
+}
+
+// telegramUpdate là phần cần dùng của một Update từ Bot API
+type telegramUpdate struct {
+	UpdateID      int64 `json:"update_id"`
+	CallbackQuery *struct {
+		ID   string `json:"id"`
+		Data string `json:"data"`
+		From struct {
+			ID           int64  `json:"id"`
+			Username     string `json:"username"`
+			LanguageCode string `json:"language_code"`
+		} `json:"from"`
+		Message *struct {
+			MessageID int64 `json:"message_id"`
+			Chat      struct {
+				ID int64 `json:"id"`
+			} `json:"chat"`
+		} `json:"message"`
+	} `json:"callback_query"`
+}
+
+// telegramButton là một nút bấm inline
+type telegramButton struct {
+	Text         string `json:"text"`
+	CallbackData string `json:"callback_data"`
+}
+
+func (t *telegramNotifier) Name() string { return "telegram" }
+
+func (t *telegramNotifier) Send(ctx context.Context, n Notification) error {
+	markup, err := json.Marshal(telegramKeyboard(n.Alert.ID, n.Locale))
+	if err != nil {
+		return err
+	}
+
+	snapshot, _ := base64.StdEncoding.DecodeString(stripDataURL(n.Alert.FaceSnapshot))
+	if len(snapshot) == 0 {
+		return t.callJSON(ctx, "sendMessage", map[string]interface{}{
+			"chat_id":      n.To,
+			"text":         n.Text,
+			"reply_markup": json.RawMessage(markup),
+		}, nil)
+	}
+
+	caption := n.Text
+	if r := []rune(caption); len(r) > telegramCaptionLimit {
+		caption = string(r[:telegramCaptionLimit-1]) + "…"
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("chat_id", n.To)
+	writer.WriteField("caption", caption)
+	writer.WriteField("reply_markup", string(markup))
+	part, err := writer.CreateFormFile("photo", fmt.Sprintf("alert-%d.jpg", n.Alert.ID))
+	if err != nil {
+		return err
+	}
+	part.Write(snapshot)
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return t.call(ctx, "sendPhoto", writer.FormDataContentType(), &body, nil)
+}
+
+// telegramKeyboard tạo các nút xử lý cảnh báo
+func telegramKeyboard(alertID uint, locale string) map[string]interface{} {
+	labels := telegramLabels[locale]
+	if labels == nil {
+		labels = telegramLabels["en"]
+	}
+	button := func(action string) telegramButton {
+		return telegramButton{Text: labels[action], CallbackData: fmt.Sprintf("%s:%d", action, alertID)}
+	}
+	return map[string]interface{}{
+		"inline_keyboard": [][]telegramButton{
+			{button(telegramActionAck), button(telegramActionFalse)},
+			{button(telegramActionEscalate)},
+		},
+	}
+}
+
+// callJSON gọi một phương thức Bot API với body JSON
+func (t *telegramNotifier) callJSON(ctx context.Context, method string, params interface{}, result interface{}) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return t.call(ctx, method, "application/json", bytes.NewReader(body), result)
+}
+
+// call gọi một phương thức Bot API và giải mã trường result nếu thành công
+func (t *telegramNotifier) call(ctx context.Context, method, contentType string, body io.Reader, result interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.baseURL+"/"+method, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		// Lỗi từ net/http chứa URL có token, bỏ URL trước khi trả về
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("telegram %s: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	var out struct {
+		OK          bool            `json:"ok"`
+		Description string          `json:"description"`
+		Result      json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&out); err != nil {
+		return fmt.Errorf("telegram %s: invalid response (%s): %w", method, resp.Status, err)
+	}
+	if !out.OK {
+		return fmt.Errorf("telegram %s: %s", method, out.Description)
+	}
+	if result != nil {
+		return json.Unmarshal(out.Result, result)
+	}
+	return nil
+}
+
+// handleUpdate xử lý lần bấm nút inline: đổi trạng thái hoặc leo thang cảnh báo rồi phản hồi người bấm
+func (t *telegramNotifier) handleUpdate(update telegramUpdate) {
+	cb := update.CallbackQuery
+	if cb == nil {
+		return
+	}
+	// Chỉ nhận thao tác từ các chat được gửi cảnh báo; tin nhắn inline (không có Message) cũng bị bỏ qua
+	if cb.Message == nil || !t.allowedChat(cb.Message.Chat.ID) {
+		slog.Warn("Ignoring Telegram callback from unknown chat", "telegram_user_id", cb.From.ID)
+		return
+	}
+
+	locale := defaultLocale()
+	if strings.HasPrefix(cb.From.LanguageCode, "en") {
+		locale = "en"
+	}
+	labels := telegramLabels[locale]
+
+	action, rawID, _ := strings.Cut(cb.Data, ":")
+	alertID, err := strconv.ParseUint(rawID, 10, 64)
+	if err != nil {
+		slog.Warn("Invalid Telegram callback data", "data", cb.Data)
+		return
+	}
+
+	var reply string
+	removeButtons := false
+	switch action {
+	case telegramActionAck, telegramActionFalse:
+		state, key := AlertStateAcknowledged, "acknowledged"
+		if action == telegramActionFalse {
+			state, key = AlertStateFalsePositive, "false_positive"
+		}
+		if _, err := setAlertState(uint(alertID), state); err != nil {
+			slog.Error("Error updating alert from Telegram", "alert_id", alertID, "error", err)
+			reply = fmt.Sprintf(labels["failed"], alertID)
+			break
+		}
+		slog.Info("Alert state set from Telegram", "alert_id", alertID, "state", state, "telegram_user_id", cb.From.ID, "telegram_username", cb.From.Username)
+		reply = fmt.Sprintf(labels[key], alertID)
+		removeButtons = true
+	case telegramActionEscalate:
+		switch err := escalateNow(uint(alertID)); {
+		case errors.Is(err, errNoActiveEscalation):
+			reply = fmt.Sprintf(labels["no_escalation"], alertID)
+		case err != nil:
+			slog.Error("Error escalating alert from Telegram", "alert_id", alertID, "error", err)
+			reply = fmt.Sprintf(labels["failed"], alertID)
+		default:
+			slog.Info("Alert escalated from Telegram", "alert_id", alertID, "telegram_user_id", cb.From.ID, "telegram_username", cb.From.Username)
+			reply = fmt.Sprintf(labels["escalated"], alertID)
+		}
+	default:
+		slog.Warn("Unknown Telegram callback action", "action", action)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), notifySendTimeout)
+	defer cancel()
+	if err := t.callJSON(ctx, "answerCallbackQuery", map[string]interface{}{
+		"callback_query_id": cb.ID,
+		"text":              reply,
+	}, nil); err != nil {
+		slog.Error("Error answering Telegram callback", "error", err)
+	}
+	if removeButtons && cb.Message != nil {
+		if err := t.callJSON(ctx, "editMessageReplyMarkup", map[string]interface{}{
+			"chat_id":      cb.Message.Chat.ID,
+			"message_id":   cb.Message.MessageID,
+			"reply_markup": map[string]interface{}{"inline_keyboard": [][]telegramButton{}},
+		}, nil); err != nil {
+			slog.Error("Error removing Telegram buttons", "error", err)
+		}
+	}
+}
+
+// allowedChat cho biết chat có nằm trong TELEGRAM_CHAT_IDS hoặc là liên lạc kênh telegram của người nhận
+func (t *telegramNotifier) allowedChat(chatID int64) bool {
+	if t.chatIDs[chatID] {
+		return true
+	}
+	var count int64
+	if err := db.Model(&RecipientContact{}).
+		Where("channel = ? AND address = ?", t.Name(), strconv.FormatInt(chatID, 10)).
+		Count(&count).Error; err != nil {
+		slog.Error("Error looking up Telegram chat", "error", err)
+		return false
+	}
+	return count > 0
+}
+
+// poll nhận update bằng getUpdates khi không dùng webhook, dừng khi dịch vụ tắt
+func (t *telegramNotifier) poll() {
+	var offset int64
+	for !app.IsStopping() {
+		var updates []telegramUpdate
+		err := t.callJSON(app.StoppingContext(), "getUpdates", map[string]interface{}{
+			"offset":          offset,
+			"timeout":         telegramPollTimeout,
+			"allowed_updates": []string{"callback_query"},
+		}, &updates)
+		if app.IsStopping() {
+			return
+		}
+		if err != nil {
+			slog.Error("Error polling Telegram updates", "error", err)
+			time.Sleep(5 * time.Second)
+			continue
+		}
+		for _, update := range updates {
+			offset = update.UpdateID + 1
+			t.handleUpdate(update)
+		}
+	}
+}
+
+// telegramWebhookHandler nhận update từ Telegram (setWebhook trỏ tới /telegram/webhook)
+func telegramWebhookHandler(c *gin.Context) {
+	t, ok := findNotifier("telegram").(*telegramNotifier)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Telegram notifier is not enabled"})
+		return
+	}
+	// Không có secret thì không xác thực được nguồn gửi, từ chối thay vì nhận update giả mạo
+	if t.secret == "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Telegram webhook secret is not configured"})
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(c.GetHeader("X-Telegram-Bot-Api-Secret-Token")), []byte(t.secret)) != 1 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid secret token"})
+		return
+	}
+
+	var update telegramUpdate
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid update"})
+		return
+	}
+	t.handleUpdate(update)
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
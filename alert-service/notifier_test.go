@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeNotifier ghi lại các thông báo đã gửi, trả về err nếu có
+type fakeNotifier struct {
+	name string
+	err  error
+	sent []Notification
+}
+
+func (f *fakeNotifier) Name() string { return f.name }
+
+func (f *fakeNotifier) Send(ctx context.Context, n Notification) error {
+	f.sent = append(f.sent, n)
+	return f.err
+}
+
+// stubNotifier đăng ký factory tạm thời và khôi phục các kênh đang bật sau test
+func stubNotifier(t *testing.T, name string, factory notifierFactory) {
+	t.Helper()
+	previous := channels
+	registerNotifier(name, factory)
+	t.Cleanup(func() {
+		delete(notifierFactories, name)
+		channels = previous
+	})
+}
+
+func TestNotifierRegistry(t *testing.T) {
+	want := []string{"esms", "log", "ses", "smtp", "speedsms", "telegram", "twilio", "webhook", "zalo"}
+	if got := availableNotifiers(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("availableNotifiers() = %v, want %v", got, want)
+	}
+}
+
+func TestLoadNotifiers(t *testing.T) {
+	fake := &fakeNotifier{name: "fake"}
+	stubNotifier(t, "fake", func() (Notifier, []string, error) { return fake, []string{"ops"}, nil })
+	stubNotifier(t, "broken", func() (Notifier, []string, error) { return nil, nil, errors.New("missing token") })
+
+	tests := []struct {
+		name    string
+		env     string
+		want    []string
+		wantErr string
+	}{
+		{"default is log", "", []string{"log"}, ""},
+		{"list with spaces", " fake , log ", []string{"fake", "log"}, ""},
+		{"unknown notifier", "fake,pager", nil, `unknown notifier "pager" (available: `},
+		{"factory error", "broken", nil, `configure notifier "broken": missing token`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("NOTIFIERS", tt.env)
+			err := loadNotifiers()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("loadNotifiers() = %v, want error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadNotifiers() = %v", err)
+			}
+			var got []string
+			for _, ch := range channels {
+				got = append(got, ch.notifier.Name())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("channels = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	t.Setenv("NOTIFIERS", "fake")
+	if err := loadNotifiers(); err != nil {
+		t.Fatal(err)
+	}
+	if findNotifier("fake") != fake || findNotifier("log") != nil {
+		t.Fatal("findNotifier does not match the enabled channels")
+	}
+	if !reflect.DeepEqual(channels[0].recipients, []string{"ops"}) {
+		t.Errorf("default recipients = %v, want [ops]", channels[0].recipients)
+	}
+}
+
+func TestPostJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr string
+	}{
+		{"ok", http.StatusOK, `{"id":"m1"}`, ""},
+		{"error status", http.StatusBadGateway, "upstream down\n", "returned status 502 Bad Gateway: upstream down"},
+		{"invalid response", http.StatusOK, "<html>", "invalid response from"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got map[string]string
+			var auth string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				auth = r.Header.Get("Authorization")
+				json.NewDecoder(r.Body).Decode(&got)
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.body)
+			}))
+			defer srv.Close()
+
+			var out struct{ ID string }
+			err := postJSON(context.Background(), srv.Client(), srv.URL, map[string]string{"text": "hi"},
+				func(r *http.Request) { r.Header.Set("Authorization", "Bearer t") }, &out)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("postJSON() = %v, want error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("postJSON() = %v", err)
+			}
+			if out.ID != "m1" || got["text"] != "hi" || auth != "Bearer t" {
+				t.Errorf("out = %+v, sent = %v, auth = %q", out, got, auth)
+			}
+		})
+	}
+}
+
+func TestWebhookNotifierSend(t *testing.T) {
+	var got Alert
+	status := http.StatusNoContent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	n := &webhookNotifier{client: srv.Client()}
+	if err := n.Send(context.Background(), Notification{To: srv.URL, Alert: Alert{ID: 7, Status: "unrecognized"}}); err != nil {
+		t.Fatalf("Send() = %v", err)
+	}
+	if got.ID != 7 || got.Status != "unrecognized" {
+		t.Errorf("webhook received %+v", got)
+	}
+
+	status = http.StatusInternalServerError
+	if err := n.Send(context.Background(), Notification{To: srv.URL}); err == nil {
+		t.Error("Send() succeeded on a 500 response")
+	}
+}
+
+func TestRequireEnv(t *testing.T) {
+	t.Setenv("NOTIFY_TEST_A", "a")
+	t.Setenv("NOTIFY_TEST_B", "")
+	if _, err := requireEnv("NOTIFY_TEST_A", "NOTIFY_TEST_B", "NOTIFY_TEST_C"); err == nil ||
+		err.Error() != "missing environment variables: NOTIFY_TEST_B, NOTIFY_TEST_C" {
+		t.Fatalf("requireEnv() = %v", err)
+	}
+	values, err := requireEnv("NOTIFY_TEST_A")
+	if err != nil || values["NOTIFY_TEST_A"] != "a" {
+		t.Fatalf("requireEnv() = %v, %v", values, err)
+	}
+}
+
+func TestSplitList(t *testing.T) {
+	tests := map[string][]string{
+		"":           nil,
+		" , ,":       nil,
+		"a":          {"a"},
+		" a, b ,,c ": {"a", "b", "c"},
+	}
+	for in, want := range tests {
+		if got := splitList(in); !reflect.DeepEqual(got, want) {
+			t.Errorf("splitList(%q) = %v, want %v", in, got, want)
+		}
+	}
+}
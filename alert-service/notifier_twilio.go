@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/sfreiberg/gotwilio"
+)
+
+// twilioNotifier gửi SMS qua Twilio
+type twilioNotifier struct {
+	client *gotwilio.Twilio
+	from   string
+}
+
+func init() {
+	registerNotifier("twilio", func() (Notifier, []string, error) {
+		env, err := requireEnv("TWILIO_ACCOUNT_SID", "TWILIO_AUTH_TOKEN", "TWILIO_PHONE_NUMBER")
+		if err != nil {
+			return nil, nil, err
+		}
+		return &twilioNotifier{
+			client: gotwilio.NewTwilioClient(env["TWILIO_ACCOUNT_SID"], env["TWILIO_AUTH_TOKEN"]),
+			from:   env["TWILIO_PHONE_NUMBER"],
+		}, splitList(os.Getenv("RECIPIENT_PHONE_NUMBER")), nil
+	})
+}
+
+func (t *twilioNotifier) Name() string { return "twilio" }
+
+func (t *twilioNotifier) Send(ctx context.Context, n Notification) error {
+	// Twilio cần số dạng E.164; số trong nước (0xxx) dùng chung với các gateway Việt Nam thì thêm mã quốc gia
+	to := n.To
+	if !strings.HasPrefix(to, "+") {
+		to = "+" + normalizeVNPhone(to)
+	}
+	_, exception, err := t.client.SendSMSWithContext(ctx, t.from, to, n.Text, "", "")
+	if err != nil {
+		return err
+	}
+	if exception != nil {
+		return exception
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+)
+
+// webhookNotifier gửi cảnh báo dạng JSON tới một URL bất kỳ
+type webhookNotifier struct {
+	client *http.Client
+}
+
+func init() {
+	registerNotifier("webhook", func() (Notifier, []string, error) {
+		urls := splitList(os.Getenv("WEBHOOK_URLS"))
+		if len(urls) == 0 {
+			return nil, nil, fmt.Errorf("missing environment variables: WEBHOOK_URLS")
+		}
+		return &webhookNotifier{client: &http.Client{}}, urls, nil
+	})
+}
+
+func (w *webhookNotifier) Name() string { return "webhook" }
+
+func (w *webhookNotifier) Send(ctx context.Context, n Notification) error {
+	body, err := json.Marshal(n.Alert)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.To, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// zaloNotifier gửi tin nhắn tư vấn từ Zalo Official Account tới người quan tâm OA (theo user_id)
+type zaloNotifier struct {
+	client      *http.Client
+	url         string
+	accessToken string
+}
+
+func init() {
+	registerNotifier("zalo", func() (Notifier, []string, error) {
+		env, err := requireEnv("ZALO_OA_ACCESS_TOKEN")
+		if err != nil {
+			return nil, nil, err
+		}
+		apiURL := strings.TrimRight(os.Getenv("ZALO_API_URL"), "/")
+		if apiURL == "" {
+			apiURL = "https://openapi.zalo.me"
+		}
+		return &zaloNotifier{
+			client:      &http.Client{},
+			url:         apiURL + "/v3.0/oa/message/cs",
+			accessToken: env["ZALO_OA_ACCESS_TOKEN"],
+		}, splitList(os.Getenv("ZALO_USER_IDS")), nil
+	})
+}
+
+func (z *zaloNotifier) Name() string { return "zalo" }
+
+func (z *zaloNotifier) Send(ctx context.Context, n Notification) error {
+	var resp struct {
+		Error   int    `json:"error"`
+		Message string `json:"message"`
+	}
+	err := postJSON(ctx, z.client, z.url, map[string]interface{}{
+		"recipient": map[string]string{"user_id": n.To},
+		"message":   map[string]string{"text": n.Text},
+	}, func(req *http.Request) {
+		req.Header.Set("access_token", z.accessToken)
+	}, &resp)
+	if err != nil {
+		return err
+	}
+	// Zalo trả HTTP 200 kèm mã lỗi khác 0 khi thất bại (token hết hạn, người dùng chưa quan tâm OA...)
+	if resp.Error != 0 {
+		return fmt.Errorf("zalo error %d: %s", resp.Error, resp.Message)
+	}
+	return nil
+}
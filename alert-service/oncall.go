@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// OnCallSchedule là lịch trực luân phiên: các người nhận lần lượt trực mỗi ca ShiftHours giờ,
+// bắt đầu từ RotationStart theo thứ tự trong RecipientIDs
+type OnCallSchedule struct {
+	ID            uint          `gorm:"primaryKey" json:"id"`
+	Name          string        `json:"name"`
+	RecipientIDs  pq.Int64Array `gorm:"type:bigint[]" json:"recipient_ids"`
+	RotationStart time.Time     `json:"rotation_start"`
+	ShiftHours    int           `json:"shift_hours"`
+	UpdatedAt     time.Time     `json:"updated_at"`
+}
+
+// validate kiểm tra cấu hình lịch trực
+func (s *OnCallSchedule) validate() error {
+	if s.Name == "" {
+		return errors.New("name is required")
+	}
+	if len(s.RecipientIDs) == 0 {
+		return errors.New("recipient_ids must not be empty")
+	}
+	if s.ShiftHours <= 0 {
+		return errors.New("shift_hours must be positive")
+	}
+	if s.RotationStart.IsZero() {
+		return errors.New("rotation_start is required")
+	}
+	return nil
+}
+
+// onCall trả về người nhận đang trực tại thời điểm at
+func (s *OnCallSchedule) onCall(at time.Time) uint {
+	shift := time.Duration(s.ShiftHours) * time.Hour
+	elapsed := at.Sub(s.RotationStart)
+	slot := int64(elapsed / shift)
+	if elapsed < 0 && elapsed%shift != 0 {
+		// Trước thời điểm bắt đầu thì tính lùi vòng luân phiên
+		slot--
+	}
+	n := int64(len(s.RecipientIDs))
+	idx := slot % n
+	if idx < 0 {
+		idx += n
+	}
+	return uint(s.RecipientIDs[idx])
+}
+
+// getOnCallSchedulesHandler lấy danh sách lịch trực
+func getOnCallSchedulesHandler(c *gin.Context) {
+	var schedules []OnCallSchedule
+	if err := db.Order("id").Find(&schedules).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error fetching on-call schedules", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, schedules)
+}
+
+// getCurrentOnCallHandler cho biết ai đang trực theo lịch, có thể truyền ?at=RFC3339 để xem thời điểm khác
+func getCurrentOnCallHandler(c *gin.Context) {
+	var schedule OnCallSchedule
+	if err := db.First(&schedule, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Schedule not found"})
+		return
+	}
+
+	at := time.Now()
+	if v := c.Query("at"); v != "" {
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid at, expected RFC3339"})
+			return
+		}
+		at = parsed
+	}
+
+	var recipient Recipient
+	if err := db.Preload("Contacts").First(&recipient, schedule.onCall(at)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "On-call recipient not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"schedule_id": schedule.ID, "at": at, "recipient": recipient})
+}
+
+// saveOnCallScheduleHandler tạo mới hoặc cập nhật lịch trực
+func saveOnCallScheduleHandler(c *gin.Context) {
+	var schedule OnCallSchedule
+	if err := c.ShouldBindJSON(&schedule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if id := c.Param("id"); id != "" {
+		if _, err := fmt.Sscan(id, &schedule.ID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid schedule id"})
+			return
+		}
+	}
+	if err := schedule.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := db.Save(&schedule).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error saving on-call schedule", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save schedule"})
+		return
+	}
+	c.JSON(http.StatusOK, schedule)
+}
+
+// deleteOnCallScheduleHandler xóa lịch trực. Lịch còn được bước leo thang dùng thì không xóa được,
+// vì bước đó sẽ không còn báo cho người trực nào.
+func deleteOnCallScheduleHandler(c *gin.Context) {
+	var policies []string
+	steps := db.Model(&EscalationStep{}).Select("policy_id").Where("schedule_id = ?", c.Param("id"))
+	if err := db.Model(&EscalationPolicy{}).Where("id IN (?)", steps).Order("id").Pluck("name", &policies).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error checking escalation steps of schedule", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if len(policies) > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Schedule is still used by escalation policies", "escalation_policies": policies})
+		return
+	}
+	if err := db.Delete(&OnCallSchedule{}, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete schedule"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Schedule deleted successfully"})
+}
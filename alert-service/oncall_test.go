@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+func TestOnCall(t *testing.T) {
+	start := time.Date(2026, 10, 5, 8, 0, 0, 0, time.UTC)
+	schedule := OnCallSchedule{RecipientIDs: pq.Int64Array{11, 22, 33}, RotationStart: start, ShiftHours: 12}
+
+	tests := []struct {
+		name string
+		at   time.Time
+		want uint
+	}{
+		{"rotation start", start, 11},
+		{"end of first shift", start.Add(12*time.Hour - time.Nanosecond), 11},
+		{"second shift", start.Add(12 * time.Hour), 22},
+		{"third shift", start.Add(30 * time.Hour), 33},
+		{"wraps around", start.Add(36 * time.Hour), 11},
+		{"many rotations later", start.Add(10 * 36 * time.Hour).Add(13 * time.Hour), 22},
+		// Trước thời điểm bắt đầu thì vòng luân phiên chạy lùi
+		{"just before start", start.Add(-time.Nanosecond), 33},
+		{"one shift before start", start.Add(-12 * time.Hour), 33},
+		{"two shifts before start", start.Add(-13 * time.Hour), 22},
+		{"other timezone", start.In(time.FixedZone("ICT", 7*3600)).Add(12 * time.Hour), 22},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := schedule.onCall(tt.at); got != tt.want {
+				t.Errorf("onCall(%v) = %d, want %d", tt.at, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOnCallScheduleValidate(t *testing.T) {
+	valid := OnCallSchedule{Name: "Bảo vệ", RecipientIDs: pq.Int64Array{1}, RotationStart: time.Now(), ShiftHours: 8}
+	tests := []struct {
+		name    string
+		modify  func(s *OnCallSchedule)
+		wantErr bool
+	}{
+		{"valid", func(s *OnCallSchedule) {}, false},
+		{"no name", func(s *OnCallSchedule) { s.Name = "" }, true},
+		{"no recipients", func(s *OnCallSchedule) { s.RecipientIDs = nil }, true},
+		{"zero shift", func(s *OnCallSchedule) { s.ShiftHours = 0 }, true},
+		{"no rotation start", func(s *OnCallSchedule) { s.RotationStart = time.Time{} }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := valid
+			tt.modify(&s)
+			if err := s.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
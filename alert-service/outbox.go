@@ -0,0 +1,385 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Các trạng thái của một lần gửi thông báo trong outbox
+const (
+	DeliveryPending   = "pending"
+	DeliverySending   = "sending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+const (
+	// outboxPollInterval là chu kỳ quét outbox khi không có thông báo mới
+	outboxPollInterval = 2 * time.Second
+	// outboxLease là thời gian giữ một bản ghi đang gửi; quá hạn (worker chết) thì worker khác nhận lại
+	outboxLease = 2 * time.Minute
+	// outboxBaseBackoff và outboxMaxBackoff giới hạn thời gian chờ giữa các lần thử lại
+	outboxBaseBackoff = 5 * time.Second
+	outboxMaxBackoff  = time.Hour
+)
+
+// NotificationDelivery là một lần gửi thông báo của cảnh báo tới một người nhận qua một kênh
+type NotificationDelivery struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	AlertID     uint   `gorm:"index" json:"alert_id"`
+	RecipientID *uint  `json:"recipient_id"` // Người nhận trong danh bạ, nil nếu là người nhận mặc định
+	Channel     string `json:"channel"`
+	// LogicalChannel là kênh theo định tuyến ("sms" với chuỗi nhà cung cấp), không đổi khi failover
+	LogicalChannel string     `json:"logical_channel"`
+	Recipient      string     `json:"recipient"`
+	Status         string     `gorm:"index:idx_delivery_due" json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  time.Time  `gorm:"index:idx_delivery_due" json:"next_attempt_at"`
+	LastError      string     `json:"last_error,omitempty"`
+	DeliveredAt    *time.Time `json:"delivered_at"`
+	SummaryCount   int        `json:"summary_count,omitempty"` // Khác 0 nếu là thông báo tổng hợp các lần gửi bị gộp
+	// Providers là chuỗi nhà cung cấp SMS dự phòng; gửi lỗi thì Channel chuyển sang nhà cung cấp kế tiếp
+	Providers pq.StringArray `gorm:"type:text[]" json:"providers,omitempty"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
+
+// DeadLetter là lần gửi đã thất bại hết số lần thử, chờ xử lý thủ công
+type DeadLetter struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	DeliveryID uint      `gorm:"uniqueIndex" json:"delivery_id"`
+	AlertID    uint      `gorm:"index" json:"alert_id"`
+	Channel    string    `json:"channel"`
+	Recipient  string    `json:"recipient"`
+	Attempts   int       `json:"attempts"`
+	LastError  string    `json:"last_error"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// outboxWake đánh thức worker ngay khi có thông báo mới thay vì chờ chu kỳ quét
+var outboxWake = make(chan struct{}, 1)
+
+// envInt đọc biến môi trường kiểu số nguyên dương, dùng giá trị mặc định nếu không hợp lệ
+func envInt(key string, def int) int {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil && v > 0 {
+		return v
+	}
+	return def
+}
+
+// outboxMaxAttempts là số lần thử tối đa trước khi chuyển vào dead-letter
+var outboxMaxAttempts = envInt("OUTBOX_MAX_ATTEMPTS", 8)
+
+// enqueueDeliveries tạo một bản ghi gửi cho mỗi kênh và người nhận được định tuyến,
+// trong cùng giao dịch với cảnh báo
+func enqueueDeliveries(tx *gorm.DB, alert Alert) ([]NotificationDelivery, error) {
+	targets, err := resolveTargets(tx, alert)
+	if err != nil {
+		return nil, err
+	}
+
+	return createDeliveries(tx, alert.ID, targets)
+}
+
+// createDeliveries xếp hàng một lần gửi cho mỗi địa chỉ nhận của cảnh báo.
+// Địa chỉ đã vượt giới hạn thông báo thì lần gửi được gộp vào thông báo tổng hợp sau.
+func createDeliveries(tx *gorm.DB, alertID uint, targets []deliveryTarget) ([]NotificationDelivery, error) {
+	now := time.Now()
+	deliveries := make([]NotificationDelivery, 0, len(targets))
+	for _, target := range targets {
+		status := DeliveryPending
+		limited, err := rateLimited(tx, target)
+		if err != nil {
+			return nil, err
+		}
+		if limited {
+			status = DeliveryRolledUp
+			notificationDeliveries.WithLabelValues(target.Channel, DeliveryRolledUp).Inc()
+		}
+		deliveries = append(deliveries, NotificationDelivery{
+			AlertID:        alertID,
+			RecipientID:    target.RecipientID,
+			Channel:        target.Channel,
+			LogicalChannel: target.logicalChannel(),
+			Recipient:      target.Address,
+			Status:         status,
+			NextAttemptAt:  now,
+			Providers:      target.Providers,
+		})
+	}
+	if len(deliveries) == 0 {
+		return deliveries, nil
+	}
+	if err := tx.Create(&deliveries).Error; err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// wakeOutbox báo cho worker có thông báo mới cần gửi
+func wakeOutbox() {
+	select {
+	case outboxWake <- struct{}{}:
+	default:
+	}
+}
+
+// startOutboxWorkers khởi chạy n worker gửi thông báo từ outbox
+func startOutboxWorkers(n int) {
+	for i := 0; i < n; i++ {
+		app.Go(runOutboxWorker)
+	}
+	slog.Info("Started outbox workers", "count", n)
+}
+
+// runOutboxWorker liên tục nhận và gửi các thông báo đến hạn.
+// Khi dịch vụ tắt, worker gửi nốt các thông báo đến hạn rồi thoát; thông báo đang chờ thử lại vẫn nằm trong outbox.
+func runOutboxWorker() {
+	for !app.DrainExpired() {
+		delivery, ok, err := claimDelivery()
+		if err != nil {
+			slog.Error("Error claiming delivery", "error", err)
+		}
+		if !ok {
+			if app.IsStopping() {
+				return
+			}
+			select {
+			case <-outboxWake:
+			case <-time.After(outboxPollInterval):
+			case <-app.Stopping():
+			}
+			continue
+		}
+		processDelivery(delivery)
+	}
+}
+
+// claimDelivery nhận một bản ghi đến hạn bằng SELECT ... FOR UPDATE SKIP LOCKED
+// để nhiều worker (và nhiều bản sao dịch vụ) không gửi trùng
+func claimDelivery() (NotificationDelivery, bool, error) {
+	var delivery NotificationDelivery
+	found := false
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := dueDeliveries(tx, time.Now()).Limit(1).Find(&delivery)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		found = true
+		return tx.Model(&delivery).Updates(map[string]interface{}{
+			"status":          DeliverySending,
+			"next_attempt_at": time.Now().Add(outboxLease),
+		}).Error
+	})
+	return delivery, found, err
+}
+
+// dueDeliveries chọn các lần gửi đến hạn, gồm cả lần đang gửi đã quá outboxLease (worker chết giữa chừng),
+// khóa các dòng được chọn và bỏ qua dòng worker khác đang giữ
+func dueDeliveries(tx *gorm.DB, now time.Time) *gorm.DB {
+	return tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("status IN ? AND next_attempt_at <= ?", []string{DeliveryPending, DeliverySending}, now).
+		Order("next_attempt_at")
+}
+
+// processDelivery gửi thông báo và cập nhật kết quả: thành công, hẹn thử lại hoặc chuyển dead-letter
+func processDelivery(delivery NotificationDelivery) {
+	ctx, span := tracer.Start(context.Background(), "notification.send", trace.WithAttributes(
+		attribute.Int64("alert.id", int64(delivery.AlertID)),
+		attribute.String("notification.channel", delivery.Channel),
+		attribute.Int("attempt", delivery.Attempts+1),
+	))
+	defer span.End()
+
+	start := time.Now()
+	err := sendDelivery(ctx, delivery)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	notificationSendDuration.WithLabelValues(delivery.Channel).Observe(time.Since(start).Seconds())
+	delivery.Attempts++
+
+	if err == nil {
+		notificationDeliveries.WithLabelValues(delivery.Channel, DeliveryDelivered).Inc()
+		now := time.Now()
+		if err := db.Model(&delivery).Updates(map[string]interface{}{
+			"status":       DeliveryDelivered,
+			"attempts":     delivery.Attempts,
+			"delivered_at": now,
+			"last_error":   "",
+		}).Error; err != nil {
+			slog.ErrorContext(ctx, "Error marking delivery delivered", "delivery_id", delivery.ID, "error", err)
+		}
+		return
+	}
+
+	slog.WarnContext(ctx, "Delivery failed", "delivery_id", delivery.ID, "channel", delivery.Channel, "recipient", delivery.Recipient,
+		"attempt", delivery.Attempts, "max_attempts", outboxMaxAttempts, "error", err)
+
+	retry := planRetry(delivery, time.Now())
+	if retry.Dead {
+		notificationDeliveries.WithLabelValues(delivery.Channel, DeliveryDead).Inc()
+		if err := moveToDeadLetter(delivery, err); err != nil {
+			slog.ErrorContext(ctx, "Error moving delivery to dead-letter", "delivery_id", delivery.ID, "error", err)
+		}
+		return
+	}
+
+	notificationDeliveries.WithLabelValues(delivery.Channel, "retry").Inc()
+	if retry.Channel != delivery.Channel {
+		slog.InfoContext(ctx, "Delivery failing over to next SMS provider", "delivery_id", delivery.ID, "from", delivery.Channel, "to", retry.Channel)
+		delivery.Channel = retry.Channel
+	}
+
+	if err := db.Model(&delivery).Updates(map[string]interface{}{
+		"status":          DeliveryPending,
+		"channel":         delivery.Channel,
+		"attempts":        delivery.Attempts,
+		"next_attempt_at": retry.At,
+		"last_error":      err.Error(),
+	}).Error; err != nil {
+		slog.ErrorContext(ctx, "Error rescheduling delivery", "delivery_id", delivery.ID, "error", err)
+	}
+}
+
+// sendDelivery tải cảnh báo và gửi qua notifier của kênh
+func sendDelivery(ctx context.Context, delivery NotificationDelivery) error {
+	notifier := findNotifier(delivery.Channel)
+	if notifier == nil {
+		return fmt.Errorf("notifier %q is not enabled", delivery.Channel)
+	}
+
+	var alert Alert
+	if err := db.WithContext(ctx).First(&alert, delivery.AlertID).Error; err != nil {
+		return fmt.Errorf("load alert: %w", err)
+	}
+	n, err := renderNotification(delivery, alert)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, notifySendTimeout)
+	defer cancel()
+	return notifier.Send(ctx, n)
+}
+
+// deliveryRetry là bước tiếp theo sau một lần gửi lỗi: gửi lại qua Channel lúc At, hoặc chuyển dead-letter
+type deliveryRetry struct {
+	Dead    bool
+	Channel string
+	At      time.Time
+}
+
+// planRetry quyết định bước tiếp theo sau một lần gửi lỗi, delivery.Attempts đã gồm lần vừa thử.
+// Còn nhà cung cấp SMS dự phòng chưa thử thì chuyển sang ngay, đã thử hết cả chuỗi mới chờ backoff.
+func planRetry(delivery NotificationDelivery, now time.Time) deliveryRetry {
+	if delivery.Attempts >= outboxMaxAttempts {
+		return deliveryRetry{Dead: true, Channel: delivery.Channel}
+	}
+	retry := deliveryRetry{Channel: delivery.Channel, At: now.Add(retryBackoff(delivery.Attempts))}
+	if len(delivery.Providers) > 1 {
+		next, wrapped := nextProvider(delivery.Providers, delivery.Channel)
+		retry.Channel = next
+		if !wrapped {
+			retry.At = now
+		}
+	}
+	return retry
+}
+
+// retryBackoff tính thời gian chờ theo lũy thừa 2, có jitter ±20% để tránh dồn tải
+func retryBackoff(attempts int) time.Duration {
+	backoff := outboxBaseBackoff << (attempts - 1)
+	if backoff <= 0 || backoff > outboxMaxBackoff {
+		backoff = outboxMaxBackoff
+	}
+	jitter := time.Duration(rand.Int63n(int64(backoff)/5*2+1)) - backoff/5
+	return backoff + jitter
+}
+
+// moveToDeadLetter đánh dấu lần gửi đã chết và lưu vào bảng dead-letter
+func moveToDeadLetter(delivery NotificationDelivery, sendErr error) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&delivery).Updates(map[string]interface{}{
+			"status":     DeliveryDead,
+			"attempts":   delivery.Attempts,
+			"last_error": sendErr.Error(),
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&DeadLetter{
+			DeliveryID: delivery.ID,
+			AlertID:    delivery.AlertID,
+			Channel:    delivery.Channel,
+			Recipient:  delivery.Recipient,
+			Attempts:   delivery.Attempts,
+			LastError:  sendErr.Error(),
+		}).Error
+	})
+}
+
+// getAlertDeliveriesHandler trả về trạng thái gửi thông báo của một cảnh báo
+func getAlertDeliveriesHandler(c *gin.Context) {
+	var deliveries []NotificationDelivery
+	if err := db.Where("alert_id = ?", c.Param("id")).Order("id").Find(&deliveries).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error fetching deliveries", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, deliveries)
+}
+
+// getDeadLettersHandler liệt kê các lần gửi đã thất bại hoàn toàn
+func getDeadLettersHandler(c *gin.Context) {
+	var letters []DeadLetter
+	if err := db.Order("id DESC").Find(&letters).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error fetching dead letters", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, letters)
+}
+
+// retryDeadLetterHandler đưa một dead-letter trở lại outbox để gửi lại từ đầu
+func retryDeadLetterHandler(c *gin.Context) {
+	var letter DeadLetter
+	if err := db.First(&letter, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Dead letter not found"})
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&NotificationDelivery{}).Where("id = ?", letter.DeliveryID).Updates(map[string]interface{}{
+			"status":          DeliveryPending,
+			"attempts":        0,
+			"next_attempt_at": time.Now(),
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&letter).Error
+	})
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error retrying dead letter", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retry delivery"})
+		return
+	}
+
+	wakeOutbox()
+	c.JSON(http.StatusOK, gin.H{"message": "Delivery requeued", "delivery_id": letter.DeliveryID})
+}
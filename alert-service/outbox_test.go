@@ -0,0 +1,83 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// dryRunDB trả về gorm với dialect Postgres chỉ dựng câu SQL, không kết nối database
+func dryRunDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	conn, err := gorm.Open(postgres.Open("host=127.0.0.1 port=1 sslmode=disable"),
+		&gorm.Config{DryRun: true, DisableAutomaticPing: true, Logger: dbLogger()})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	return conn
+}
+
+func TestDueDeliveriesQuery(t *testing.T) {
+	now := time.Now()
+	var delivery NotificationDelivery
+	stmt := dueDeliveries(dryRunDB(t), now).Limit(1).Find(&delivery).Statement
+
+	sql := stmt.SQL.String()
+	for _, want := range []string{
+		`status IN ($1,$2) AND next_attempt_at <= $3`,
+		`ORDER BY next_attempt_at`,
+		`FOR UPDATE SKIP LOCKED`,
+	} {
+		if !strings.Contains(sql, want) {
+			t.Errorf("claim query %q does not contain %q", sql, want)
+		}
+	}
+	// Lần gửi đang "sending" quá hạn lease cũng được nhận lại
+	if len(stmt.Vars) < 3 || stmt.Vars[0] != DeliveryPending || stmt.Vars[1] != DeliverySending || stmt.Vars[2] != now {
+		t.Errorf("claim query vars = %v", stmt.Vars)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		base     time.Duration
+	}{
+		{1, outboxBaseBackoff},
+		{2, 2 * outboxBaseBackoff},
+		{5, 16 * outboxBaseBackoff},
+		{10, 512 * outboxBaseBackoff},
+		{11, outboxMaxBackoff}, // 5s << 10 vượt một giờ
+		{80, outboxMaxBackoff}, // Dịch bit tràn số
+	}
+	for _, tt := range tests {
+		for i := 0; i < 50; i++ {
+			got := retryBackoff(tt.attempts)
+			if got < tt.base-tt.base/5 || got > tt.base+tt.base/5 {
+				t.Fatalf("retryBackoff(%d) = %v, want %v ±20%%", tt.attempts, got, tt.base)
+			}
+		}
+	}
+}
+
+func TestPlanRetry(t *testing.T) {
+	now := time.Now()
+
+	retry := planRetry(NotificationDelivery{Channel: "telegram", Attempts: 1}, now)
+	if retry.Dead || retry.Channel != "telegram" {
+		t.Fatalf("first failure = %+v, want retry on telegram", retry)
+	}
+	if wait := retry.At.Sub(now); wait < outboxBaseBackoff*4/5 || wait > outboxBaseBackoff*6/5 {
+		t.Errorf("first retry after %v, want about %v", wait, outboxBaseBackoff)
+	}
+
+	if retry := planRetry(NotificationDelivery{Channel: "telegram", Attempts: outboxMaxAttempts - 1}, now); retry.Dead {
+		t.Error("delivery dead before outboxMaxAttempts")
+	}
+	if retry := planRetry(NotificationDelivery{Channel: "telegram", Attempts: outboxMaxAttempts}, now); !retry.Dead {
+		t.Error("delivery not dead after outboxMaxAttempts")
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Trạng thái của các lần gửi vượt giới hạn, được gộp vào thông báo tổng hợp
+const (
+	DeliveryRolledUp   = "rolled_up"  // Vượt giới hạn, chờ gộp vào thông báo tổng hợp
+	DeliverySummarized = "summarized" // Đã gộp vào một thông báo tổng hợp
+)
+
+// rollupPollInterval là chu kỳ kiểm tra các thông báo bị gộp để gửi bản tổng hợp
+const rollupPollInterval = time.Minute
+
+var (
+	// notifyRateLimit là số thông báo tối đa gửi tới một địa chỉ trong notifyRateWindow,
+	// người nhận có thể đặt giới hạn riêng qua Recipient.RateLimit
+	notifyRateLimit  = envInt("NOTIFY_RATE_LIMIT", 10)
+	notifyRateWindow = envDuration("NOTIFY_RATE_WINDOW", 10*time.Minute)
+)
+
+// envDuration đọc biến môi trường kiểu thời lượng (ví dụ "10m"), dùng giá trị mặc định nếu không hợp lệ
+func envDuration(key string, def time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(key)); err == nil && d > 0 {
+		return d
+	}
+	return def
+}
+
+// rateLimited kiểm tra địa chỉ nhận đã đạt giới hạn thông báo trong cửa sổ hiện tại chưa.
+// Đếm theo kênh logic để các lần gửi SMS đã chuyển sang nhà cung cấp khác vẫn tính chung một giới hạn.
+func rateLimited(tx *gorm.DB, target deliveryTarget) (bool, error) {
+	limit := notifyRateLimit
+	if target.RateLimit > 0 {
+		limit = target.RateLimit
+	}
+
+	var count int64
+	err := tx.Model(&NotificationDelivery{}).
+		Where("logical_channel = ? AND recipient = ? AND created_at > ? AND status NOT IN ?",
+			target.logicalChannel(), target.Address, time.Now().Add(-notifyRateWindow),
+			[]string{DeliveryRolledUp, DeliverySummarized}).
+		Count(&count).Error
+	return count >= int64(limit), err
+}
+
+// rollupGroup là các thông báo bị gộp của một địa chỉ nhận
+type rollupGroup struct {
+	LogicalChannel string
+	Recipient      string
+	RecipientID    *uint
+}
+
+// runRollups định kỳ gửi thông báo tổng hợp cho các địa chỉ có thông báo bị gộp
+func runRollups() {
+	for {
+		select {
+		case <-time.After(rollupPollInterval):
+		case <-app.Stopping():
+			return
+		}
+		if err := summarizeRollups(); err != nil {
+			slog.Error("Error summarizing rolled-up notifications", "error", err)
+		}
+	}
+}
+
+// summarizeRollups gộp các thông báo bị giới hạn đã chờ đủ một cửa sổ thành một thông báo tổng hợp
+// cho mỗi địa chỉ nhận. Bản tổng hợp dùng cảnh báo mới nhất làm nội dung chính và giữ kênh cùng
+// chuỗi nhà cung cấp SMS dự phòng của lần gửi mới nhất.
+func summarizeRollups() error {
+	var groups []rollupGroup
+	if err := db.Model(&NotificationDelivery{}).
+		Select("logical_channel, recipient, max(recipient_id) AS recipient_id").
+		Where("status = ?", DeliveryRolledUp).
+		Group("logical_channel, recipient").
+		Having("min(created_at) <= ?", time.Now().Add(-notifyRateWindow)).
+		Scan(&groups).Error; err != nil {
+		return err
+	}
+
+	created := false
+	for _, g := range groups {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var rolled []NotificationDelivery
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+				Where("status = ? AND logical_channel = ? AND recipient = ?", DeliveryRolledUp, g.LogicalChannel, g.Recipient).
+				Order("alert_id").
+				Find(&rolled).Error; err != nil || len(rolled) == 0 {
+				return err
+			}
+
+			ids := make([]uint, len(rolled))
+			for i, d := range rolled {
+				ids[i] = d.ID
+			}
+			if err := tx.Model(&NotificationDelivery{}).Where("id IN ?", ids).Update("status", DeliverySummarized).Error; err != nil {
+				return err
+			}
+
+			created = true
+			latest := rolled[len(rolled)-1]
+			return tx.Create(&NotificationDelivery{
+				AlertID:        latest.AlertID,
+				RecipientID:    g.RecipientID,
+				Channel:        latest.Channel,
+				LogicalChannel: g.LogicalChannel,
+				Recipient:      g.Recipient,
+				Status:         DeliveryPending,
+				NextAttemptAt:  time.Now(),
+				SummaryCount:   len(rolled),
+				Providers:      latest.Providers,
+			}).Error
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if created {
+		wakeOutbox()
+	}
+	return nil
+}
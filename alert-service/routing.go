@@ -0,0 +1,509 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+
+	"isafe/shared/domain"
+)
+
+// Mức độ nghiêm trọng của cảnh báo, theo thứ tự tăng dần
+const (
+	SeverityLow      = domain.SeverityLow
+	SeverityMedium   = domain.SeverityMedium
+	SeverityHigh     = domain.SeverityHigh
+	SeverityCritical = domain.SeverityCritical
+)
+
+var severityRank = domain.SeverityRank
+
+// defaultSeverity suy ra mức độ nghiêm trọng từ loại cảnh báo khi bên gửi không chỉ định
+func defaultSeverity(status string) string {
+	switch status {
+	case domain.AlertStatusUnrecognized, domain.AlertStatusVisitorZoneViolation:
+		return SeverityHigh
+	}
+	return SeverityMedium
+}
+
+// Recipient là người nhận cảnh báo cùng các địa chỉ liên lạc theo kênh
+type Recipient struct {
+	ID        uint   `gorm:"primaryKey" json:"id"`
+	Name      string `json:"name"`
+	Language  string `json:"language"` // Ngôn ngữ ưu tiên: vi hoặc en
+	Disabled  bool   `json:"disabled"`
+	RateLimit int    `json:"rate_limit"` // Số thông báo tối đa mỗi cửa sổ giới hạn, 0 là mặc định
+	// SMSProviders là thứ tự nhà cung cấp SMS cho liên lạc kênh "sms" (ví dụ speedsms, esms, twilio),
+	// gửi lỗi thì chuyển sang nhà cung cấp kế tiếp; trống là theo SMS_PROVIDERS
+	SMSProviders pq.StringArray     `gorm:"type:text[]" json:"sms_providers"`
+	Contacts     []RecipientContact `json:"contacts"`
+	UpdatedAt    time.Time          `json:"updated_at"`
+}
+
+// RecipientContact là địa chỉ của người nhận trên một kênh (số điện thoại, email, URL...)
+type RecipientContact struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	RecipientID uint   `gorm:"index" json:"recipient_id"`
+	Channel     string `json:"channel"` // Tên notifier (twilio, smtp, zalo...) hoặc "sms" để tự chọn nhà cung cấp SMS
+	Address     string `json:"address"`
+}
+
+// RoutingRule chọn người nhận cho cảnh báo theo loại, mức độ, khu vực và khung giờ.
+// Điều kiện để trống nghĩa là không giới hạn.
+type RoutingRule struct {
+	ID           uint           `gorm:"primaryKey" json:"id"`
+	Name         string         `json:"name"`
+	Statuses     pq.StringArray `gorm:"type:text[]" json:"statuses"`
+	MinSeverity  string         `json:"min_severity"`
+	Zones        pq.StringArray `gorm:"type:text[]" json:"zones"`
+	StartTime    string         `json:"start_time"` // "HH:MM", cho phép khung giờ qua nửa đêm
+	EndTime      string         `json:"end_time"`
+	RecipientIDs pq.Int64Array  `gorm:"type:bigint[]" json:"recipient_ids"`
+	Channels     pq.StringArray `gorm:"type:text[]" json:"channels"` // Chỉ gửi qua các kênh này, trống là mọi kênh
+	Disabled     bool           `json:"disabled"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+}
+
+// deliveryTarget là một địa chỉ cần gửi thông báo qua một kênh
+type deliveryTarget struct {
+	Channel     string
+	Address     string
+	RecipientID *uint
+	RateLimit   int      // Giới hạn riêng của người nhận, 0 là mặc định
+	Providers   []string // Chuỗi nhà cung cấp SMS dự phòng, Channel là nhà cung cấp đầu tiên
+}
+
+// logicalChannel là kênh không phụ thuộc nhà cung cấp: "sms" nếu có chuỗi dự phòng, còn lại là Channel
+func (t deliveryTarget) logicalChannel() string {
+	if len(t.Providers) > 0 {
+		return smsChannel
+	}
+	return t.Channel
+}
+
+// routingLocation là múi giờ dùng để so khung giờ của quy tắc định tuyến
+var routingLocation = loadRoutingLocation()
+
+func loadRoutingLocation() *time.Location {
+	name := os.Getenv("ROUTING_TIMEZONE")
+	if name == "" {
+		name = "Asia/Ho_Chi_Minh"
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		slog.Warn("Unknown routing timezone, using local time", "timezone", name, "error", err)
+		return time.Local
+	}
+	return loc
+}
+
+// parseClockMinutes chuyển chuỗi "HH:MM" thành số phút kể từ 00:00
+func parseClockMinutes(clock string) (int, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// validate kiểm tra thông tin người nhận
+func (r *Recipient) validate() error {
+	if r.Name == "" {
+		return errors.New("name is required")
+	}
+	if r.Language == "" {
+		r.Language = "vi"
+	}
+	if r.Language != "vi" && r.Language != "en" {
+		return errors.New("language must be vi or en")
+	}
+	for _, name := range r.SMSProviders {
+		if !isSMSProvider(name) {
+			return fmt.Errorf("unknown SMS provider %q", name)
+		}
+	}
+	for _, contact := range r.Contacts {
+		if _, ok := notifierFactories[contact.Channel]; !ok && contact.Channel != smsChannel {
+			return fmt.Errorf("unknown channel %q", contact.Channel)
+		}
+		if contact.Address == "" {
+			return fmt.Errorf("address is required for channel %q", contact.Channel)
+		}
+	}
+	return nil
+}
+
+// validate kiểm tra cấu hình quy tắc định tuyến
+func (r *RoutingRule) validate() error {
+	if r.Name == "" {
+		return errors.New("name is required")
+	}
+	if len(r.RecipientIDs) == 0 {
+		return errors.New("recipient_ids must not be empty")
+	}
+	if _, ok := severityRank[r.MinSeverity]; r.MinSeverity != "" && !ok {
+		return errors.New("invalid min_severity")
+	}
+	if (r.StartTime == "") != (r.EndTime == "") {
+		return errors.New("start_time and end_time must be set together")
+	}
+	if r.StartTime != "" {
+		if _, err := parseClockMinutes(r.StartTime); err != nil {
+			return errors.New("invalid start_time")
+		}
+		if _, err := parseClockMinutes(r.EndTime); err != nil {
+			return errors.New("invalid end_time")
+		}
+	}
+	for _, ch := range r.Channels {
+		if _, ok := notifierFactories[ch]; !ok && ch != smsChannel {
+			return fmt.Errorf("unknown channel %q", ch)
+		}
+	}
+	return nil
+}
+
+// matches kiểm tra cảnh báo có thỏa mọi điều kiện của quy tắc hay không
+func (r *RoutingRule) matches(alert Alert) bool {
+	if len(r.Statuses) > 0 && !containsString(r.Statuses, alert.Status) {
+		return false
+	}
+	if r.MinSeverity != "" && severityRank[alert.Severity] < severityRank[r.MinSeverity] {
+		return false
+	}
+	if len(r.Zones) > 0 && !containsString(r.Zones, alert.Zone) {
+		return false
+	}
+	if r.StartTime != "" {
+		start, _ := parseClockMinutes(r.StartTime)
+		end, _ := parseClockMinutes(r.EndTime)
+		t := alert.Timestamp.In(routingLocation)
+		now := t.Hour()*60 + t.Minute()
+		if start <= end {
+			if now < start || now >= end {
+				return false
+			}
+		} else if now < start && now >= end {
+			// Khung giờ qua nửa đêm, ví dụ 22:00-06:00
+			return false
+		}
+	}
+	return true
+}
+
+// containsString kiểm tra s có nằm trong danh sách list hay không
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveTargets chọn địa chỉ nhận thông báo cho cảnh báo theo các quy tắc định tuyến.
+// Không quy tắc nào khớp (hoặc không ai liên lạc được) thì dùng người nhận mặc định từ biến môi trường.
+func resolveTargets(tx *gorm.DB, alert Alert) ([]deliveryTarget, error) {
+	var rules []RoutingRule
+	if err := tx.Where("disabled = ?", false).Order("id").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+
+	allowed := channelAllowance{}
+	for _, rule := range rules {
+		if rule.matches(alert) {
+			allowed.add(rule.RecipientIDs, rule.Channels)
+		}
+	}
+	if len(allowed) == 0 {
+		return defaultTargets(), nil
+	}
+
+	targets, err := recipientTargets(tx, allowed)
+	if err != nil {
+		return nil, err
+	}
+	if len(targets) == 0 {
+		slog.Warn("Routing rules matched but no recipient is reachable, using default recipients", "alert_id", alert.ID)
+		return defaultTargets(), nil
+	}
+	return targets, nil
+}
+
+// channelAllowance là các kênh được phép theo từng người nhận; nil là mọi kênh
+type channelAllowance map[uint]map[string]bool
+
+// add cho phép gửi tới các người nhận ids qua channels (trống là mọi kênh)
+func (a channelAllowance) add(ids []int64, channels []string) {
+	for _, id := range ids {
+		rid := uint(id)
+		if len(channels) == 0 {
+			a[rid] = nil
+			continue
+		}
+		set, seen := a[rid]
+		if seen && set == nil {
+			continue
+		}
+		if set == nil {
+			set = map[string]bool{}
+			a[rid] = set
+		}
+		for _, ch := range channels {
+			set[ch] = true
+		}
+	}
+}
+
+// recipientTargets tra địa chỉ liên lạc của các người nhận còn hoạt động trên các kênh đang bật
+func recipientTargets(tx *gorm.DB, allowed channelAllowance) ([]deliveryTarget, error) {
+	ids := make([]uint, 0, len(allowed))
+	for id := range allowed {
+		ids = append(ids, id)
+	}
+	var recipients []Recipient
+	if err := tx.Preload("Contacts").Where("id IN ? AND disabled = ?", ids, false).Order("id").Find(&recipients).Error; err != nil {
+		return nil, err
+	}
+
+	var targets []deliveryTarget
+	seen := map[string]bool{}
+	for _, r := range recipients {
+		set := allowed[r.ID]
+		for _, contact := range r.Contacts {
+			target := deliveryTarget{Channel: contact.Channel, Address: contact.Address, RateLimit: r.RateLimit}
+			if contact.Channel == smsChannel {
+				// Quy tắc chỉ cho phép một vài nhà cung cấp cụ thể thì chỉ dùng các nhà cung cấp đó
+				var chain []string
+				for _, name := range smsChain(r.SMSProviders) {
+					if set == nil || set[smsChannel] || set[name] {
+						chain = append(chain, name)
+					}
+				}
+				if len(chain) == 0 {
+					continue
+				}
+				target.Channel, target.Providers = chain[0], chain
+			} else {
+				if findNotifier(contact.Channel) == nil {
+					continue
+				}
+				if set != nil && !set[contact.Channel] {
+					continue
+				}
+			}
+
+			key := contact.Channel + "\x00" + contact.Address
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			recipientID := r.ID
+			target.RecipientID = &recipientID
+			targets = append(targets, target)
+		}
+	}
+	return targets, nil
+}
+
+// defaultTargets là người nhận mặc định của các kênh đang bật, cấu hình qua biến môi trường
+// Các nhà cung cấp SMS dùng chung RECIPIENT_PHONE_NUMBER nên mỗi số chỉ nhận một tin, theo chuỗi dự phòng SMS_PROVIDERS.
+func defaultTargets() []deliveryTarget {
+	var targets []deliveryTarget
+	smsPhones := map[string]bool{}
+	chain := smsChain(nil)
+	for _, ch := range channels {
+		for _, to := range ch.recipients {
+			// SMS_PROVIDERS không liệt kê nhà cung cấp đang bật này thì gửi riêng như kênh thường
+			if !isSMSProvider(ch.notifier.Name()) || !containsString(chain, ch.notifier.Name()) {
+				targets = append(targets, deliveryTarget{Channel: ch.notifier.Name(), Address: to})
+				continue
+			}
+			if smsPhones[to] {
+				continue
+			}
+			smsPhones[to] = true
+			targets = append(targets, deliveryTarget{Channel: chain[0], Address: to, Providers: chain})
+		}
+	}
+	return targets
+}
+
+// getRecipientsHandler lấy danh sách người nhận cùng địa chỉ liên lạc
+func getRecipientsHandler(c *gin.Context) {
+	var recipients []Recipient
+	if err := db.Preload("Contacts").Order("id").Find(&recipients).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error fetching recipients", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, recipients)
+}
+
+// saveRecipientHandler tạo mới hoặc cập nhật người nhận, thay toàn bộ danh sách liên lạc
+func saveRecipientHandler(c *gin.Context) {
+	var recipient Recipient
+	if err := c.ShouldBindJSON(&recipient); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if id := c.Param("id"); id != "" {
+		if _, err := fmt.Sscan(id, &recipient.ID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recipient id"})
+			return
+		}
+	}
+	if err := recipient.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Contacts").Save(&recipient).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("recipient_id = ?", recipient.ID).Delete(&RecipientContact{}).Error; err != nil {
+			return err
+		}
+		for i := range recipient.Contacts {
+			recipient.Contacts[i].ID = 0
+			recipient.Contacts[i].RecipientID = recipient.ID
+		}
+		if len(recipient.Contacts) == 0 {
+			return nil
+		}
+		return tx.Create(&recipient.Contacts).Error
+	})
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error saving recipient", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save recipient"})
+		return
+	}
+	c.JSON(http.StatusOK, recipient)
+}
+
+// deleteRecipientHandler xóa người nhận và gỡ khỏi các quy tắc định tuyến. Người nhận còn nằm trong lịch trực
+// hoặc bước leo thang thì không xóa được, vì gỡ ra có thể khiến ca trực hoặc bước leo thang không báo cho ai.
+func deleteRecipientHandler(c *gin.Context) {
+	var recipient Recipient
+	if err := db.First(&recipient, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Recipient not found"})
+		return
+	}
+
+	var inUse *recipientInUseError
+	err := db.Transaction(func(tx *gorm.DB) error {
+		refs, err := recipientReferences(tx, recipient.ID)
+		if err != nil {
+			return err
+		}
+		if refs != nil {
+			return refs
+		}
+		if err := tx.Model(&RoutingRule{}).
+			Where("? = ANY(recipient_ids)", recipient.ID).
+			Update("recipient_ids", gorm.Expr("array_remove(recipient_ids, ?::bigint)", recipient.ID)).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("recipient_id = ?", recipient.ID).Delete(&RecipientContact{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&recipient).Error
+	})
+	if errors.As(err, &inUse) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":               "Recipient is still used by on-call schedules or escalation policies",
+			"schedules":           inUse.Schedules,
+			"escalation_policies": inUse.Policies,
+		})
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error deleting recipient", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete recipient"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Recipient deleted successfully"})
+}
+
+// recipientInUseError liệt kê các lịch trực và chính sách leo thang còn dùng một người nhận
+type recipientInUseError struct {
+	Schedules []string
+	Policies  []string
+}
+
+func (e *recipientInUseError) Error() string {
+	return fmt.Sprintf("recipient is used by schedules %v and escalation policies %v", e.Schedules, e.Policies)
+}
+
+// recipientReferences trả về các lịch trực và chính sách leo thang còn dùng người nhận, nil nếu không còn
+func recipientReferences(tx *gorm.DB, recipientID uint) (*recipientInUseError, error) {
+	refs := &recipientInUseError{}
+	if err := tx.Model(&OnCallSchedule{}).Where("? = ANY(recipient_ids)", recipientID).
+		Order("id").Pluck("name", &refs.Schedules).Error; err != nil {
+		return nil, err
+	}
+	steps := tx.Model(&EscalationStep{}).Select("policy_id").Where("? = ANY(recipient_ids)", recipientID)
+	if err := tx.Model(&EscalationPolicy{}).Where("id IN (?)", steps).
+		Order("id").Pluck("name", &refs.Policies).Error; err != nil {
+		return nil, err
+	}
+	if len(refs.Schedules) == 0 && len(refs.Policies) == 0 {
+		return nil, nil
+	}
+	return refs, nil
+}
+
+// getRoutingRulesHandler lấy danh sách quy tắc định tuyến
+func getRoutingRulesHandler(c *gin.Context) {
+	var rules []RoutingRule
+	if err := db.Order("id").Find(&rules).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error fetching routing rules", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, rules)
+}
+
+// saveRoutingRuleHandler tạo mới hoặc cập nhật quy tắc định tuyến
+func saveRoutingRuleHandler(c *gin.Context) {
+	var rule RoutingRule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if id := c.Param("id"); id != "" {
+		if _, err := fmt.Sscan(id, &rule.ID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid routing rule id"})
+			return
+		}
+	}
+	if err := rule.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := db.Save(&rule).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error saving routing rule", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save routing rule"})
+		return
+	}
+	c.JSON(http.StatusOK, rule)
+}
+
+// deleteRoutingRuleHandler xóa quy tắc định tuyến
+func deleteRoutingRuleHandler(c *gin.Context) {
+	if err := db.Delete(&RoutingRule{}, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete routing rule"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Routing rule deleted successfully"})
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// stubRoutingLocation đặt múi giờ so khung giờ của quy tắc định tuyến trong thời gian chạy test
+func stubRoutingLocation(t *testing.T, loc *time.Location) {
+	t.Helper()
+	previous := routingLocation
+	routingLocation = loc
+	t.Cleanup(func() { routingLocation = previous })
+}
+
+func TestRoutingRuleMatches(t *testing.T) {
+	ict := time.FixedZone("ICT", 7*3600)
+	stubRoutingLocation(t, ict)
+	at := func(clock string) time.Time {
+		parsed, _ := time.ParseInLocation("15:04", clock, ict)
+		return time.Date(2026, 10, 19, parsed.Hour(), parsed.Minute(), 0, 0, ict)
+	}
+	alert := func(status, severity, zone, clock string) Alert {
+		a := Alert{Status: status, Severity: severity, Zone: zone}
+		a.Timestamp = at(clock)
+		return a
+	}
+
+	office := RoutingRule{StartTime: "08:00", EndTime: "17:30"}
+	night := RoutingRule{StartTime: "22:00", EndTime: "06:00"}
+	tests := []struct {
+		name  string
+		rule  RoutingRule
+		alert Alert
+		want  bool
+	}{
+		{"empty rule matches everything", RoutingRule{}, alert("unrecognized", SeverityLow, "", "03:00"), true},
+		{"status listed", RoutingRule{Statuses: pq.StringArray{"unrecognized"}}, alert("unrecognized", "", "", "12:00"), true},
+		{"status not listed", RoutingRule{Statuses: pq.StringArray{"unrecognized"}}, alert("visitor_zone_violation", "", "", "12:00"), false},
+		{"severity at minimum", RoutingRule{MinSeverity: SeverityHigh}, alert("x", SeverityHigh, "", "12:00"), true},
+		{"severity above minimum", RoutingRule{MinSeverity: SeverityHigh}, alert("x", SeverityCritical, "", "12:00"), true},
+		{"severity below minimum", RoutingRule{MinSeverity: SeverityHigh}, alert("x", SeverityMedium, "", "12:00"), false},
+		{"zone listed", RoutingRule{Zones: pq.StringArray{"lobby", "server-room"}}, alert("x", "", "server-room", "12:00"), true},
+		{"zone not listed", RoutingRule{Zones: pq.StringArray{"lobby"}}, alert("x", "", "", "12:00"), false},
+		{"office hours start inclusive", office, alert("x", "", "", "08:00"), true},
+		{"office hours end exclusive", office, alert("x", "", "", "17:30"), false},
+		{"before office hours", office, alert("x", "", "", "07:59"), false},
+		{"overnight before midnight", night, alert("x", "", "", "23:15"), true},
+		{"overnight after midnight", night, alert("x", "", "", "02:00"), true},
+		{"overnight start inclusive", night, alert("x", "", "", "22:00"), true},
+		{"overnight end exclusive", night, alert("x", "", "", "06:00"), false},
+		{"outside overnight window", night, alert("x", "", "", "12:00"), false},
+		{"window compared in routing timezone", night, Alert{Timestamp: time.Date(2026, 10, 19, 16, 0, 0, 0, time.UTC)}, true}, // 23:00 ICT
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rule.matches(tt.alert); got != tt.want {
+				t.Errorf("matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoutingRuleValidate(t *testing.T) {
+	valid := RoutingRule{Name: "Trực đêm", RecipientIDs: pq.Int64Array{1}}
+	tests := []struct {
+		name    string
+		modify  func(r *RoutingRule)
+		wantErr bool
+	}{
+		{"valid", func(r *RoutingRule) {}, false},
+		{"overnight window", func(r *RoutingRule) { r.StartTime, r.EndTime = "22:00", "06:00" }, false},
+		{"no name", func(r *RoutingRule) { r.Name = "" }, true},
+		{"no recipients", func(r *RoutingRule) { r.RecipientIDs = nil }, true},
+		{"invalid severity", func(r *RoutingRule) { r.MinSeverity = "urgent" }, true},
+		{"start without end", func(r *RoutingRule) { r.StartTime = "22:00" }, true},
+		{"invalid clock", func(r *RoutingRule) { r.StartTime, r.EndTime = "25:00", "06:00" }, true},
+		{"known channel", func(r *RoutingRule) { r.Channels = pq.StringArray{"telegram"} }, false},
+		{"virtual sms channel", func(r *RoutingRule) { r.Channels = pq.StringArray{"sms", "twilio"} }, false},
+		{"unknown channel", func(r *RoutingRule) { r.Channels = pq.StringArray{"pager"} }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := valid
+			tt.modify(&r)
+			if err := r.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestChannelAllowance(t *testing.T) {
+	a := channelAllowance{}
+	a.add([]int64{1, 2}, []string{"telegram"})
+	a.add([]int64{2}, []string{"smtp"})
+	a.add([]int64{3}, nil)
+	a.add([]int64{3}, []string{"smtp"}) // Đã được mọi kênh thì không bị thu hẹp
+	a.add([]int64{1}, nil)              // Quy tắc khác cho mọi kênh thì mở rộng
+
+	want := channelAllowance{
+		1: nil,
+		2: {"telegram": true, "smtp": true},
+		3: nil,
+	}
+	if !reflect.DeepEqual(a, want) {
+		t.Fatalf("allowance = %v, want %v", a, want)
+	}
+}
+
+func TestParseClockMinutes(t *testing.T) {
+	tests := []struct {
+		clock   string
+		want    int
+		wantErr bool
+	}{
+		{"00:00", 0, false},
+		{"06:30", 390, false},
+		{"23:59", 1439, false},
+		{"24:00", 0, true},
+		{"7:00", 420, false}, // time.Parse nhận giờ một chữ số
+		{"07:60", 0, true},
+		{"", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseClockMinutes(tt.clock)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseClockMinutes(%q) = %d, %v; want %d, error %v", tt.clock, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
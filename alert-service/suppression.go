@@ -0,0 +1,214 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+// Silence tắt thông báo cho các cảnh báo khớp trong khoảng thời gian [StartsAt, EndsAt).
+// Điều kiện để trống nghĩa là không giới hạn, nhưng phải có ít nhất một điều kiện.
+type Silence struct {
+	ID        uint           `gorm:"primaryKey" json:"id"`
+	DeviceIDs pq.StringArray `gorm:"type:text[]" json:"device_ids"`
+	Zones     pq.StringArray `gorm:"type:text[]" json:"zones"`
+	Statuses  pq.StringArray `gorm:"type:text[]" json:"statuses"`
+	StartsAt  time.Time      `gorm:"index" json:"starts_at"`
+	EndsAt    time.Time      `gorm:"index" json:"ends_at"`
+	Comment   string         `json:"comment"`
+	CreatedBy string         `json:"created_by"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
+
+// MaintenanceWindow là khoảng thời gian bảo trì của một thiết bị, không gửi thông báo cho cảnh báo từ thiết bị đó
+type MaintenanceWindow struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	DeviceID  string    `gorm:"index" json:"device_id"`
+	StartsAt  time.Time `json:"starts_at"`
+	EndsAt    time.Time `json:"ends_at"`
+	Reason    string    `json:"reason"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// validate kiểm tra cấu hình silence
+func (s *Silence) validate() error {
+	if len(s.DeviceIDs) == 0 && len(s.Zones) == 0 && len(s.Statuses) == 0 {
+		return errors.New("at least one of device_ids, zones or statuses is required")
+	}
+	if s.StartsAt.IsZero() {
+		s.StartsAt = time.Now()
+	}
+	if !s.EndsAt.After(s.StartsAt) {
+		return errors.New("ends_at must be after starts_at")
+	}
+	return nil
+}
+
+// matches kiểm tra cảnh báo có bị silence này che hay không
+func (s *Silence) matches(alert Alert) bool {
+	if len(s.DeviceIDs) > 0 && !containsString(s.DeviceIDs, alert.DeviceID) {
+		return false
+	}
+	if len(s.Zones) > 0 && !containsString(s.Zones, alert.Zone) {
+		return false
+	}
+	if len(s.Statuses) > 0 && !containsString(s.Statuses, alert.Status) {
+		return false
+	}
+	return true
+}
+
+// validate kiểm tra cấu hình khung bảo trì
+func (w *MaintenanceWindow) validate() error {
+	if w.DeviceID == "" {
+		return errors.New("device_id is required")
+	}
+	if w.StartsAt.IsZero() {
+		return errors.New("starts_at is required")
+	}
+	if !w.EndsAt.After(w.StartsAt) {
+		return errors.New("ends_at must be after starts_at")
+	}
+	return nil
+}
+
+// findSuppression trả về lý do không gửi thông báo cho cảnh báo ("silence:<id>" hoặc "maintenance:<id>"),
+// rỗng nếu cảnh báo không bị che
+func findSuppression(tx *gorm.DB, alert Alert, at time.Time) (string, error) {
+	if alert.DeviceID != "" {
+		var window MaintenanceWindow
+		result := tx.Where("device_id = ? AND starts_at <= ? AND ends_at > ?", alert.DeviceID, at, at).Limit(1).Find(&window)
+		if result.Error != nil {
+			return "", result.Error
+		}
+		if result.RowsAffected > 0 {
+			return fmt.Sprintf("maintenance:%d", window.ID), nil
+		}
+	}
+
+	var silences []Silence
+	if err := tx.Where("starts_at <= ? AND ends_at > ?", at, at).Order("id").Find(&silences).Error; err != nil {
+		return "", err
+	}
+	for _, s := range silences {
+		if s.matches(alert) {
+			return fmt.Sprintf("silence:%d", s.ID), nil
+		}
+	}
+	return "", nil
+}
+
+// getSilencesHandler lấy danh sách silence, ?active=true chỉ lấy silence đang có hiệu lực
+func getSilencesHandler(c *gin.Context) {
+	query := db.Order("id DESC")
+	if c.Query("active") == "true" {
+		now := time.Now()
+		query = query.Where("starts_at <= ? AND ends_at > ?", now, now)
+	}
+
+	var silences []Silence
+	if err := query.Find(&silences).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error fetching silences", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, silences)
+}
+
+// saveSilenceHandler tạo mới hoặc cập nhật silence
+func saveSilenceHandler(c *gin.Context) {
+	var silence Silence
+	if err := c.ShouldBindJSON(&silence); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if id := c.Param("id"); id != "" {
+		if _, err := fmt.Sscan(id, &silence.ID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid silence id"})
+			return
+		}
+	}
+	if err := silence.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := db.Save(&silence).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error saving silence", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save silence"})
+		return
+	}
+	c.JSON(http.StatusOK, silence)
+}
+
+// expireSilenceHandler kết thúc silence ngay lập tức, giữ lại bản ghi để tra cứu
+func expireSilenceHandler(c *gin.Context) {
+	result := db.Model(&Silence{}).Where("id = ? AND ends_at > ?", c.Param("id"), time.Now()).Update("ends_at", time.Now())
+	if result.Error != nil {
+		slog.ErrorContext(c.Request.Context(), "Error expiring silence", "error", result.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to expire silence"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Active silence not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Silence expired"})
+}
+
+// getMaintenanceWindowsHandler lấy danh sách khung bảo trì, có thể lọc theo ?device_id=
+func getMaintenanceWindowsHandler(c *gin.Context) {
+	query := db.Order("starts_at DESC")
+	if deviceID := c.Query("device_id"); deviceID != "" {
+		query = query.Where("device_id = ?", deviceID)
+	}
+
+	var windows []MaintenanceWindow
+	if err := query.Find(&windows).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error fetching maintenance windows", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, windows)
+}
+
+// saveMaintenanceWindowHandler tạo mới hoặc cập nhật khung bảo trì của thiết bị
+func saveMaintenanceWindowHandler(c *gin.Context) {
+	var window MaintenanceWindow
+	if err := c.ShouldBindJSON(&window); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if id := c.Param("id"); id != "" {
+		if _, err := fmt.Sscan(id, &window.ID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid maintenance window id"})
+			return
+		}
+	}
+	if err := window.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := db.Save(&window).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error saving maintenance window", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save maintenance window"})
+		return
+	}
+	c.JSON(http.StatusOK, window)
+}
+
+// deleteMaintenanceWindowHandler xóa khung bảo trì
+func deleteMaintenanceWindowHandler(c *gin.Context) {
+	if err := db.Delete(&MaintenanceWindow{}, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete maintenance window"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Maintenance window deleted successfully"})
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+)
+
+// stubQuery thay callback truy vấn của gorm: vẫn dựng câu SQL thật nhưng lấy dữ liệu từ rows thay vì database
+func stubQuery(conn *gorm.DB, rows func(stmt *gorm.Statement) (int64, error)) {
+	conn.Callback().Query().Replace("gorm:query", func(tx *gorm.DB) {
+		callbacks.BuildQuerySQL(tx)
+		n, err := rows(tx.Statement)
+		if err != nil {
+			tx.AddError(err)
+			return
+		}
+		tx.RowsAffected = n
+	})
+}
+
+func TestSilenceMatches(t *testing.T) {
+	alert := Alert{DeviceID: "cam-gate-01", Zone: "main-gate", Status: "unrecognized"}
+	tests := []struct {
+		name    string
+		silence Silence
+		want    bool
+	}{
+		{"device", Silence{DeviceIDs: pq.StringArray{"cam-lobby", "cam-gate-01"}}, true},
+		{"other device", Silence{DeviceIDs: pq.StringArray{"cam-lobby"}}, false},
+		{"zone", Silence{Zones: pq.StringArray{"main-gate"}}, true},
+		{"other zone", Silence{Zones: pq.StringArray{"lobby"}}, false},
+		{"status", Silence{Statuses: pq.StringArray{"unrecognized"}}, true},
+		{"other status", Silence{Statuses: pq.StringArray{"tailgating"}}, false},
+		{"all conditions", Silence{DeviceIDs: pq.StringArray{"cam-gate-01"}, Zones: pq.StringArray{"main-gate"},
+			Statuses: pq.StringArray{"unrecognized"}}, true},
+		{"one condition fails", Silence{Zones: pq.StringArray{"main-gate"}, Statuses: pq.StringArray{"tailgating"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.silence.matches(alert); got != tt.want {
+				t.Errorf("matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSilenceValidate(t *testing.T) {
+	now := time.Now()
+	if err := (&Silence{}).validate(); err == nil {
+		t.Error("silence without conditions is valid")
+	}
+	if err := (&Silence{Zones: pq.StringArray{"lobby"}, StartsAt: now, EndsAt: now}).validate(); err == nil {
+		t.Error("silence ending at its start is valid")
+	}
+
+	s := Silence{Zones: pq.StringArray{"lobby"}, EndsAt: now.Add(time.Hour)}
+	if err := s.validate(); err != nil {
+		t.Fatalf("validate() = %v", err)
+	}
+	if s.StartsAt.IsZero() {
+		t.Error("starts_at not defaulted to now")
+	}
+}
+
+func TestMaintenanceWindowValidate(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		window  MaintenanceWindow
+		wantErr bool
+	}{
+		{"valid", MaintenanceWindow{DeviceID: "cam-1", StartsAt: now, EndsAt: now.Add(time.Hour)}, false},
+		{"no device", MaintenanceWindow{StartsAt: now, EndsAt: now.Add(time.Hour)}, true},
+		{"no start", MaintenanceWindow{DeviceID: "cam-1", EndsAt: now.Add(time.Hour)}, true},
+		{"ends before start", MaintenanceWindow{DeviceID: "cam-1", StartsAt: now, EndsAt: now.Add(-time.Hour)}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.window.validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: validate() = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestFindSuppression(t *testing.T) {
+	at := time.Date(2026, 10, 19, 23, 0, 0, 0, time.UTC)
+	silences := []Silence{
+		{ID: 1, Zones: pq.StringArray{"lobby"}},
+		{ID: 2, Statuses: pq.StringArray{"unrecognized"}},
+	}
+
+	tests := []struct {
+		name    string
+		alert   Alert
+		want    string
+		queries []string
+	}{
+		{"device in maintenance", Alert{DeviceID: "cam-1", Zone: "lobby"}, "maintenance:3", []string{"maintenance_windows"}},
+		{"first matching silence", Alert{DeviceID: "cam-2", Zone: "lobby", Status: "unrecognized"}, "silence:1",
+			[]string{"maintenance_windows", "silences"}},
+		{"status silence", Alert{DeviceID: "cam-2", Zone: "main-gate", Status: "unrecognized"}, "silence:2",
+			[]string{"maintenance_windows", "silences"}},
+		{"no device skips maintenance", Alert{Zone: "main-gate", Status: "tailgating"}, "", []string{"silences"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := dryRunDB(t)
+			var queried []string
+			stubQuery(conn, func(stmt *gorm.Statement) (int64, error) {
+				queried = append(queried, stmt.Table)
+				// Chỉ silence/khung bảo trì đang hiệu lực tại thời điểm cảnh báo được lấy ra
+				active := 0
+				for _, v := range stmt.Vars {
+					if v == at {
+						active++
+					}
+				}
+				if active != 2 {
+					t.Errorf("%s query vars = %v, want active at %v", stmt.Table, stmt.Vars, at)
+				}
+				switch dest := stmt.Dest.(type) {
+				case *MaintenanceWindow:
+					if stmt.Vars[0] == "cam-1" {
+						*dest = MaintenanceWindow{ID: 3, DeviceID: "cam-1"}
+						return 1, nil
+					}
+					return 0, nil
+				case *[]Silence:
+					*dest = silences
+					return int64(len(silences)), nil
+				}
+				t.Fatalf("unexpected query into %T", stmt.Dest)
+				return 0, nil
+			})
+
+			got, err := findSuppression(conn, tt.alert, at)
+			if err != nil {
+				t.Fatalf("findSuppression() = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("findSuppression() = %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(queried, tt.queries) {
+				t.Errorf("queried %v, want %v", queried, tt.queries)
+			}
+		})
+	}
+
+	conn := dryRunDB(t)
+	stubQuery(conn, func(stmt *gorm.Statement) (int64, error) { return 0, errors.New("connection reset") })
+	if _, err := findSuppression(conn, Alert{DeviceID: "cam-1"}, at); err == nil {
+		t.Error("findSuppression() ignored a database error")
+	}
+}
@@ -0,0 +1,407 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// defaultChannelTemplate là tên kênh của mẫu dùng chung khi kênh không có mẫu riêng
+const defaultChannelTemplate = "default"
+
+// supportedLocales là các ngôn ngữ có mẫu thông báo
+var supportedLocales = []string{"vi", "en"}
+
+// NotificationTemplate là mẫu thông báo theo kênh và ngôn ngữ.
+// Subject và Body dùng text/template, HTMLBody dùng html/template (chỉ cho kênh email).
+type NotificationTemplate struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Channel   string    `gorm:"uniqueIndex:idx_template_channel_locale" json:"channel"`
+	Locale    string    `gorm:"uniqueIndex:idx_template_channel_locale" json:"locale"`
+	Subject   string    `gorm:"type:text" json:"subject"`
+	Body      string    `gorm:"type:text" json:"body"`
+	HTMLBody  string    `gorm:"type:text" json:"html_body"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// RenderedMessage là nội dung thông báo đã dựng từ mẫu
+type RenderedMessage struct {
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+	HTML    string `json:"html,omitempty"`
+}
+
+// templateData là dữ liệu truyền vào mẫu thông báo
+type templateData struct {
+	Alert         Alert
+	Title         string // Tiêu đề theo ngôn ngữ, suy ra từ loại cảnh báo
+	SeverityLabel string
+	Time          string
+	Link          string
+	HasSnapshot   bool
+	SnapshotCID   htmltemplate.URL // Tham chiếu ảnh chụp nhúng trong email, dùng trong <img src="...">
+	SummaryCount  int              // Khác 0 nếu là thông báo tổng hợp
+	SummaryWindow string
+}
+
+// alertTitles là tiêu đề cảnh báo theo ngôn ngữ và loại cảnh báo
+var alertTitles = map[string]map[string]string{
+	"vi": {
+		"unrecognized":           "Phát hiện khuôn mặt lạ",
+		"visitor_zone_violation": "Khách vào khu vực không được phép",
+	},
+	"en": {
+		"unrecognized":           "Unrecognized face detected",
+		"visitor_zone_violation": "Visitor entered a restricted zone",
+	},
+}
+
+// severityLabels là tên mức độ nghiêm trọng theo ngôn ngữ
+var severityLabels = map[string]map[string]string{
+	"vi": {SeverityLow: "Thấp", SeverityMedium: "Trung bình", SeverityHigh: "Cao", SeverityCritical: "Nghiêm trọng"},
+	"en": {SeverityLow: "Low", SeverityMedium: "Medium", SeverityHigh: "High", SeverityCritical: "Critical"},
+}
+
+// builtinTemplates là mẫu mặc định khi chưa cấu hình mẫu trong cơ sở dữ liệu
+var builtinTemplates = []NotificationTemplate{
+	{
+		Channel: defaultChannelTemplate,
+		Locale:  "vi",
+		Subject: `[isafe] {{.Title}}`,
+		Body: `{{if .SummaryCount}}{{.SummaryCount}} cảnh báo bị gộp do giới hạn tần suất trong {{.SummaryWindow}}. Mới nhất: {{end -}}
+[isafe] {{.Title}} - {{.Time}}{{with .Alert.Zone}}, khu vực {{.}}{{end}}{{with .Alert.DeviceID}}, thiết bị {{.}}{{end}}. Mức độ: {{.SeverityLabel}}. {{.Link}}`,
+	},
+	{
+		Channel: defaultChannelTemplate,
+		Locale:  "en",
+		Subject: `[isafe] {{.Title}}`,
+		Body: `{{if .SummaryCount}}{{.SummaryCount}} alerts were held back by the rate limit in the last {{.SummaryWindow}}. Latest: {{end -}}
+[isafe] {{.Title}} - {{.Time}}{{with .Alert.Zone}}, zone {{.}}{{end}}{{with .Alert.DeviceID}}, device {{.}}{{end}}. Severity: {{.SeverityLabel}}. {{.Link}}`,
+	},
+	{
+		Channel:  "smtp",
+		Locale:   "vi",
+		Subject:  `{{if .SummaryCount}}[{{.SummaryCount}} cảnh báo] {{end}}Cảnh báo an ninh #{{.Alert.ID}}: {{.Title}}`,
+		Body:     `{{.Title}}{{"\n"}}Thời gian: {{.Time}}{{"\n"}}Thiết bị: {{or .Alert.DeviceID "không rõ"}}{{"\n"}}Mức độ: {{.SeverityLabel}}{{"\n\n"}}{{.Link}}`,
+		HTMLBody: emailHTMLTemplate("Cảnh báo an ninh", "Mã cảnh báo", "Loại", "Khu vực", "Thiết bị", "không rõ", "Thời gian", "Mức độ", "Độ tương đồng", "Ảnh chụp khuôn mặt", "Mở cảnh báo trên dashboard", "cảnh báo khác bị gộp do giới hạn tần suất trong"),
+	},
+	{
+		Channel:  "smtp",
+		Locale:   "en",
+		Subject:  `{{if .SummaryCount}}[{{.SummaryCount}} alerts] {{end}}Security Alert #{{.Alert.ID}}: {{.Title}}`,
+		Body:     `{{.Title}}{{"\n"}}Time: {{.Time}}{{"\n"}}Device: {{or .Alert.DeviceID "unknown"}}{{"\n"}}Severity: {{.SeverityLabel}}{{"\n\n"}}{{.Link}}`,
+		HTMLBody: emailHTMLTemplate("Security Alert", "Alert ID", "Type", "Zone", "Device", "unknown", "Time", "Severity", "Similarity", "Face snapshot", "Open alert in dashboard", "more alerts were held back by the rate limit in the last"),
+	},
+}
+
+// emailHTMLTemplate dựng mẫu HTML email mặc định với các nhãn theo ngôn ngữ
+func emailHTMLTemplate(heading, id, kind, zone, device, unknown, at, severity, similarity, snapshot, open, summary string) string {
+	return `<!DOCTYPE html>
+<html>
+<body style="font-family: Arial, sans-serif; color: #222;">
+  <h2 style="color: #c62828;">` + heading + `</h2>
+  <p><b>{{.Title}}</b></p>
+  {{if .SummaryCount}}<p>{{.SummaryCount}} ` + summary + ` {{.SummaryWindow}}.</p>{{end}}
+  <table cellpadding="6" style="border-collapse: collapse;">
+    <tr><td><b>` + id + `</b></td><td>#{{.Alert.ID}}</td></tr>
+    <tr><td><b>` + kind + `</b></td><td>{{.Alert.Status}}</td></tr>
+    <tr><td><b>` + zone + `</b></td><td>{{or .Alert.Zone "` + unknown + `"}}</td></tr>
+    <tr><td><b>` + device + `</b></td><td>{{or .Alert.DeviceID "` + unknown + `"}}</td></tr>
+    <tr><td><b>` + at + `</b></td><td>{{.Time}}</td></tr>
+    <tr><td><b>` + severity + `</b></td><td>{{.SeverityLabel}}</td></tr>
+    <tr><td><b>` + similarity + `</b></td><td>{{printf "%.2f" .Alert.Similarity}}</td></tr>
+  </table>
+  {{if .HasSnapshot}}<p><img src="{{.SnapshotCID}}" alt="` + snapshot + `" style="max-width: 480px; border: 1px solid #ccc;"></p>{{end}}
+  <p><a href="{{.Link}}" style="background: #1565c0; color: #fff; padding: 10px 16px; text-decoration: none; border-radius: 4px;">` + open + `</a></p>
+</body>
+</html>
+`
+}
+
+// sampleAlerts là các cảnh báo mẫu dùng để xem trước mẫu thông báo
+var sampleAlerts = map[string]Alert{
+	"unrecognized": {
+		ID: 1024, Similarity: 0.42, AlertMessage: "Unrecognized face detected", Status: "unrecognized",
+		DeviceID: "cam-gate-01", Zone: "main-gate", Severity: SeverityHigh, State: AlertStateOpen,
+	},
+	"visitor_zone_violation": {
+		ID: 1026, Similarity: 0.91, AlertMessage: `Visitor Nguyen Van A is not allowed in zone "server-room" (host: Tran Thi B)`, Status: "visitor_zone_violation",
+		DeviceID: "cam-server-01", Zone: "server-room", Severity: SeverityHigh, State: AlertStateOpen,
+	},
+}
+
+// defaultLocale là ngôn ngữ cho người nhận mặc định (không có trong danh bạ)
+func defaultLocale() string {
+	if locale := os.Getenv("DEFAULT_LOCALE"); containsString(supportedLocales, locale) {
+		return locale
+	}
+	return "vi"
+}
+
+// dashboardURL là địa chỉ frontend dùng để tạo deep link tới cảnh báo
+func dashboardURL() string {
+	if url := os.Getenv("DASHBOARD_URL"); url != "" {
+		return strings.TrimRight(url, "/")
+	}
+	return "http://localhost:3000"
+}
+
+// alertLink trả về deep link tới cảnh báo trên dashboard
+func alertLink(alert Alert) string {
+	return fmt.Sprintf("%s/alerts/%d", dashboardURL(), alert.ID)
+}
+
+// validate kiểm tra mẫu thông báo có cú pháp hợp lệ và dựng được với cảnh báo mẫu
+func (t *NotificationTemplate) validate() error {
+	if t.Channel == "" {
+		t.Channel = defaultChannelTemplate
+	}
+	if _, ok := notifierFactories[t.Channel]; !ok && t.Channel != defaultChannelTemplate {
+		return fmt.Errorf("unknown channel %q", t.Channel)
+	}
+	if !containsString(supportedLocales, t.Locale) {
+		return fmt.Errorf("locale must be one of %s", strings.Join(supportedLocales, ", "))
+	}
+	if t.Body == "" {
+		return errors.New("body is required")
+	}
+	_, err := t.render(newTemplateData(sampleAlerts["unrecognized"], t.Locale, 0))
+	return err
+}
+
+// render dựng nội dung thông báo từ mẫu
+func (t *NotificationTemplate) render(data templateData) (RenderedMessage, error) {
+	var msg RenderedMessage
+	var err error
+	if msg.Subject, err = renderText("subject", t.Subject, data); err != nil {
+		return msg, err
+	}
+	if msg.Text, err = renderText("body", t.Body, data); err != nil {
+		return msg, err
+	}
+	if t.HTMLBody != "" {
+		tmpl, err := htmltemplate.New("html_body").Option("missingkey=error").Parse(t.HTMLBody)
+		if err != nil {
+			return msg, fmt.Errorf("html_body: %w", err)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return msg, fmt.Errorf("html_body: %w", err)
+		}
+		msg.HTML = buf.String()
+	}
+	return msg, nil
+}
+
+// renderText dựng một trường văn bản của mẫu
+func renderText(name, source string, data templateData) (string, error) {
+	tmpl, err := texttemplate.New(name).Option("missingkey=error").Parse(source)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", name, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("%s: %w", name, err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// newTemplateData chuẩn bị dữ liệu mẫu cho cảnh báo theo ngôn ngữ
+func newTemplateData(alert Alert, locale string, summaryCount int) templateData {
+	title := alertTitles[locale][alert.Status]
+	if title == "" {
+		title = alert.AlertMessage
+	}
+	severity := severityLabels[locale][alert.Severity]
+	if severity == "" {
+		severity = alert.Severity
+	}
+	return templateData{
+		Alert:         alert,
+		Title:         title,
+		SeverityLabel: severity,
+		Time:          alert.Timestamp.In(routingLocation).Format("2006-01-02 15:04:05"),
+		Link:          alertLink(alert),
+		HasSnapshot:   stripDataURL(alert.FaceSnapshot) != "",
+		SnapshotCID:   htmltemplate.URL("cid:" + snapshotContentID),
+		SummaryCount:  summaryCount,
+		SummaryWindow: notifyRateWindow.String(),
+	}
+}
+
+// findTemplate chọn mẫu cho kênh và ngôn ngữ: mẫu riêng của kênh, rồi mẫu chung,
+// rồi mẫu mặc định có sẵn (ưu tiên tiếng Anh nếu không có ngôn ngữ yêu cầu)
+func findTemplate(tx *gorm.DB, channel, locale string) (NotificationTemplate, error) {
+	var stored []NotificationTemplate
+	if err := tx.Where("channel IN ? AND locale = ?", []string{channel, defaultChannelTemplate}, locale).Find(&stored).Error; err != nil {
+		return NotificationTemplate{}, err
+	}
+	for _, name := range []string{channel, defaultChannelTemplate} {
+		for _, t := range stored {
+			if t.Channel == name {
+				return t, nil
+			}
+		}
+		for _, t := range builtinTemplates {
+			if t.Channel == name && t.Locale == locale {
+				return t, nil
+			}
+		}
+	}
+	if locale != "en" {
+		return findTemplate(tx, channel, "en")
+	}
+	return NotificationTemplate{}, fmt.Errorf("no template for channel %q", channel)
+}
+
+// deliveryLocale là ngôn ngữ của người nhận một lần gửi
+func deliveryLocale(tx *gorm.DB, delivery NotificationDelivery) string {
+	if delivery.RecipientID != nil {
+		var recipient Recipient
+		if err := tx.Select("language").First(&recipient, *delivery.RecipientID).Error; err == nil &&
+			containsString(supportedLocales, recipient.Language) {
+			return recipient.Language
+		}
+	}
+	return defaultLocale()
+}
+
+// renderNotification dựng thông báo cho một lần gửi theo kênh và ngôn ngữ của người nhận
+func renderNotification(delivery NotificationDelivery, alert Alert) (Notification, error) {
+	locale := deliveryLocale(db, delivery)
+	tmpl, err := findTemplate(db, delivery.Channel, locale)
+	if err != nil {
+		return Notification{}, err
+	}
+	msg, err := tmpl.render(newTemplateData(alert, locale, delivery.SummaryCount))
+	if err != nil {
+		return Notification{}, fmt.Errorf("render template %s/%s: %w", tmpl.Channel, tmpl.Locale, err)
+	}
+	return Notification{
+		Alert:   alert,
+		To:      delivery.Recipient,
+		Subject: msg.Subject,
+		Text:    msg.Text,
+		HTML:    msg.HTML,
+		Locale:  locale,
+	}, nil
+}
+
+// getNotificationTemplatesHandler lấy danh sách mẫu đã lưu, ?builtin=true lấy các mẫu mặc định có sẵn
+func getNotificationTemplatesHandler(c *gin.Context) {
+	if c.Query("builtin") == "true" {
+		c.JSON(http.StatusOK, builtinTemplates)
+		return
+	}
+
+	var templates []NotificationTemplate
+	if err := db.Order("channel, locale").Find(&templates).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error fetching notification templates", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, templates)
+}
+
+// saveNotificationTemplateHandler tạo mới hoặc cập nhật mẫu thông báo; mỗi kênh và ngôn ngữ chỉ có một mẫu
+func saveNotificationTemplateHandler(c *gin.Context) {
+	var tmpl NotificationTemplate
+	if err := c.ShouldBindJSON(&tmpl); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if id := c.Param("id"); id != "" {
+		if _, err := fmt.Sscan(id, &tmpl.ID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid template id"})
+			return
+		}
+	}
+	if err := tmpl.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Tạo mới trùng kênh và ngôn ngữ thì ghi đè mẫu đã có
+	if tmpl.ID == 0 {
+		var existing NotificationTemplate
+		if err := db.Where("channel = ? AND locale = ?", tmpl.Channel, tmpl.Locale).Limit(1).Find(&existing).Error; err == nil {
+			tmpl.ID = existing.ID
+		}
+	}
+
+	if err := db.Save(&tmpl).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error saving notification template", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save template"})
+		return
+	}
+	c.JSON(http.StatusOK, tmpl)
+}
+
+// deleteNotificationTemplateHandler xóa mẫu đã lưu, kênh đó quay về dùng mẫu mặc định
+func deleteNotificationTemplateHandler(c *gin.Context) {
+	if err := db.Delete(&NotificationTemplate{}, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete template"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Template deleted successfully"})
+}
+
+// previewNotificationTemplateHandler dựng thử mẫu với các cảnh báo mẫu.
+// Nếu không gửi body thì xem trước mẫu đang áp dụng cho channel và locale.
+func previewNotificationTemplateHandler(c *gin.Context) {
+	var req struct {
+		NotificationTemplate
+		Sample       string `json:"sample"` // Loại cảnh báo mẫu, trống là tất cả
+		SummaryCount int    `json:"summary_count"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	tmpl := req.NotificationTemplate
+	if tmpl.Locale == "" {
+		tmpl.Locale = defaultLocale()
+	}
+	if tmpl.Body == "" {
+		channel := tmpl.Channel
+		if channel == "" {
+			channel = defaultChannelTemplate
+		}
+		found, err := findTemplate(db, channel, tmpl.Locale)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		tmpl = found
+	}
+
+	previews := map[string]RenderedMessage{}
+	for status, alert := range sampleAlerts {
+		if req.Sample != "" && req.Sample != status {
+			continue
+		}
+		alert.Timestamp = time.Now()
+		msg, err := tmpl.render(newTemplateData(alert, tmpl.Locale, req.SummaryCount))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		previews[status] = msg
+	}
+	if len(previews) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown sample"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"channel": tmpl.Channel, "locale": tmpl.Locale, "previews": previews})
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestBuiltinTemplatesRender(t *testing.T) {
+	for _, tmpl := range builtinTemplates {
+		for status, alert := range sampleAlerts {
+			for _, summary := range []int{0, 3} {
+				msg, err := tmpl.render(newTemplateData(alert, tmpl.Locale, summary))
+				if err != nil {
+					t.Fatalf("%s/%s %s: render() = %v", tmpl.Channel, tmpl.Locale, status, err)
+				}
+				if msg.Subject == "" || msg.Text == "" || (tmpl.HTMLBody != "") != (msg.HTML != "") {
+					t.Errorf("%s/%s %s: incomplete message %+v", tmpl.Channel, tmpl.Locale, status, msg)
+				}
+				if strings.Contains(msg.Subject+msg.Text+msg.HTML, "<no value>") {
+					t.Errorf("%s/%s %s: message contains <no value>", tmpl.Channel, tmpl.Locale, status)
+				}
+			}
+		}
+	}
+}
+
+func TestTemplateRendering(t *testing.T) {
+	stubRoutingLocation(t, time.FixedZone("ICT", 7*3600))
+	t.Setenv("DASHBOARD_URL", "https://isafe.example/")
+	alert := Alert{
+		ID: 42, Status: "unrecognized", Severity: SeverityCritical, DeviceID: "cam-gate-01", Zone: "main-gate",
+		Timestamp: time.Date(2026, 10, 19, 1, 30, 0, 0, time.UTC),
+	}
+	bare := Alert{ID: 43, Status: "tailgating", AlertMessage: `Tailgating <b>detected</b>`, Severity: "urgent"}
+	builtin := func(channel, locale string) NotificationTemplate {
+		for _, tmpl := range builtinTemplates {
+			if tmpl.Channel == channel && tmpl.Locale == locale {
+				return tmpl
+			}
+		}
+		t.Fatalf("no builtin template %s/%s", channel, locale)
+		return NotificationTemplate{}
+	}
+
+	tests := []struct {
+		name    string
+		tmpl    NotificationTemplate
+		alert   Alert
+		summary int
+		want    []string
+		notWant []string
+	}{
+		{"vietnamese", builtin(defaultChannelTemplate, "vi"), alert, 0,
+			[]string{"Phát hiện khuôn mặt lạ - 2026-10-19 08:30:00, khu vực main-gate, thiết bị cam-gate-01",
+				"Mức độ: Nghiêm trọng", "https://isafe.example/alerts/42"}, nil},
+		{"english", builtin(defaultChannelTemplate, "en"), alert, 0,
+			[]string{"Unrecognized face detected", "zone main-gate, device cam-gate-01", "Severity: Critical"}, nil},
+		{"summary", builtin(defaultChannelTemplate, "en"), alert, 5,
+			[]string{"5 alerts were held back by the rate limit in the last " + notifyRateWindow.String()}, nil},
+		// Loại cảnh báo không có tiêu đề thì dùng nội dung cảnh báo, mức độ lạ giữ nguyên
+		{"unknown status and severity", builtin(defaultChannelTemplate, "vi"), bare, 0,
+			[]string{"Tailgating <b>detected</b>", "Mức độ: urgent"}, []string{"khu vực", "thiết bị"}},
+		{"email without device", builtin("smtp", "vi"), bare, 0,
+			[]string{"Thiết bị: không rõ", "<td>không rõ</td>", "Tailgating &lt;b&gt;detected&lt;/b&gt;"},
+			[]string{"<img"}},
+		{"email with snapshot", builtin("smtp", "en"), Alert{ID: 44, FaceSnapshot: jpegSnapshot}, 0,
+			[]string{`<img src="cid:` + snapshotContentID + `"`}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := tt.tmpl.render(newTemplateData(tt.alert, tt.tmpl.Locale, tt.summary))
+			if err != nil {
+				t.Fatalf("render() = %v", err)
+			}
+			out := msg.Subject + "\n" + msg.Text + "\n" + msg.HTML
+			for _, want := range tt.want {
+				if !strings.Contains(out, want) {
+					t.Errorf("message does not contain %q:\n%s", want, out)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(out, notWant) {
+					t.Errorf("message contains %q:\n%s", notWant, out)
+				}
+			}
+		})
+	}
+}
+
+func TestNotificationTemplateValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		tmpl    NotificationTemplate
+		wantErr string
+	}{
+		{"valid", NotificationTemplate{Locale: "en", Body: "{{.Title}} {{.Link}}"}, ""},
+		{"unknown channel", NotificationTemplate{Channel: "pager", Locale: "en", Body: "x"}, `unknown channel "pager"`},
+		{"unsupported locale", NotificationTemplate{Locale: "fr", Body: "x"}, "locale must be one of vi, en"},
+		{"no body", NotificationTemplate{Locale: "vi"}, "body is required"},
+		{"syntax error", NotificationTemplate{Locale: "vi", Body: "{{.Title"}, "body: "},
+		{"missing field", NotificationTemplate{Locale: "vi", Subject: "{{.Alert.Camera}}", Body: "x"}, "subject: "},
+		{"missing html field", NotificationTemplate{Channel: "smtp", Locale: "vi", Body: "x", HTMLBody: "<p>{{.Recipient}}</p>"},
+			"html_body: "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.tmpl.validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("validate() = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("validate() = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFindTemplate(t *testing.T) {
+	stored := []NotificationTemplate{
+		{ID: 1, Channel: "telegram", Locale: "vi", Body: "telegram vi"},
+		{ID: 2, Channel: defaultChannelTemplate, Locale: "en", Body: "default en"},
+	}
+	tests := []struct {
+		channel, locale string
+		wantChannel     string
+		wantLocale      string
+		wantStored      uint
+	}{
+		{"telegram", "vi", "telegram", "vi", 1},
+		{"zalo", "en", defaultChannelTemplate, "en", 2},                 // Mẫu chung đã lưu
+		{"smtp", "vi", "smtp", "vi", 0},                                 // Mẫu có sẵn của kênh
+		{"zalo", "vi", defaultChannelTemplate, "vi", 0},                 // Mẫu chung có sẵn
+		{"telegram", "fr", defaultChannelTemplate, "en", 2},             // Ngôn ngữ không có mẫu thì dùng tiếng Anh
+		{"smtp", "fr", "smtp", "en", 0},                                 // Mẫu riêng có sẵn vẫn ưu tiên hơn mẫu chung
+		{defaultChannelTemplate, "ja", defaultChannelTemplate, "en", 2}, // Không lặp vô hạn khi không có ngôn ngữ
+	}
+	for _, tt := range tests {
+		conn := dryRunDB(t)
+		stubQuery(conn, func(stmt *gorm.Statement) (int64, error) {
+			locale := stmt.Vars[len(stmt.Vars)-1]
+			var found []NotificationTemplate
+			for _, tmpl := range stored {
+				if tmpl.Locale == locale && (tmpl.Channel == tt.channel || tmpl.Channel == defaultChannelTemplate) {
+					found = append(found, tmpl)
+				}
+			}
+			*stmt.Dest.(*[]NotificationTemplate) = found
+			return int64(len(found)), nil
+		})
+
+		got, err := findTemplate(conn, tt.channel, tt.locale)
+		if err != nil {
+			t.Fatalf("findTemplate(%s, %s) = %v", tt.channel, tt.locale, err)
+		}
+		if got.Channel != tt.wantChannel || got.Locale != tt.wantLocale || got.ID != tt.wantStored {
+			t.Errorf("findTemplate(%s, %s) = %s/%s #%d, want %s/%s #%d", tt.channel, tt.locale,
+				got.Channel, got.Locale, got.ID, tt.wantChannel, tt.wantLocale, tt.wantStored)
+		}
+	}
+}
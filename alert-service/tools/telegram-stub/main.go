@@ -0,0 +1,260 @@
+// telegram-stub giả lập một phần Telegram Bot API để thử notifier telegram của alert-service
+// mà không cần bot thật: ghi lại các tin nhắn đã gửi và cho phép "bấm" nút inline.
+//
+//	go run ./tools/telegram-stub -webhook http://localhost:8081/telegram/webhook -secret dev-secret
+//
+// Chạy alert-service với NOTIFIERS=telegram TELEGRAM_BOT_TOKEN=test TELEGRAM_CHAT_IDS=1001
+// TELEGRAM_WEBHOOK_SECRET=dev-secret TELEGRAM_API_URL=http://localhost:8092.
+// Bỏ -webhook và đặt TELEGRAM_POLLING=true để thử long polling.
+//
+//	curl localhost:8092/messages
+//	curl -X POST 'localhost:8092/press?message_id=1&action=ack'
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// message là tin nhắn bot đã gửi
+type message struct {
+	MessageID   int64           `json:"message_id"`
+	Method      string          `json:"method"`
+	ChatID      string          `json:"chat_id"`
+	Text        string          `json:"text"`
+	PhotoBytes  int             `json:"photo_bytes,omitempty"`
+	ReplyMarkup json.RawMessage `json:"reply_markup,omitempty"`
+}
+
+type stub struct {
+	mu       sync.Mutex
+	messages []message
+	updates  []map[string]interface{}
+	nextID   int64
+	webhook  string
+	secret   string
+	notify   chan struct{}
+}
+
+func main() {
+	addr := flag.String("addr", ":8092", "listen address")
+	webhook := flag.String("webhook", "", "alert-service webhook URL; empty queues updates for getUpdates")
+	secret := flag.String("secret", "", "value sent as X-Telegram-Bot-Api-Secret-Token")
+	flag.Parse()
+
+	s := &stub{webhook: *webhook, secret: *secret, notify: make(chan struct{}, 1)}
+
+	http.HandleFunc("/messages", s.listMessages)
+	http.HandleFunc("/press", s.press)
+	http.HandleFunc("/", s.botMethod)
+
+	log.Printf("Telegram Bot API stub listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
+
+// botMethod xử lý /bot<token>/<method>
+func (s *stub) botMethod(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) != 2 || !strings.HasPrefix(parts[0], "bot") {
+		http.NotFound(w, r)
+		return
+	}
+	method := parts[1]
+	params, photo, err := readParams(r)
+	if err != nil {
+		reply(w, false, err.Error(), nil)
+		return
+	}
+
+	switch method {
+	case "sendMessage", "sendPhoto":
+		s.mu.Lock()
+		s.nextID++
+		msg := message{
+			MessageID:  s.nextID,
+			Method:     method,
+			ChatID:     params["chat_id"],
+			Text:       params["text"] + params["caption"],
+			PhotoBytes: photo,
+		}
+		if markup := params["reply_markup"]; markup != "" {
+			msg.ReplyMarkup = json.RawMessage(markup)
+		}
+		s.messages = append(s.messages, msg)
+		s.mu.Unlock()
+		log.Printf("%s chat=%s photo=%dB text=%q", method, msg.ChatID, photo, msg.Text)
+		reply(w, true, "", map[string]interface{}{"message_id": msg.MessageID, "chat": map[string]interface{}{"id": chatID(msg.ChatID)}})
+	case "answerCallbackQuery", "editMessageReplyMarkup":
+		log.Printf("%s %v", method, params)
+		reply(w, true, "", true)
+	case "getUpdates":
+		timeout, _ := strconv.Atoi(params["timeout"])
+		offset, _ := strconv.ParseInt(params["offset"], 10, 64)
+		reply(w, true, "", s.waitUpdates(offset, time.Duration(timeout)*time.Second))
+	default:
+		reply(w, false, "method not supported by stub: "+method, nil)
+	}
+}
+
+// press giả lập người dùng bấm nút inline của một tin nhắn
+func (s *stub) press(w http.ResponseWriter, r *http.Request) {
+	messageID, _ := strconv.ParseInt(r.URL.Query().Get("message_id"), 10, 64)
+	action := r.URL.Query().Get("action")
+
+	s.mu.Lock()
+	var msg *message
+	for i := range s.messages {
+		if s.messages[i].MessageID == messageID {
+			msg = &s.messages[i]
+		}
+	}
+	s.mu.Unlock()
+	if msg == nil {
+		http.Error(w, "message not found", http.StatusNotFound)
+		return
+	}
+
+	var markup struct {
+		InlineKeyboard [][]struct {
+			CallbackData string `json:"callback_data"`
+		} `json:"inline_keyboard"`
+	}
+	json.Unmarshal(msg.ReplyMarkup, &markup)
+	data := ""
+	for _, row := range markup.InlineKeyboard {
+		for _, button := range row {
+			if strings.HasPrefix(button.CallbackData, action+":") {
+				data = button.CallbackData
+			}
+		}
+	}
+	if data == "" {
+		http.Error(w, "button not found", http.StatusNotFound)
+		return
+	}
+
+	s.mu.Lock()
+	updateID := int64(len(s.updates) + 1)
+	update := map[string]interface{}{
+		"update_id": updateID,
+		"callback_query": map[string]interface{}{
+			"id":      strconv.FormatInt(updateID, 10),
+			"data":    data,
+			"from":    map[string]interface{}{"id": 42, "username": "guard_on_duty", "language_code": "vi"},
+			"message": map[string]interface{}{"message_id": msg.MessageID, "chat": map[string]interface{}{"id": chatID(msg.ChatID)}},
+		},
+	}
+	s.updates = append(s.updates, update)
+	s.mu.Unlock()
+
+	if s.webhook == "" {
+		select {
+		case s.notify <- struct{}{}:
+		default:
+		}
+		w.Write([]byte("queued for getUpdates\n"))
+		return
+	}
+
+	body, _ := json.Marshal(update)
+	req, _ := http.NewRequest(http.MethodPost, s.webhook, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if s.secret != "" {
+		req.Header.Set("X-Telegram-Bot-Api-Secret-Token", s.secret)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(resp.Body)
+	w.Write([]byte(resp.Status + " " + string(respBody) + "\n"))
+}
+
+// waitUpdates trả về các update có update_id >= offset, chờ tối đa timeout nếu chưa có
+func (s *stub) waitUpdates(offset int64, timeout time.Duration) []map[string]interface{} {
+	deadline := time.After(timeout)
+	for {
+		s.mu.Lock()
+		var pending []map[string]interface{}
+		for _, u := range s.updates {
+			if u["update_id"].(int64) >= offset {
+				pending = append(pending, u)
+			}
+		}
+		s.mu.Unlock()
+		if len(pending) > 0 {
+			return pending
+		}
+		select {
+		case <-s.notify:
+		case <-deadline:
+			return []map[string]interface{}{}
+		}
+	}
+}
+
+func (s *stub) listMessages(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.messages)
+}
+
+// readParams đọc tham số dạng JSON hoặc multipart, trả về kích thước ảnh nếu có
+func readParams(r *http.Request) (map[string]string, int, error) {
+	params := map[string]string{}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := r.ParseMultipartForm(16 << 20); err != nil {
+			return nil, 0, err
+		}
+		for key, values := range r.MultipartForm.Value {
+			params[key] = values[0]
+		}
+		size := 0
+		if files := r.MultipartForm.File["photo"]; len(files) > 0 {
+			size = int(files[0].Size)
+		}
+		return params, size, nil
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&raw); err != nil && err != io.EOF {
+		return nil, 0, err
+	}
+	for key, value := range raw {
+		var str string
+		if json.Unmarshal(value, &str) == nil {
+			params[key] = str
+		} else {
+			params[key] = string(value)
+		}
+	}
+	return params, 0, nil
+}
+
+func reply(w http.ResponseWriter, ok bool, description string, result interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	resp := map[string]interface{}{"ok": ok}
+	if ok {
+		resp["result"] = result
+	} else {
+		resp["description"] = description
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// chatID trả về chat_id dạng số như Bot API thật
+func chatID(raw string) int64 {
+	id, _ := strconv.ParseInt(raw, 10, 64)
+	return id
+}
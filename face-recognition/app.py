@@ -6,6 +6,10 @@ import numpy as np
 app = Flask(__name__)
 CORS(app, resources={r"/*": {"origins": "http://localhost:3000"}})  # Cho phép CORS từ Frontend
 
+@app.route('/healthz', methods=['GET'])
+def healthz():
+    return jsonify({'status': 'ok'})
+
 @app.route('/process_image', methods=['POST'])
 def process_image():
     if 'image' not in request.files:
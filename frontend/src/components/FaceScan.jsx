@@ -173,7 +173,7 @@ function FaceScan() {
         setResult(null);
 
         try {
-            const response = await verifyFace(file); // Call verifyFace API
+            const response = await verifyFace(file, process.env.NEXT_PUBLIC_DEVICE_ID); // Call verifyFace API
             setResult(response.data);
         } catch (err) {
             setError('Error during face recognition.');
@@ -9,14 +9,22 @@ const apiClient = axios.create({
 });
 
 // Ví dụ: API để xác minh khuôn mặt
-export const verifyFace = (file) => {
+// deviceId (tùy chọn) được gửi qua header X-Device-ID để kiosk có giới hạn tần suất riêng
+// và qua trường device_id để xác định khu vực
+export const verifyFace = (file, deviceId) => {
     const formData = new FormData();
     formData.append('image', file); // 'image' là key mà backend mong đợi
 
+    const headers = {
+        'Content-Type': 'multipart/form-data',
+    };
+    if (deviceId) {
+        formData.append('device_id', deviceId);
+        headers['X-Device-ID'] = deviceId;
+    }
+
     const data = apiClient.post('/verify_face', formData, {
-        headers: {
-            'Content-Type': 'multipart/form-data',
-        },
+        headers,
     });
 
     return data
@@ -59,6 +67,20 @@ export const deleteUser = (id) => {
 };
 
 
+// Mở luồng sự kiện thời gian thực (SSE), ví dụ params = { device_id, types: 'alert.created,alert.updated' }
+// Khi kết nối lại không tiếp tục được (sang bản sao khác hoặc server khởi động lại), server gửi sự kiện
+// 'stream.reset'; nên tải lại dữ liệu hiện tại trong listener của sự kiện này.
+export const subscribeEvents = (params = {}) => {
+    const query = new URLSearchParams(params).toString();
+    return new EventSource(`${apiClient.defaults.baseURL}/events${query ? `?${query}` : ''}`);
+};
+
+// Mở phiên WebSocket xác thực liên tục; gửi khung hình JPEG dạng Blob qua socket.send(blob)
+export const openVerifyStream = (deviceId) => {
+    const wsBase = apiClient.defaults.baseURL.replace(/^http/, 'ws');
+    const query = deviceId ? `?device_id=${encodeURIComponent(deviceId)}` : '';
+    return new WebSocket(`${wsBase}/ws/verify${query}`);
+};
 
 // Thêm các API khác tùy thuộc vào backend của bạn
 export default apiClient;
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"isafe/shared/alertapi"
+	"isafe/shared/logging"
+	"isafe/shared/tracing"
+)
+
+// Các trạng thái của một cảnh báo chờ chuyển sang Alert Service
+const (
+	HandoffPending   = "pending"
+	HandoffDelivered = "delivered"
+	HandoffRejected  = "rejected" // Alert Service từ chối payload, thử lại cũng vô ích
+)
+
+const (
+	handoffPollInterval = 2 * time.Second
+	// handoffLease là thời gian giữ một bản ghi đang gửi trước khi cho phép gửi lại
+	handoffLease      = time.Minute
+	handoffMinBackoff = 2 * time.Second
+	handoffMaxBackoff = 5 * time.Minute
+)
+
+// AlertHandoff là cảnh báo đã ghi nhận cục bộ, chờ Alert Service xác nhận đã nhận
+type AlertHandoff struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	EventID       string     `gorm:"uniqueIndex" json:"event_id"`
+	Payload       string     `gorm:"type:text" json:"-"`
+	Status        string     `gorm:"index:idx_handoff_due" json:"status"`
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt time.Time  `gorm:"index:idx_handoff_due" json:"next_attempt_at"`
+	LastError     string     `json:"last_error,omitempty"`
+	DeliveredAt   *time.Time `json:"delivered_at"`
+	TraceParent   string     `json:"-"` // Ngữ cảnh trace của request tạo cảnh báo
+	RequestID     string     `json:"request_id,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// alertServiceBaseURL lấy địa chỉ Alert Service từ biến môi trường
+func alertServiceBaseURL() string {
+	if url := os.Getenv("ALERT_SERVICE_URL"); url != "" {
+		return strings.TrimRight(url, "/")
+	}
+	return "http://localhost:8081"
+}
+
+// alertClient gửi cảnh báo đã ký bằng ALERT_INGRESS_SECRET tới Alert Service
+var alertClient = alertapi.NewClient(alertServiceBaseURL(), os.Getenv("ALERT_INGRESS_SECRET"))
+
+// handoffWake đánh thức worker ngay khi có cảnh báo mới
+var handoffWake = make(chan struct{}, 1)
+
+// newEventID tạo mã định danh ngẫu nhiên cho một cảnh báo
+func newEventID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// sendAlert ghi cảnh báo kèm ảnh chụp vào outbox trong giao dịch tx, cùng giao dịch với dữ liệu của lượt
+// xác thực nên cảnh báo không bị mất khi ghi lỗi; worker sẽ chuyển tới Alert Service và thử lại cho tới khi
+// được xác nhận. event_id giúp Alert Service bỏ qua bản gửi trùng. Ngữ cảnh trace và request ID của ctx được
+// lưu kèm để lần gửi nằm trong cùng trace và log với request xác thực.
+// Gọi alertQueued sau khi giao dịch đã commit.
+func sendAlert(ctx context.Context, tx *gorm.DB, alert Alert, imageBytes []byte) error {
+	eventID, err := newEventID()
+	if err != nil {
+		return fmt.Errorf("generate alert event ID: %w", err)
+	}
+
+	alertData := alertapi.SendAlertRequest{
+		SchemaVersion: alertapi.SchemaVersion,
+		EventID:       eventID,
+		Similarity:    &alert.Similarity,
+		AlertMessage:  alert.AlertMessage,
+		FaceSnapshot:  base64.StdEncoding.EncodeToString(imageBytes), // Encode image to base64
+		Timestamp:     time.Now().Format(time.RFC3339),               // ISO format
+		Status:        alert.Status,
+		DeviceID:      alert.DeviceID,
+		Zone:          alert.Zone,
+		Severity:      alert.Severity,
+	}
+	alertBytes, err := json.Marshal(alertData)
+	if err != nil {
+		return fmt.Errorf("marshal alert: %w", err)
+	}
+
+	handoff := AlertHandoff{
+		EventID:       eventID,
+		Payload:       string(alertBytes),
+		Status:        HandoffPending,
+		NextAttemptAt: time.Now(),
+		TraceParent:   tracing.Inject(ctx),
+		RequestID:     logging.RequestID(ctx),
+	}
+	if err := tx.Create(&handoff).Error; err != nil {
+		return fmt.Errorf("queue alert %s: %w", eventID, err)
+	}
+	return nil
+}
+
+// alertQueued ghi nhận cảnh báo mới và đánh thức worker ngay, gọi sau khi giao dịch chứa sendAlert đã commit
+func alertQueued(status string) {
+	alertsRaised.WithLabelValues(status).Inc()
+	select {
+	case handoffWake <- struct{}{}:
+	default:
+	}
+}
+
+// runAlertHandoff liên tục chuyển các cảnh báo đến hạn sang Alert Service.
+// Khi dịch vụ tắt, worker chuyển nốt các cảnh báo đến hạn rồi thoát; cảnh báo đang chờ thử lại vẫn nằm trong outbox.
+func runAlertHandoff() {
+	for !app.DrainExpired() {
+		handoff, ok, err := claimHandoff()
+		if err != nil {
+			slog.Error("Error claiming alert handoff", "error", err)
+		}
+		if !ok {
+			if app.IsStopping() {
+				return
+			}
+			select {
+			case <-handoffWake:
+			case <-time.After(handoffPollInterval):
+			case <-app.Stopping():
+			}
+			continue
+		}
+		deliverHandoff(handoff)
+	}
+}
+
+// claimHandoff nhận một cảnh báo đến hạn, dùng SKIP LOCKED để nhiều bản sao dịch vụ không gửi trùng
+func claimHandoff() (AlertHandoff, bool, error) {
+	var handoff AlertHandoff
+	found := false
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", HandoffPending, time.Now()).
+			Order("next_attempt_at").
+			Limit(1).
+			Find(&handoff)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		found = true
+		return tx.Model(&handoff).Update("next_attempt_at", time.Now().Add(handoffLease)).Error
+	})
+	return handoff, found, err
+}
+
+// deliverHandoff gửi cảnh báo tới Alert Service và cập nhật kết quả
+func deliverHandoff(handoff AlertHandoff) {
+	ctx := logging.WithRequestID(tracing.Extract(context.Background(), handoff.TraceParent), handoff.RequestID)
+	ctx, span := tracer.Start(ctx, "alert.handoff",
+		trace.WithAttributes(attribute.String("alert.event_id", handoff.EventID), attribute.Int("attempt", handoff.Attempts+1)))
+	defer span.End()
+
+	handoff.Attempts++
+	retry, err := postAlert(ctx, handoff.Payload)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	updates := map[string]interface{}{"attempts": handoff.Attempts}
+	switch {
+	case err == nil:
+		updates["status"] = HandoffDelivered
+		updates["delivered_at"] = time.Now()
+		updates["last_error"] = ""
+		alertHandoffs.WithLabelValues("delivered").Inc()
+		slog.InfoContext(ctx, "Alert handed off", "event_id", handoff.EventID, "attempts", handoff.Attempts)
+	case !retry:
+		updates["status"] = HandoffRejected
+		updates["last_error"] = err.Error()
+		alertHandoffs.WithLabelValues("rejected").Inc()
+		slog.ErrorContext(ctx, "Alert rejected by alert service", "event_id", handoff.EventID, "error", err)
+	default:
+		updates["next_attempt_at"] = time.Now().Add(handoffBackoff(handoff.Attempts))
+		updates["last_error"] = err.Error()
+		alertHandoffs.WithLabelValues("retry").Inc()
+		slog.WarnContext(ctx, "Error handing off alert", "event_id", handoff.EventID, "attempt", handoff.Attempts, "error", err)
+	}
+
+	if err := db.Model(&handoff).Updates(updates).Error; err != nil {
+		slog.ErrorContext(ctx, "Error updating alert handoff", "event_id", handoff.EventID, "error", err)
+	}
+}
+
+// postAlert gửi payload tới Alert Service; retry cho biết lỗi có nên thử lại hay không
+func postAlert(ctx context.Context, payload string) (retry bool, err error) {
+	ctx, cancel := context.WithTimeout(ctx, alertClient.HTTPClient.Timeout)
+	defer cancel()
+
+	_, err = alertClient.Post(ctx, []byte(payload))
+	var apiErr *alertapi.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Retryable(), err
+	}
+	return err != nil, err
+}
+
+// handoffBackoff tăng thời gian chờ theo lũy thừa 2, tối đa handoffMaxBackoff
+func handoffBackoff(attempts int) time.Duration {
+	backoff := handoffMinBackoff << (attempts - 1)
+	if backoff <= 0 || backoff > handoffMaxBackoff {
+		return handoffMaxBackoff
+	}
+	return backoff
+}
@@ -0,0 +1,516 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xuri/excelize/v2"
+)
+
+// RecognitionEvent là một lần người dùng được nhận diện tại thiết bị
+type RecognitionEvent struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	UserID     uint      `gorm:"index:idx_recognition_user_time" json:"user_id"`
+	DeviceID   string    `gorm:"index" json:"device_id"`
+	Similarity float64   `json:"similarity"`
+	Timestamp  time.Time `gorm:"index:idx_recognition_user_time" json:"timestamp"`
+}
+
+// Shift là ca làm việc dùng để đánh giá đi muộn, về sớm
+type Shift struct {
+	ID                     uint   `gorm:"primaryKey" json:"id"`
+	Name                   string `json:"name"`
+	StartTime              string `json:"start_time"` // Định dạng "HH:MM" theo giờ địa phương của địa điểm
+	EndTime                string `json:"end_time"`   // Định dạng "HH:MM", sớm hơn StartTime là ca qua đêm
+	LateGraceMinutes       int    `json:"late_grace_minutes"`
+	EarlyLeaveGraceMinutes int    `json:"early_leave_grace_minutes"`
+}
+
+// AttendanceRecord là kết quả chấm công của một người trong một ngày
+type AttendanceRecord struct {
+	UserID      uint       `json:"user_id"`
+	Name        string     `json:"name"`
+	Date        string     `json:"date"`
+	Shift       string     `json:"shift,omitempty"`
+	CheckIn     *time.Time `json:"check_in"`
+	CheckOut    *time.Time `json:"check_out"`
+	WorkedHours float64    `json:"worked_hours"`
+	Present     bool       `json:"present"`
+	Late        bool       `json:"late"`
+	EarlyLeave  bool       `json:"early_leave"`
+}
+
+// MonthlyAttendance là tổng hợp chấm công của một người trong tháng
+type MonthlyAttendance struct {
+	UserID           uint    `json:"user_id"`
+	Name             string  `json:"name"`
+	Month            string  `json:"month"`
+	DaysPresent      int     `json:"days_present"`
+	LateDays         int     `json:"late_days"`
+	EarlyLeaveDays   int     `json:"early_leave_days"`
+	TotalWorkedHours float64 `json:"total_worked_hours"`
+}
+
+// parseClock chuyển chuỗi "HH:MM" thành thời điểm trong ngày day
+func parseClock(day time.Time, clock string) (time.Time, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Date(day.Year(), day.Month(), day.Day(), t.Hour(), t.Minute(), 0, 0, day.Location()), nil
+}
+
+// validate kiểm tra cấu hình ca làm việc
+func (s *Shift) validate() error {
+	day := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	start, err := parseClock(day, s.StartTime)
+	if err != nil {
+		return errors.New("invalid start_time")
+	}
+	end, err := parseClock(day, s.EndTime)
+	if err != nil {
+		return errors.New("invalid end_time")
+	}
+	if end.Equal(start) {
+		return errors.New("end_time must differ from start_time")
+	}
+	if s.LateGraceMinutes < 0 || s.EarlyLeaveGraceMinutes < 0 {
+		return errors.New("grace minutes must not be negative")
+	}
+	return nil
+}
+
+// shiftWindow là giờ bắt đầu, kết thúc của một ca và khoảng thời gian lấy lượt nhận diện để chấm công ca đó
+type shiftWindow struct {
+	start, end time.Time // Ca qua đêm kết thúc vào ngày hôm sau
+	from, to   time.Time // Lượt nhận diện trong [from, to) được tính cho ca
+}
+
+// window trả về khung giờ của ca bắt đầu vào ngày day. Khoảng nghỉ giữa hai ca liên tiếp được chia đôi:
+// nửa trước giờ vào ca tính cho ca này (đến sớm), nửa sau giờ tan ca cũng tính cho ca này (về muộn),
+// nên ca qua đêm không bị tách làm hai ngày.
+func (s *Shift) window(day time.Time) shiftWindow {
+	start, _ := parseClock(day, s.StartTime)
+	end, _ := parseClock(day, s.EndTime)
+	if !end.After(start) {
+		end = end.AddDate(0, 0, 1)
+	}
+	gap := 24*time.Hour - end.Sub(start)
+	from := start.Add(-gap / 2)
+	return shiftWindow{start: start, end: end, from: from, to: from.Add(24 * time.Hour)}
+}
+
+// calendarWindow là khoảng thời gian chấm công của người không có ca: cả ngày day theo lịch
+func calendarWindow(day time.Time) shiftWindow {
+	from := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+	return shiftWindow{from: from, to: from.AddDate(0, 0, 1)}
+}
+
+// recordRecognitionEvent lưu lại lượt nhận diện để phục vụ chấm công
+func recordRecognitionEvent(userID uint, device *Device, similarity float64, at time.Time) error {
+	event := RecognitionEvent{
+		UserID:     userID,
+		DeviceID:   deviceID(device),
+		Similarity: similarity,
+		Timestamp:  at,
+	}
+	return db.Create(&event).Error
+}
+
+// attendanceScope xác định địa điểm và múi giờ của báo cáo từ query site_id
+func attendanceScope(c *gin.Context) (*Site, *time.Location, bool) {
+	siteID := c.Query("site_id")
+	if siteID == "" {
+		loc, err := time.LoadLocation(defaultTimezone)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load timezone"})
+			return nil, nil, false
+		}
+		return nil, loc, true
+	}
+
+	var site Site
+	if err := db.First(&site, siteID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Site not found"})
+		return nil, nil, false
+	}
+	loc, err := site.location()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid site timezone"})
+		return nil, nil, false
+	}
+	return &site, loc, true
+}
+
+// userShift trả về ca của người dùng, nil nếu không có ca
+func userShift(u User, shifts map[uint]Shift) *Shift {
+	if u.ShiftID == nil {
+		return nil
+	}
+	if shift, ok := shifts[*u.ShiftID]; ok {
+		return &shift
+	}
+	return nil
+}
+
+// attendanceWindow trả về khoảng thời gian chấm công của người dùng cho ngày day
+func attendanceWindow(day time.Time, shift *Shift) shiftWindow {
+	if shift == nil {
+		return calendarWindow(day)
+	}
+	return shift.window(day)
+}
+
+// loadSightings lấy mọi lượt nhận diện trong [from, to) bằng một truy vấn, nhóm theo người dùng và sắp theo thời gian
+func loadSightings(site *Site, from, to time.Time) (map[uint][]time.Time, error) {
+	query := db.Model(&RecognitionEvent{}).Select("user_id, timestamp").
+		Where("timestamp >= ? AND timestamp < ?", from, to).Order("timestamp")
+	if site != nil {
+		query = query.Where("device_id IN (?)", db.Model(&Device{}).Select("id").Where("site_id = ?", site.ID))
+	}
+	var events []RecognitionEvent
+	if err := query.Find(&events).Error; err != nil {
+		return nil, err
+	}
+
+	sightings := make(map[uint][]time.Time)
+	for _, e := range events {
+		sightings[e.UserID] = append(sightings[e.UserID], e.Timestamp)
+	}
+	return sightings, nil
+}
+
+// computeAttendance tính chấm công cho từng ngày trong days, kết quả theo cùng thứ tự với days.
+// Lượt nhận diện của cả khoảng thời gian được lấy trong một truy vấn.
+func computeAttendance(site *Site, days []time.Time, users []User, shifts map[uint]Shift) ([][]AttendanceRecord, error) {
+	if len(days) == 0 {
+		return nil, nil
+	}
+
+	var from, to time.Time
+	for _, day := range days {
+		for _, u := range users {
+			w := attendanceWindow(day, userShift(u, shifts))
+			if from.IsZero() || w.from.Before(from) {
+				from = w.from
+			}
+			if w.to.After(to) {
+				to = w.to
+			}
+		}
+	}
+	sightings, err := loadSightings(site, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([][]AttendanceRecord, len(days))
+	for i, day := range days {
+		results[i] = buildAttendance(day, users, shifts, sightings, time.Now())
+	}
+	return results, nil
+}
+
+// computeDailyAttendance tính chấm công của từng người cho ngày day (theo múi giờ của day)
+func computeDailyAttendance(site *Site, day time.Time, users []User, shifts map[uint]Shift) ([]AttendanceRecord, error) {
+	results, err := computeAttendance(site, []time.Time{day}, users, shifts)
+	if err != nil {
+		return nil, err
+	}
+	return results[0], nil
+}
+
+// buildAttendance suy ra giờ vào/ra của từng người trong ngày day từ các lượt nhận diện đã sắp xếp.
+// Lượt đầu tiên trong khoảng chấm công là check-in, lượt cuối cùng là check-out; với người có ca,
+// khoảng chấm công bám theo giờ vào ca nên ca qua đêm được tính trọn cho ngày bắt đầu ca.
+func buildAttendance(day time.Time, users []User, shifts map[uint]Shift, sightings map[uint][]time.Time, now time.Time) []AttendanceRecord {
+	loc := day.Location()
+	records := make([]AttendanceRecord, 0, len(users))
+	for _, u := range users {
+		shift := userShift(u, shifts)
+		w := attendanceWindow(day, shift)
+		record := AttendanceRecord{
+			UserID: u.ID,
+			Name:   u.Name,
+			Date:   day.Format("2006-01-02"),
+		}
+
+		seen := sightings[u.ID]
+		lo := sort.Search(len(seen), func(i int) bool { return !seen[i].Before(w.from) })
+		hi := sort.Search(len(seen), func(i int) bool { return !seen[i].Before(w.to) })
+		if lo < hi {
+			checkIn := seen[lo].In(loc)
+			checkOut := seen[hi-1].In(loc)
+			record.Present = true
+			record.CheckIn = &checkIn
+			if checkOut.After(checkIn) {
+				record.CheckOut = &checkOut
+				record.WorkedHours = checkOut.Sub(checkIn).Hours()
+			}
+		}
+
+		if shift != nil {
+			record.Shift = shift.Name
+			if record.CheckIn != nil {
+				record.Late = record.CheckIn.After(w.start.Add(time.Duration(shift.LateGraceMinutes) * time.Minute))
+				// Chỉ đánh giá về sớm khi ca đã kết thúc
+				if now.After(w.end) {
+					checkOut := record.CheckIn
+					if record.CheckOut != nil {
+						checkOut = record.CheckOut
+					}
+					record.EarlyLeave = checkOut.Before(w.end.Add(-time.Duration(shift.EarlyLeaveGraceMinutes) * time.Minute))
+				}
+			}
+		}
+
+		records = append(records, record)
+	}
+	return records
+}
+
+// loadAttendanceSubjects lấy danh sách người dùng và ca làm việc cho báo cáo
+func loadAttendanceSubjects() ([]User, map[uint]Shift, error) {
+	var users []User
+	if err := db.Order("id").Find(&users).Error; err != nil {
+		return nil, nil, err
+	}
+	var shiftList []Shift
+	if err := db.Find(&shiftList).Error; err != nil {
+		return nil, nil, err
+	}
+	shifts := make(map[uint]Shift, len(shiftList))
+	for _, s := range shiftList {
+		shifts[s.ID] = s
+	}
+	return users, shifts, nil
+}
+
+// formatClock định dạng giờ vào/ra cho file xuất, rỗng nếu không có
+func formatClock(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format("15:04:05")
+}
+
+// writeReport xuất bảng báo cáo theo định dạng json, csv hoặc xlsx
+func writeReport(c *gin.Context, filename string, data interface{}, header []string, rows [][]string) {
+	switch c.DefaultQuery("format", "json") {
+	case "json":
+		c.JSON(http.StatusOK, data)
+	case "csv":
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.csv", filename))
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		w := csv.NewWriter(c.Writer)
+		w.Write(header)
+		w.WriteAll(rows)
+		if err := w.Error(); err != nil {
+			slog.ErrorContext(c.Request.Context(), "Error writing CSV report", "error", err)
+		}
+	case "xlsx":
+		f := excelize.NewFile()
+		defer f.Close()
+		sheet := f.GetSheetName(0)
+		for i, row := range append([][]string{header}, rows...) {
+			cell, _ := excelize.CoordinatesToCellName(1, i+1)
+			values := make([]interface{}, len(row))
+			for j, v := range row {
+				values[j] = v
+			}
+			if err := f.SetSheetRow(sheet, cell, &values); err != nil {
+				slog.ErrorContext(c.Request.Context(), "Error writing XLSX report", "error", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build report"})
+				return
+			}
+		}
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.xlsx", filename))
+		c.Header("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		if err := f.Write(c.Writer); err != nil {
+			slog.ErrorContext(c.Request.Context(), "Error writing XLSX report", "error", err)
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported format, use json, csv or xlsx"})
+	}
+}
+
+// getDailyAttendanceHandler báo cáo chấm công theo ngày
+func getDailyAttendanceHandler(c *gin.Context) {
+	site, loc, ok := attendanceScope(c)
+	if !ok {
+		return
+	}
+
+	day := time.Now().In(loc)
+	if date := c.Query("date"); date != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", date, loc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date, expected YYYY-MM-DD"})
+			return
+		}
+		day = parsed
+	}
+
+	users, shifts, err := loadAttendanceSubjects()
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error loading users and shifts", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	records, err := computeDailyAttendance(site, day, users, shifts)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error computing daily attendance", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	header := []string{"user_id", "name", "date", "shift", "check_in", "check_out", "worked_hours", "present", "late", "early_leave"}
+	rows := make([][]string, 0, len(records))
+	for _, r := range records {
+		rows = append(rows, []string{
+			strconv.FormatUint(uint64(r.UserID), 10),
+			r.Name,
+			r.Date,
+			r.Shift,
+			formatClock(r.CheckIn),
+			formatClock(r.CheckOut),
+			strconv.FormatFloat(r.WorkedHours, 'f', 2, 64),
+			strconv.FormatBool(r.Present),
+			strconv.FormatBool(r.Late),
+			strconv.FormatBool(r.EarlyLeave),
+		})
+	}
+	writeReport(c, "attendance_"+day.Format("2006-01-02"), records, header, rows)
+}
+
+// getMonthlyAttendanceHandler báo cáo tổng hợp chấm công theo tháng
+func getMonthlyAttendanceHandler(c *gin.Context) {
+	site, loc, ok := attendanceScope(c)
+	if !ok {
+		return
+	}
+
+	now := time.Now().In(loc)
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc)
+	if m := c.Query("month"); m != "" {
+		parsed, err := time.ParseInLocation("2006-01", m, loc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid month, expected YYYY-MM"})
+			return
+		}
+		month = parsed
+	}
+
+	users, shifts, err := loadAttendanceSubjects()
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error loading users and shifts", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	summaries := make([]MonthlyAttendance, len(users))
+	for i, u := range users {
+		summaries[i] = MonthlyAttendance{UserID: u.ID, Name: u.Name, Month: month.Format("2006-01")}
+	}
+
+	var days []time.Time
+	for day := month; day.Month() == month.Month() && !day.After(now); day = day.AddDate(0, 0, 1) {
+		days = append(days, day)
+	}
+	results, err := computeAttendance(site, days, users, shifts)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error computing monthly attendance", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	for _, records := range results {
+		for i, r := range records {
+			if !r.Present {
+				continue
+			}
+			summaries[i].DaysPresent++
+			summaries[i].TotalWorkedHours += r.WorkedHours
+			if r.Late {
+				summaries[i].LateDays++
+			}
+			if r.EarlyLeave {
+				summaries[i].EarlyLeaveDays++
+			}
+		}
+	}
+
+	header := []string{"user_id", "name", "month", "days_present", "late_days", "early_leave_days", "total_worked_hours"}
+	rows := make([][]string, 0, len(summaries))
+	for _, s := range summaries {
+		rows = append(rows, []string{
+			strconv.FormatUint(uint64(s.UserID), 10),
+			s.Name,
+			s.Month,
+			strconv.Itoa(s.DaysPresent),
+			strconv.Itoa(s.LateDays),
+			strconv.Itoa(s.EarlyLeaveDays),
+			strconv.FormatFloat(s.TotalWorkedHours, 'f', 2, 64),
+		})
+	}
+	writeReport(c, "attendance_"+month.Format("2006-01"), summaries, header, rows)
+}
+
+// getShiftsHandler lấy danh sách ca làm việc
+func getShiftsHandler(c *gin.Context) {
+	var shifts []Shift
+	if err := db.Order("id").Find(&shifts).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error fetching shifts from database", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, shifts)
+}
+
+// saveShiftHandler tạo mới hoặc cập nhật ca làm việc
+func saveShiftHandler(c *gin.Context) {
+	var shift Shift
+	if err := c.ShouldBindJSON(&shift); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if id := c.Param("id"); id != "" {
+		if _, err := fmt.Sscan(id, &shift.ID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid shift id"})
+			return
+		}
+	}
+	if err := shift.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := db.Save(&shift).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error saving shift", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save shift"})
+		return
+	}
+	c.JSON(http.StatusOK, shift)
+}
+
+// deleteShiftHandler xóa ca làm việc và gỡ ca khỏi người dùng
+func deleteShiftHandler(c *gin.Context) {
+	shiftID := c.Param("id")
+
+	if err := db.Model(&User{}).Where("shift_id = ?", shiftID).Update("shift_id", nil).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to detach users"})
+		return
+	}
+	if err := db.Delete(&Shift{}, shiftID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete shift"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Shift deleted successfully"})
+}
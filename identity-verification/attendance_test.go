@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestShiftValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		shift   Shift
+		wantErr bool
+	}{
+		{"day shift", Shift{StartTime: "08:00", EndTime: "17:00"}, false},
+		{"night shift", Shift{StartTime: "22:00", EndTime: "06:00"}, false},
+		{"zero length", Shift{StartTime: "08:00", EndTime: "08:00"}, true},
+		{"invalid clock", Shift{StartTime: "8h", EndTime: "17:00"}, true},
+		{"negative grace", Shift{StartTime: "08:00", EndTime: "17:00", LateGraceMinutes: -1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.shift.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBuildAttendanceNightShift(t *testing.T) {
+	loc := time.FixedZone("ICT", 7*3600)
+	at := func(day, hour, min int) time.Time { return time.Date(2026, 3, day, hour, min, 0, 0, loc) }
+
+	shiftID := uint(1)
+	shifts := map[uint]Shift{shiftID: {ID: shiftID, Name: "Night", StartTime: "22:00", EndTime: "06:00", LateGraceMinutes: 5}}
+	users := []User{{ID: 7, Name: "Guard", ShiftID: &shiftID}}
+	sightings := map[uint][]time.Time{
+		// Ca đêm 10/3: vào 21:55, ra 06:02 sáng 11/3
+		// Ca đêm 11/3: vào muộn 22:20, về sớm 05:00 sáng 12/3
+		7: {at(10, 21, 55), at(11, 2, 0), at(11, 6, 2), at(11, 22, 20), at(12, 5, 0)},
+	}
+	now := at(15, 0, 0)
+
+	first := buildAttendance(at(10, 0, 0), users, shifts, sightings, now)[0]
+	if !first.Present || first.Late || first.EarlyLeave {
+		t.Fatalf("10/3: present=%v late=%v early_leave=%v, want true false false", first.Present, first.Late, first.EarlyLeave)
+	}
+	if !first.CheckIn.Equal(at(10, 21, 55)) || !first.CheckOut.Equal(at(11, 6, 2)) {
+		t.Errorf("10/3: check in/out = %v/%v, want 21:55 to 06:02 next day", first.CheckIn, first.CheckOut)
+	}
+
+	second := buildAttendance(at(11, 0, 0), users, shifts, sightings, now)[0]
+	if !second.Late || !second.EarlyLeave {
+		t.Errorf("11/3: late=%v early_leave=%v, want true true", second.Late, second.EarlyLeave)
+	}
+	if !second.CheckIn.Equal(at(11, 22, 20)) {
+		t.Errorf("11/3: check in = %v, want 22:20 (06:02 belongs to the previous shift)", second.CheckIn)
+	}
+}
+
+func TestBuildAttendanceWithoutShiftUsesCalendarDay(t *testing.T) {
+	loc := time.FixedZone("ICT", 7*3600)
+	day := time.Date(2026, 3, 10, 0, 0, 0, 0, loc)
+	users := []User{{ID: 3, Name: "Staff"}}
+	sightings := map[uint][]time.Time{
+		3: {day.Add(-time.Hour), day.Add(8 * time.Hour), day.Add(17 * time.Hour), day.Add(25 * time.Hour)},
+	}
+
+	r := buildAttendance(day, users, nil, sightings, day.AddDate(0, 0, 2))[0]
+	if !r.CheckIn.Equal(day.Add(8*time.Hour)) || !r.CheckOut.Equal(day.Add(17*time.Hour)) || r.WorkedHours != 9 {
+		t.Errorf("got check in %v, check out %v, %.1fh; want 08:00 to 17:00, 9h", r.CheckIn, r.CheckOut, r.WorkedHours)
+	}
+}
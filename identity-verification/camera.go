@@ -0,0 +1,571 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// defaultSampleFPS là số khung hình xử lý mỗi giây khi thiết bị không cấu hình
+	defaultSampleFPS = 2.0
+	// cameraReloadInterval là chu kỳ đọc lại danh sách camera từ cơ sở dữ liệu
+	cameraReloadInterval = 30 * time.Second
+	// maxJPEGFrameSize giới hạn kích thước một khung hình JPEG
+	maxJPEGFrameSize = 8 << 20
+)
+
+// Thời gian chờ kết nối lại camera; là biến để test rút ngắn
+var (
+	// cameraStallTimeout là thời gian tối đa không nhận được khung hình trước khi kết nối lại
+	cameraStallTimeout = 15 * time.Second
+	cameraMinBackoff   = time.Second
+	cameraMaxBackoff   = 30 * time.Second
+)
+
+// Các trạng thái kết nối của camera
+const (
+	CameraConnecting   = "connecting"
+	CameraStreaming    = "streaming"
+	CameraReconnecting = "reconnecting"
+)
+
+// CameraHealth là tình trạng thu nhận của một camera
+type CameraHealth struct {
+	DeviceID        string     `json:"device_id"`
+	StreamURL       string     `json:"stream_url"`
+	Status          string     `json:"status"`
+	ConnectedAt     *time.Time `json:"connected_at"`
+	LastFrameAt     *time.Time `json:"last_frame_at"`
+	LastError       string     `json:"last_error,omitempty"`
+	LastErrorAt     *time.Time `json:"last_error_at,omitempty"`
+	Reconnects      int        `json:"reconnects"`
+	FramesReceived  int64      `json:"frames_received"`
+	FramesProcessed int64      `json:"frames_processed"`
+	Decisions       int64      `json:"decisions"`
+}
+
+// frameSource đọc lần lượt các khung hình JPEG từ luồng camera
+type frameSource interface {
+	Next() ([]byte, error)
+	Close() error
+}
+
+// cameraWorker thu nhận khung hình từ một camera và đưa vào luồng xác thực
+type cameraWorker struct {
+	device Device
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu     sync.Mutex
+	health CameraHealth
+
+	framesReceived  atomic.Int64
+	framesProcessed atomic.Int64
+	decisions       atomic.Int64
+}
+
+// cameraManager quản lý các worker thu nhận theo cấu hình thiết bị
+type cameraManager struct {
+	mu      sync.Mutex
+	workers map[string]*cameraWorker
+}
+
+var cameras = &cameraManager{workers: make(map[string]*cameraWorker)}
+
+// run đồng bộ worker với danh sách thiết bị có stream_url theo chu kỳ, dừng mọi camera khi dịch vụ tắt
+func (m *cameraManager) run() {
+	ticker := time.NewTicker(cameraReloadInterval)
+	defer ticker.Stop()
+	for {
+		m.reload()
+		select {
+		case <-ticker.C:
+		case <-app.Stopping():
+			m.stopAll()
+			return
+		}
+	}
+}
+
+// stopAll dừng tất cả worker camera và chờ khung hình đang xử lý xong
+func (m *cameraManager) stopAll() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, w := range m.workers {
+		w.stop()
+		delete(m.workers, id)
+	}
+}
+
+// reload khởi động worker cho camera mới, khởi động lại camera đổi cấu hình và dừng camera đã gỡ
+func (m *cameraManager) reload() {
+	var devices []Device
+	if err := db.Where("stream_url <> ''").Find(&devices).Error; err != nil {
+		slog.Error("Error loading camera devices", "error", err)
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	wanted := make(map[string]bool, len(devices))
+	for _, d := range devices {
+		wanted[d.ID] = true
+		if w, ok := m.workers[d.ID]; ok {
+			if w.device.StreamURL == d.StreamURL && w.device.SampleFPS == d.SampleFPS && w.device.Zone == d.Zone {
+				continue
+			}
+			w.stop()
+		}
+		m.workers[d.ID] = startCameraWorker(d)
+	}
+
+	for id, w := range m.workers {
+		if !wanted[id] {
+			w.stop()
+			delete(m.workers, id)
+		}
+	}
+}
+
+// healthReport trả về tình trạng của tất cả camera
+func (m *cameraManager) healthReport() []CameraHealth {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	report := make([]CameraHealth, 0, len(m.workers))
+	for _, w := range m.workers {
+		report = append(report, w.snapshot())
+	}
+	sort.Slice(report, func(i, j int) bool { return report[i].DeviceID < report[j].DeviceID })
+	return report
+}
+
+// startCameraWorker khởi chạy worker cho một camera
+func startCameraWorker(device Device) *cameraWorker {
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &cameraWorker{
+		device: device,
+		cancel: cancel,
+		done:   make(chan struct{}),
+		health: CameraHealth{
+			DeviceID:  device.ID,
+			StreamURL: redactStreamURL(device.StreamURL),
+			Status:    CameraConnecting,
+		},
+	}
+	go w.run(ctx)
+	return w
+}
+
+// stop dừng worker và chờ kết nối được đóng
+func (w *cameraWorker) stop() {
+	w.cancel()
+	<-w.done
+}
+
+// snapshot trả về bản sao tình trạng hiện tại của camera
+func (w *cameraWorker) snapshot() CameraHealth {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	h := w.health
+	h.FramesReceived = w.framesReceived.Load()
+	h.FramesProcessed = w.framesProcessed.Load()
+	h.Decisions = w.decisions.Load()
+	return h
+}
+
+// setStatus cập nhật trạng thái kết nối, ghi nhận lỗi nếu có
+func (w *cameraWorker) setStatus(status string, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	now := time.Now()
+	w.health.Status = status
+	switch status {
+	case CameraStreaming:
+		w.health.ConnectedAt = &now
+	case CameraReconnecting:
+		w.health.Reconnects++
+	}
+	if err != nil {
+		w.health.LastError = err.Error()
+		w.health.LastErrorAt = &now
+	}
+}
+
+// sampleFPS trả về tốc độ lấy mẫu của camera
+func (w *cameraWorker) sampleFPS() float64 {
+	if w.device.SampleFPS > 0 {
+		return w.device.SampleFPS
+	}
+	return defaultSampleFPS
+}
+
+// run kết nối tới camera và tự kết nối lại với backoff tăng dần khi lỗi
+func (w *cameraWorker) run(ctx context.Context) {
+	defer close(w.done)
+
+	backoff := cameraMinBackoff
+	for {
+		w.setStatus(CameraConnecting, nil)
+		streamed, err := w.stream(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if streamed {
+			backoff = cameraMinBackoff
+		}
+
+		slog.Warn("Camera disconnected, reconnecting", "device_id", w.device.ID, "error", err, "backoff", backoff.String())
+		w.setStatus(CameraReconnecting, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, cameraMaxBackoff)
+	}
+}
+
+// stream đọc khung hình cho tới khi luồng lỗi hoặc bị dừng.
+// Trả về true nếu đã nhận được ít nhất một khung hình.
+func (w *cameraWorker) stream(ctx context.Context) (bool, error) {
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	fps := w.sampleFPS()
+	src, err := openFrameSource(streamCtx, w.device.StreamURL, fps)
+	if err != nil {
+		return false, err
+	}
+	defer src.Close()
+
+	// Camera treo không gửi khung hình thì hủy kết nối để kết nối lại
+	stalled := atomic.Bool{}
+	watchdog := time.AfterFunc(cameraStallTimeout, func() {
+		stalled.Store(true)
+		cancel()
+	})
+	defer watchdog.Stop()
+
+	interval := time.Duration(float64(time.Second) / fps)
+	var track faceTrack
+	var lastProcessed time.Time
+	streamed := false
+
+	for {
+		frame, err := src.Next()
+		if err != nil {
+			if stalled.Load() {
+				err = fmt.Errorf("no frame received for %s", cameraStallTimeout)
+			}
+			return streamed, err
+		}
+		watchdog.Reset(cameraStallTimeout)
+		w.framesReceived.Add(1)
+
+		now := time.Now()
+		w.mu.Lock()
+		w.health.LastFrameAt = &now
+		w.mu.Unlock()
+		if !streamed {
+			streamed = true
+			w.setStatus(CameraStreaming, nil)
+		}
+
+		// Lấy mẫu theo sample_fps, bỏ qua các khung hình ở giữa
+		if now.Sub(lastProcessed) < interval {
+			continue
+		}
+		lastProcessed = now
+
+		msg := processFrame(ctx, &track, &w.device, frame)
+		w.framesProcessed.Add(1)
+		switch msg.Type {
+		case "decision":
+			w.decisions.Add(1)
+			slog.Info("Camera decision", "device_id", w.device.ID, "match", msg.Result.Match, "similarity", msg.Result.Similarity)
+		case "error":
+			slog.Warn("Camera frame error", "device_id", w.device.ID, "error", msg.Error)
+		}
+	}
+}
+
+// openFrameSource mở luồng camera theo scheme của URL
+func openFrameSource(ctx context.Context, streamURL string, fps float64) (frameSource, error) {
+	u, err := url.Parse(streamURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stream url: %w", err)
+	}
+	switch u.Scheme {
+	case "rtsp", "rtsps":
+		return openFFmpegSource(ctx, streamURL, fps)
+	case "http", "https":
+		return openHTTPSource(ctx, streamURL, fps)
+	default:
+		return nil, fmt.Errorf("unsupported stream scheme %q", u.Scheme)
+	}
+}
+
+// redactStreamURL ẩn mật khẩu trong URL camera trước khi hiển thị
+func redactStreamURL(streamURL string) string {
+	u, err := url.Parse(streamURL)
+	if err != nil {
+		return ""
+	}
+	return u.Redacted()
+}
+
+// mjpegSource đọc khung hình từ luồng multipart/x-mixed-replace
+type mjpegSource struct {
+	body   io.ReadCloser
+	reader *multipart.Reader
+}
+
+func (s *mjpegSource) Next() ([]byte, error) {
+	part, err := s.reader.NextPart()
+	if err != nil {
+		return nil, err
+	}
+	defer part.Close()
+	return readLimited(part)
+}
+
+func (s *mjpegSource) Close() error {
+	return s.body.Close()
+}
+
+// snapshotSource lấy khung hình bằng cách gọi lại URL ảnh tĩnh (snapshot.jpg) theo fps
+type snapshotSource struct {
+	ctx      context.Context
+	url      string
+	interval time.Duration
+	first    []byte
+	last     time.Time
+}
+
+func (s *snapshotSource) Next() ([]byte, error) {
+	if s.first != nil {
+		frame := s.first
+		s.first = nil
+		s.last = time.Now()
+		return frame, nil
+	}
+
+	select {
+	case <-s.ctx.Done():
+		return nil, s.ctx.Err()
+	case <-time.After(time.Until(s.last.Add(s.interval))):
+	}
+	s.last = time.Now()
+
+	resp, err := httpGetStream(s.ctx, s.url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return readLimited(resp.Body)
+}
+
+func (s *snapshotSource) Close() error {
+	return nil
+}
+
+// httpGetStream gửi yêu cầu GET tới camera và kiểm tra mã trạng thái
+func httpGetStream(ctx context.Context, streamURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, streamURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("camera returned status %s", resp.Status)
+	}
+	return resp, nil
+}
+
+// openHTTPSource mở luồng MJPEG qua HTTP, hoặc chế độ ảnh tĩnh nếu camera trả về image/jpeg
+func openHTTPSource(ctx context.Context, streamURL string, fps float64) (frameSource, error) {
+	resp, err := httpGetStream(ctx, streamURL)
+	if err != nil {
+		return nil, err
+	}
+
+	mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil {
+		resp.Body.Close()
+		return nil, fmt.Errorf("invalid content type: %w", err)
+	}
+
+	switch {
+	case strings.HasPrefix(mediaType, "multipart/"):
+		boundary := strings.TrimPrefix(params["boundary"], "--")
+		if boundary == "" {
+			resp.Body.Close()
+			return nil, errors.New("missing multipart boundary")
+		}
+		return &mjpegSource{body: resp.Body, reader: multipart.NewReader(resp.Body, boundary)}, nil
+	case mediaType == "image/jpeg":
+		defer resp.Body.Close()
+		first, err := readLimited(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		return &snapshotSource{
+			ctx:      ctx,
+			url:      streamURL,
+			interval: time.Duration(float64(time.Second) / fps),
+			first:    first,
+		}, nil
+	default:
+		resp.Body.Close()
+		return nil, fmt.Errorf("unsupported content type %q", mediaType)
+	}
+}
+
+// ffmpegSource giải mã luồng RTSP bằng ffmpeg, xuất chuỗi ảnh JPEG qua stdout
+type ffmpegSource struct {
+	cmd    *exec.Cmd
+	reader *bufio.Reader
+	stderr *lockedBuffer
+}
+
+// lockedBuffer gom stderr của ffmpeg, an toàn khi đọc trong lúc tiến trình đang ghi
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// ffmpegPath trả về đường dẫn ffmpeg, có thể cấu hình qua FFMPEG_PATH
+func ffmpegPath() string {
+	if path := os.Getenv("FFMPEG_PATH"); path != "" {
+		return path
+	}
+	return "ffmpeg"
+}
+
+// openFFmpegSource khởi chạy ffmpeg để lấy mẫu luồng RTSP theo fps
+func openFFmpegSource(ctx context.Context, streamURL string, fps float64) (frameSource, error) {
+	cmd := exec.CommandContext(ctx, ffmpegPath(),
+		"-loglevel", "error",
+		"-rtsp_transport", "tcp",
+		"-i", streamURL,
+		"-vf", fmt.Sprintf("fps=%g", fps),
+		"-f", "image2pipe",
+		"-c:v", "mjpeg",
+		"-q:v", "5",
+		"-",
+	)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr := &lockedBuffer{}
+	cmd.Stderr = stderr
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start ffmpeg: %w", err)
+	}
+	return &ffmpegSource{cmd: cmd, reader: bufio.NewReader(stdout), stderr: stderr}, nil
+}
+
+func (s *ffmpegSource) Next() ([]byte, error) {
+	frame, err := readJPEG(s.reader)
+	if err != nil {
+		if msg := strings.TrimSpace(s.stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%w: %s", err, msg)
+		}
+	}
+	return frame, err
+}
+
+func (s *ffmpegSource) Close() error {
+	if s.cmd.Process != nil {
+		s.cmd.Process.Kill()
+	}
+	return s.cmd.Wait()
+}
+
+// readJPEG tách một ảnh JPEG (từ SOI 0xFFD8 tới EOI 0xFFD9) khỏi luồng byte
+func readJPEG(r *bufio.Reader) ([]byte, error) {
+	var prev byte
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if prev == 0xFF && b == 0xD8 {
+			break
+		}
+		prev = b
+	}
+
+	frame := []byte{0xFF, 0xD8}
+	prev = 0
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		frame = append(frame, b)
+		if prev == 0xFF && b == 0xD9 {
+			return frame, nil
+		}
+		if len(frame) > maxJPEGFrameSize {
+			return nil, errors.New("jpeg frame too large")
+		}
+		prev = b
+	}
+}
+
+// readLimited đọc một khung hình, từ chối khung vượt quá maxJPEGFrameSize
+func readLimited(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxJPEGFrameSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxJPEGFrameSize {
+		return nil, errors.New("jpeg frame too large")
+	}
+	return data, nil
+}
+
+// getCameraHealthHandler trả về tình trạng kết nối và thu nhận của các camera
+func getCameraHealthHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, cameras.healthReport())
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testJPEG dựng một khung hình JPEG giả (SOI ... EOI) có nội dung riêng
+func testJPEG(content string) []byte {
+	return append(append([]byte{0xFF, 0xD8}, content...), 0xFF, 0xD9)
+}
+
+// mjpegPart là một phần của luồng multipart/x-mixed-replace với boundary "frame"
+func mjpegPart(frame []byte) []byte {
+	header := fmt.Sprintf("--frame\r\nContent-Type: image/jpeg\r\nContent-Length: %d\r\n\r\n", len(frame))
+	return append(append([]byte(header), frame...), "\r\n"...)
+}
+
+// writeChunked ghi data thành từng đoạn nhỏ và flush sau mỗi đoạn để boundary bị cắt ngang giữa các lần đọc
+func writeChunked(w http.ResponseWriter, data []byte, size int) {
+	for len(data) > 0 {
+		n := min(size, len(data))
+		w.Write(data[:n])
+		w.(http.Flusher).Flush()
+		data = data[n:]
+	}
+}
+
+func TestReadJPEG(t *testing.T) {
+	first, second := testJPEG("frame-1 \xFF\x00 escaped"), testJPEG("frame-2")
+	stream := append(append([]byte("garbage\xFF"), first...), append([]byte("\r\n--ffmpeg\r\n"), second...)...)
+	r := bufio.NewReaderSize(bytes.NewReader(stream), 16)
+
+	for i, want := range [][]byte{first, second} {
+		got, err := readJPEG(r)
+		if err != nil {
+			t.Fatalf("frame %d: readJPEG() = %v", i+1, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("frame %d = %q, want %q", i+1, got, want)
+		}
+	}
+	if _, err := readJPEG(r); err != io.EOF {
+		t.Errorf("readJPEG() at end of stream = %v, want EOF", err)
+	}
+
+	// Khung hình bị cắt giữa chừng (ffmpeg thoát) không được trả về như khung hợp lệ
+	truncated := testJPEG("frame-3")
+	if _, err := readJPEG(bufio.NewReader(bytes.NewReader(truncated[:len(truncated)-1]))); err != io.EOF {
+		t.Errorf("readJPEG() on truncated frame = %v, want EOF", err)
+	}
+
+	huge := append([]byte{0xFF, 0xD8}, make([]byte, maxJPEGFrameSize)...)
+	if _, err := readJPEG(bufio.NewReader(bytes.NewReader(huge))); err == nil || err.Error() != "jpeg frame too large" {
+		t.Errorf("readJPEG() on oversized frame = %v", err)
+	}
+}
+
+func TestMJPEGSource(t *testing.T) {
+	frames := [][]byte{testJPEG("frame-1"), testJPEG("frame-2 \r\n--fram not a boundary"), testJPEG("frame-3")}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Nhiều camera khai báo boundary kèm "--"
+		w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary=--frame")
+		var body []byte
+		for _, frame := range frames {
+			body = append(body, mjpegPart(frame)...)
+		}
+		writeChunked(w, body, 5)
+
+		// Camera rớt mạng giữa khung hình cuối
+		last := mjpegPart(testJPEG("frame-4"))
+		writeChunked(w, last[:len(last)-6], 5)
+	}))
+	defer srv.Close()
+
+	src, err := openHTTPSource(context.Background(), srv.URL, 2)
+	if err != nil {
+		t.Fatalf("openHTTPSource() = %v", err)
+	}
+	defer src.Close()
+	if _, ok := src.(*mjpegSource); !ok {
+		t.Fatalf("source = %T, want *mjpegSource", src)
+	}
+
+	for i, want := range frames {
+		got, err := src.Next()
+		if err != nil {
+			t.Fatalf("frame %d: Next() = %v", i+1, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("frame %d = %q, want %q", i+1, got, want)
+		}
+	}
+	if frame, err := src.Next(); err == nil {
+		t.Errorf("truncated frame returned %q, want error", frame)
+	}
+}
+
+func TestOpenHTTPSource(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		contentType string
+		wantErr     string
+	}{
+		{"snapshot camera", http.StatusOK, "image/jpeg", ""},
+		{"error status", http.StatusUnauthorized, "text/plain", "camera returned status 401 Unauthorized"},
+		{"missing boundary", http.StatusOK, "multipart/x-mixed-replace", "missing multipart boundary"},
+		{"unsupported content type", http.StatusOK, "text/html", `unsupported content type "text/html"`},
+		{"invalid content type", http.StatusOK, "", "invalid content type"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.WriteHeader(tt.status)
+				w.Write(testJPEG("snapshot"))
+			}))
+			defer srv.Close()
+
+			src, err := openHTTPSource(context.Background(), srv.URL, 2)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("openHTTPSource() = %v, want error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("openHTTPSource() = %v", err)
+			}
+			defer src.Close()
+			if frame, err := src.Next(); err != nil || !bytes.Equal(frame, testJPEG("snapshot")) {
+				t.Errorf("Next() = %q, %v", frame, err)
+			}
+		})
+	}
+}
+
+func TestCameraWorkerReconnects(t *testing.T) {
+	stubNoFace(t)
+	prevStall, prevMin, prevMax := cameraStallTimeout, cameraMinBackoff, cameraMaxBackoff
+	cameraStallTimeout, cameraMinBackoff, cameraMaxBackoff = 300*time.Millisecond, 100*time.Millisecond, time.Second
+	t.Cleanup(func() { cameraStallTimeout, cameraMinBackoff, cameraMaxBackoff = prevStall, prevMin, prevMax })
+
+	// Lần 1, 2: camera lỗi; lần 3: gửi 2 khung hình rồi rớt giữa khung thứ ba;
+	// từ lần 4: gửi 1 khung hình rồi treo cho tới khi bị ngắt
+	var mu sync.Mutex
+	var connects, disconnects []time.Time
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		connects = append(connects, time.Now())
+		n := len(connects)
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			disconnects = append(disconnects, time.Now())
+			mu.Unlock()
+		}()
+
+		if n <= 2 {
+			http.Error(w, "booting", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary=frame")
+		if n == 3 {
+			body := append(mjpegPart(testJPEG("a")), mjpegPart(testJPEG("b"))...)
+			last := mjpegPart(testJPEG("c"))
+			writeChunked(w, append(body, last[:len(last)-4]...), 64)
+			return
+		}
+		// Một phần chỉ kết thúc khi gặp boundary kế tiếp nên khung "e" không tới worker
+		writeChunked(w, append(mjpegPart(testJPEG("d")), mjpegPart(testJPEG("e"))...), 64)
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	w := startCameraWorker(Device{ID: "cam-test", StreamURL: srv.URL, SampleFPS: 1e6})
+	stopped := false
+	defer func() {
+		if !stopped {
+			w.stop()
+		}
+	}()
+
+	// Chờ tới khi watchdog ngắt kết nối treo ở lần 4
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		h := w.snapshot()
+		if h.Reconnects >= 4 && strings.Contains(h.LastError, "no frame received for 300ms") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("camera did not reconnect after a stall: %+v", h)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	start := time.Now()
+	w.stop()
+	stopped = true
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("stop() took %v", elapsed)
+	}
+
+	h := w.snapshot()
+	if h.FramesReceived < 3 || h.FramesProcessed != h.FramesReceived || h.ConnectedAt == nil || h.LastFrameAt == nil {
+		t.Errorf("health = %+v, want at least 3 frames received and processed", h)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	gap := func(i int) time.Duration { return connects[i+1].Sub(disconnects[i]) }
+	// Backoff tăng gấp đôi khi camera liên tục lỗi
+	if gap(0) < cameraMinBackoff || gap(1) < 2*cameraMinBackoff {
+		t.Errorf("backoff after failures = %v, %v; want >= %v, %v", gap(0), gap(1), cameraMinBackoff, 2*cameraMinBackoff)
+	}
+	// Kết nối đã nhận được khung hình thì backoff quay về mức thấp nhất
+	if gap(2) < cameraMinBackoff || gap(2) >= 2*cameraMinBackoff {
+		t.Errorf("backoff after a streaming connection = %v, want reset to %v", gap(2), cameraMinBackoff)
+	}
+}
+
+func TestCameraWorkerStopsDuringBackoff(t *testing.T) {
+	prevMin := cameraMinBackoff
+	cameraMinBackoff = time.Hour
+	t.Cleanup(func() { cameraMinBackoff = prevMin })
+
+	w := startCameraWorker(Device{ID: "cam-down", StreamURL: "http://127.0.0.1:1/stream"})
+	deadline := time.Now().Add(5 * time.Second)
+	for w.snapshot().Status != CameraReconnecting {
+		if time.Now().After(deadline) {
+			t.Fatal("camera did not enter reconnecting")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		w.stop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("stop() blocked by the reconnect backoff")
+	}
+	if h := w.snapshot(); h.Reconnects != 1 || h.LastError == "" {
+		t.Errorf("health = %+v, want one failed connection", h)
+	}
+}
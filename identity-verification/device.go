@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Device là thiết bị ghi hình (camera, kiosk) được gắn với một khu vực
+type Device struct {
+	ID        string  `gorm:"primaryKey" json:"id"`
+	Name      string  `json:"name"`
+	Zone      string  `json:"zone"`
+	SiteID    *uint   `gorm:"index" json:"site_id"`
+	StreamURL string  `json:"stream_url"` // Luồng camera IP (rtsp:// hoặc MJPEG qua http://), rỗng nếu không cần thu nhận
+	SampleFPS float64 `json:"sample_fps"` // Số khung hình xử lý mỗi giây, mặc định defaultSampleFPS
+}
+
+// Site là địa điểm (chi nhánh, tòa nhà) có múi giờ riêng
+type Site struct {
+	ID       uint   `gorm:"primaryKey" json:"id"`
+	Name     string `json:"name"`
+	Timezone string `json:"timezone"` // Tên múi giờ IANA, ví dụ "Asia/Ho_Chi_Minh"
+}
+
+// defaultTimezone là múi giờ dùng khi địa điểm không cấu hình múi giờ
+const defaultTimezone = "Asia/Ho_Chi_Minh"
+
+// location trả về múi giờ của địa điểm
+func (s *Site) location() (*time.Location, error) {
+	if s == nil || s.Timezone == "" {
+		return time.LoadLocation(defaultTimezone)
+	}
+	return time.LoadLocation(s.Timezone)
+}
+
+// lookupDevice tìm thiết bị theo ID, trả về nil nếu không có
+func lookupDevice(deviceID string) *Device {
+	if deviceID == "" {
+		return nil
+	}
+	var device Device
+	if err := db.First(&device, "id = ?", deviceID).Error; err != nil {
+		return nil
+	}
+	return &device
+}
+
+// deviceIDHeader là header kiosk và dashboard dùng để khai báo thiết bị gửi request
+const deviceIDHeader = "X-Device-ID"
+
+// requestDeviceID đọc ID thiết bị từ header X-Device-ID, nếu không có thì từ trường form hoặc query device_id
+func requestDeviceID(c *gin.Context) string {
+	if id := c.GetHeader(deviceIDHeader); id != "" {
+		return id
+	}
+	return c.Request.FormValue("device_id")
+}
+
+// deviceSetTTL là thời gian dùng lại danh sách ID thiết bị trước khi nạp lại từ database
+const deviceSetTTL = 30 * time.Second
+
+// knownDevices là tập ID thiết bị đã đăng ký, dùng để kiểm tra thiết bị mà không truy vấn database cho mỗi request
+var knownDevices = &deviceSet{load: loadDeviceIDs}
+
+// deviceSet giữ tập ID thiết bị trong bộ nhớ, nạp lại tối đa một lần mỗi deviceSetTTL
+type deviceSet struct {
+	load func() ([]string, error)
+
+	mu       sync.Mutex
+	ids      map[string]bool
+	loadedAt time.Time
+	loading  bool
+}
+
+// contains cho biết id có phải thiết bị đã đăng ký. Khi danh sách đã cũ, chỉ một request nạp lại,
+// các request khác dùng danh sách hiện có.
+func (s *deviceSet) contains(id string, now time.Time) bool {
+	if id == "" {
+		return false
+	}
+	s.mu.Lock()
+	if s.loading || now.Sub(s.loadedAt) <= deviceSetTTL {
+		found := s.ids[id]
+		s.mu.Unlock()
+		return found
+	}
+	s.loading = true
+	s.mu.Unlock()
+
+	ids, err := s.load()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loading = false
+	s.loadedAt = now
+	if err != nil {
+		// Giữ danh sách cũ, thử lại sau deviceSetTTL
+		slog.Error("Error loading device IDs", "error", err)
+	} else {
+		s.ids = make(map[string]bool, len(ids))
+		for _, id := range ids {
+			s.ids[id] = true
+		}
+	}
+	return s.ids[id]
+}
+
+// invalidate buộc lần kiểm tra sau nạp lại danh sách, gọi khi thiết bị được thêm hoặc xóa
+func (s *deviceSet) invalidate() {
+	s.mu.Lock()
+	s.loadedAt = time.Time{}
+	s.mu.Unlock()
+}
+
+// loadDeviceIDs đọc ID của mọi thiết bị đã đăng ký
+func loadDeviceIDs() ([]string, error) {
+	var ids []string
+	err := db.Model(&Device{}).Pluck("id", &ids).Error
+	return ids, err
+}
+
+// deviceID trả về ID của thiết bị, rỗng nếu không xác định được thiết bị
+func deviceID(device *Device) string {
+	if device == nil {
+		return ""
+	}
+	return device.ID
+}
+
+// deviceZone trả về khu vực của thiết bị, rỗng nếu không xác định được thiết bị
+func deviceZone(device *Device) string {
+	if device == nil {
+		return ""
+	}
+	return device.Zone
+}
+
+// getDevicesHandler lấy danh sách thiết bị
+func getDevicesHandler(c *gin.Context) {
+	var devices []Device
+	if err := db.Order("id").Find(&devices).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error fetching devices from database", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, devices)
+}
+
+// saveDeviceHandler tạo mới hoặc cập nhật thiết bị
+func saveDeviceHandler(c *gin.Context) {
+	var device Device
+	if err := c.ShouldBindJSON(&device); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if id := c.Param("id"); id != "" {
+		device.ID = id
+	}
+	if device.ID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Device id is required"})
+		return
+	}
+
+	if err := db.Save(&device).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error saving device", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save device"})
+		return
+	}
+	knownDevices.invalidate()
+	c.JSON(http.StatusOK, device)
+}
+
+// deleteDeviceHandler xóa thiết bị
+func deleteDeviceHandler(c *gin.Context) {
+	if err := db.Delete(&Device{}, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete device"})
+		return
+	}
+	knownDevices.invalidate()
+	c.JSON(http.StatusOK, gin.H{"message": "Device deleted successfully"})
+}
+
+// getSitesHandler lấy danh sách địa điểm
+func getSitesHandler(c *gin.Context) {
+	var sites []Site
+	if err := db.Order("id").Find(&sites).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error fetching sites from database", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, sites)
+}
+
+// saveSiteHandler tạo mới hoặc cập nhật địa điểm
+func saveSiteHandler(c *gin.Context) {
+	var site Site
+	if err := c.ShouldBindJSON(&site); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if id := c.Param("id"); id != "" {
+		if _, err := fmt.Sscan(id, &site.ID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid site id"})
+			return
+		}
+	}
+	if site.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Site name is required"})
+		return
+	}
+	if _, err := site.location(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid timezone"})
+		return
+	}
+
+	if err := db.Save(&site).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error saving site", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save site"})
+		return
+	}
+	c.JSON(http.StatusOK, site)
+}
+
+// deleteSiteHandler xóa địa điểm và gỡ liên kết với các thiết bị
+func deleteSiteHandler(c *gin.Context) {
+	siteID := c.Param("id")
+
+	if err := db.Model(&Device{}).Where("site_id = ?", siteID).Update("site_id", nil).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to detach devices"})
+		return
+	}
+	if err := db.Delete(&Site{}, siteID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete site"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Site deleted successfully"})
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+
+	"isafe/shared/domain"
+)
+
+// Các loại sự kiện được đẩy tới dashboard
+const (
+	EventVerificationMatched  = domain.EventVerificationMatched
+	EventVerificationRejected = domain.EventVerificationRejected
+	EventAlertCreated         = domain.EventAlertCreated
+	EventAlertUpdated         = domain.EventAlertUpdated
+	EventVisitorCheckedIn     = domain.EventVisitorCheckedIn
+)
+
+// eventBacklogSize là số sự kiện gần nhất được giữ lại để client kết nối lại có thể tiếp tục
+const eventBacklogSize = 1000
+
+// EventStreamReset là sự kiện SSE báo cho client rằng không thể tiếp tục từ Last-Event-ID (kết nối tới bản sao
+// khác, dịch vụ đã khởi động lại hoặc sự kiện đã rời khỏi backlog); client nên tải lại trạng thái hiện tại
+const EventStreamReset = "stream.reset"
+
+// eventHeartbeatInterval là chu kỳ gửi heartbeat để giữ kết nối SSE qua proxy
+const eventHeartbeatInterval = 15 * time.Second
+
+// Event là một sự kiện thời gian thực
+type Event struct {
+	ID        uint64      `json:"id"`
+	Type      string      `json:"type"`
+	DeviceID  string      `json:"device_id,omitempty"`
+	Timestamp time.Time   `json:"timestamp"`
+	Data      interface{} `json:"data"`
+}
+
+// eventFilter lọc sự kiện theo thiết bị và loại sự kiện
+type eventFilter struct {
+	deviceID string
+	types    map[string]bool
+}
+
+// matches kiểm tra sự kiện có thỏa bộ lọc hay không
+func (f eventFilter) matches(e Event) bool {
+	if f.deviceID != "" && e.DeviceID != f.deviceID {
+		return false
+	}
+	if len(f.types) > 0 && !f.types[e.Type] {
+		return false
+	}
+	return true
+}
+
+// eventSubscriber là một kết nối đang nhận sự kiện
+type eventSubscriber struct {
+	ch     chan Event
+	filter eventFilter
+}
+
+// eventHub phân phối sự kiện tới các subscriber và giữ backlog để resume.
+// ID sự kiện chỉ có nghĩa trong một tiến trình: mỗi bản sao có backlog riêng và bộ đếm bắt đầu lại khi khởi động,
+// nên ID SSE gắn thêm instance để nhận ra Last-Event-ID của bản sao khác hoặc của lần chạy trước.
+type eventHub struct {
+	mu          sync.Mutex
+	instance    string
+	nextID      uint64
+	backlog     []Event
+	subscribers map[*eventSubscriber]struct{}
+}
+
+var events = newEventHub()
+
+// newEventHub tạo event hub với instance ngẫu nhiên
+func newEventHub() *eventHub {
+	buf := make([]byte, 4)
+	rand.Read(buf)
+	return &eventHub{instance: hex.EncodeToString(buf), subscribers: make(map[*eventSubscriber]struct{})}
+}
+
+// sseID trả về ID SSE dạng "<instance>-<id>" của sự kiện
+func (h *eventHub) sseID(e Event) string {
+	return h.instance + "-" + strconv.FormatUint(e.ID, 10)
+}
+
+// parseLastEventID đọc Last-Event-ID, trả về ok=false nếu ID không do tiến trình này cấp
+func (h *eventHub) parseLastEventID(value string) (uint64, bool) {
+	instance, rawID, found := strings.Cut(value, "-")
+	if !found || instance != h.instance {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(rawID, 10, 64)
+	return id, err == nil
+}
+
+// publish gán ID cho sự kiện và gửi tới các subscriber phù hợp.
+// Subscriber quá chậm sẽ bị ngắt để không chặn luồng xác thực.
+func (h *eventHub) publish(eventType, deviceID string, data interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.nextID++
+	e := Event{
+		ID:        h.nextID,
+		Type:      eventType,
+		DeviceID:  deviceID,
+		Timestamp: time.Now(),
+		Data:      data,
+	}
+
+	h.backlog = append(h.backlog, e)
+	if len(h.backlog) > eventBacklogSize {
+		h.backlog = h.backlog[len(h.backlog)-eventBacklogSize:]
+	}
+
+	for sub := range h.subscribers {
+		if !sub.filter.matches(e) {
+			continue
+		}
+		select {
+		case sub.ch <- e:
+		default:
+			slog.Warn("Dropping slow event subscriber")
+			delete(h.subscribers, sub)
+			close(sub.ch)
+		}
+	}
+}
+
+// subscribe đăng ký nhận sự kiện mới và trả về các sự kiện sau lastID còn trong backlog.
+// complete là false nếu một số sự kiện sau lastID đã rời khỏi backlog.
+func (h *eventHub) subscribe(filter eventFilter, lastID uint64) (sub *eventSubscriber, missed []Event, complete bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	complete = len(h.backlog) == 0 || h.backlog[0].ID <= lastID+1
+	if lastID > 0 {
+		for _, e := range h.backlog {
+			if e.ID > lastID && filter.matches(e) {
+				missed = append(missed, e)
+			}
+		}
+	}
+
+	sub = &eventSubscriber{ch: make(chan Event, 64), filter: filter}
+	h.subscribers[sub] = struct{}{}
+	return sub, missed, complete
+}
+
+// unsubscribe hủy đăng ký subscriber
+func (h *eventHub) unsubscribe(sub *eventSubscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subscribers[sub]; ok {
+		delete(h.subscribers, sub)
+		close(sub.ch)
+	}
+}
+
+// listenAlertEvents nhận sự kiện cảnh báo từ Alert Service qua Postgres NOTIFY
+func listenAlertEvents(dsn string) {
+	listener := pq.NewListener(dsn, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			slog.Error("Alert event listener error", "error", err)
+		}
+	})
+	if err := listener.Listen(domain.AlertEventsChannel); err != nil {
+		slog.Error("Error listening for alert events", "channel", domain.AlertEventsChannel, "error", err)
+		return
+	}
+
+	defer listener.Close()
+
+	for {
+		var n *pq.Notification
+		select {
+		case n = <-listener.Notify:
+		case <-app.Stopping():
+			return
+		}
+		// n == nil khi kết nối được thiết lập lại
+		if n == nil {
+			continue
+		}
+		var payload domain.AlertEvent
+		if err := json.Unmarshal([]byte(n.Extra), &payload); err != nil {
+			slog.Error("Invalid alert event payload", "error", err)
+			continue
+		}
+		events.publish(payload.Type, payload.Alert.DeviceID, payload.Alert)
+		wakeAlertEventWebhooks()
+	}
+}
+
+// streamEventsHandler đẩy sự kiện thời gian thực tới dashboard qua Server-Sent Events.
+// Hỗ trợ lọc theo device_id, types (phân tách bằng dấu phẩy) và resume bằng Last-Event-ID.
+// Resume chỉ tiếp tục được trên cùng bản sao và cùng lần chạy; ngược lại client nhận sự kiện stream.reset.
+func streamEventsHandler(c *gin.Context) {
+	filter := eventFilter{deviceID: c.Query("device_id")}
+	if types := c.Query("types"); types != "" {
+		filter.types = make(map[string]bool)
+		for _, t := range strings.Split(types, ",") {
+			filter.types[strings.TrimSpace(t)] = true
+		}
+	}
+
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+	lastID, resumable := events.parseLastEventID(lastEventID)
+
+	sub, missed, complete := events.subscribe(filter, lastID)
+	defer events.unsubscribe(sub)
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+
+	if lastEventID != "" && (!resumable || !complete) {
+		c.Render(-1, sse.Event{Event: EventStreamReset, Data: gin.H{"last_event_id": lastEventID}})
+	}
+	for _, e := range missed {
+		renderEvent(c, e)
+	}
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(eventHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-app.ShuttingDown():
+			// Đóng luồng để server tắt được; trình duyệt tự kết nối lại tới bản sao khác và nhận stream.reset
+			return false
+		case e, ok := <-sub.ch:
+			if !ok {
+				return false
+			}
+			renderEvent(c, e)
+			return true
+		case <-heartbeat.C:
+			io.WriteString(w, ": ping\n\n")
+			return true
+		}
+	})
+}
+
+// renderEvent ghi một sự kiện theo định dạng SSE
+func renderEvent(c *gin.Context, e Event) {
+	c.Render(-1, sse.Event{
+		Id:    events.sseID(e),
+		Event: e.Type,
+		Data:  e,
+	})
+}
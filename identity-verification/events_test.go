@@ -0,0 +1,47 @@
+package main
+
+import "testing"
+
+func TestParseLastEventID(t *testing.T) {
+	hub := newEventHub()
+	tests := []struct {
+		name  string
+		value string
+		id    uint64
+		ok    bool
+	}{
+		{"same instance", hub.instance + "-42", 42, true},
+		{"other replica", "deadbeef-42", 0, false},
+		{"legacy numeric id", "42", 0, false},
+		{"malformed", hub.instance + "-x", 0, false},
+		{"empty", "", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, ok := hub.parseLastEventID(tt.value)
+			if id != tt.id || ok != tt.ok {
+				t.Errorf("parseLastEventID(%q) = %d, %v; want %d, %v", tt.value, id, ok, tt.id, tt.ok)
+			}
+		})
+	}
+}
+
+func TestSubscribeReplaysBacklog(t *testing.T) {
+	hub := newEventHub()
+	for i := 0; i < eventBacklogSize+5; i++ {
+		hub.publish(EventVerificationMatched, "cam-1", nil)
+	}
+
+	sub, missed, complete := hub.subscribe(eventFilter{}, eventBacklogSize+2)
+	hub.unsubscribe(sub)
+	if !complete || len(missed) != 3 {
+		t.Errorf("resume inside backlog: got %d events, complete=%v; want 3, true", len(missed), complete)
+	}
+
+	// Sự kiện 2..5 đã rời khỏi backlog
+	sub, missed, complete = hub.subscribe(eventFilter{}, 1)
+	hub.unsubscribe(sub)
+	if complete || len(missed) != eventBacklogSize {
+		t.Errorf("resume before backlog: got %d events, complete=%v; want %d, false", len(missed), complete, eventBacklogSize)
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// faceRecPriority là mức ưu tiên của một lần gọi Face Recognition service
+type faceRecPriority int
+
+const (
+	// priorityLive dành cho xác thực trực tiếp (kiosk, WebSocket, camera): người dùng đang đứng chờ
+	priorityLive faceRecPriority = iota
+	// priorityEnroll dành cho đăng ký khuôn mặt (thêm người dùng, khách), có thể chờ lâu hơn
+	priorityEnroll
+	numFaceRecPriorities
+)
+
+func (p faceRecPriority) String() string {
+	if p == priorityLive {
+		return "live"
+	}
+	return "enroll"
+}
+
+// errFaceRecBusy được trả về khi hàng đợi Face Recognition đầy hoặc chờ quá lâu, request bị loại bỏ
+var errFaceRecBusy = errors.New("face recognition service is busy")
+
+// faceRecLimiter giới hạn số lần gọi Face Recognition đồng thời. Flask service xử lý tuần tự nên gửi
+// nhiều request cùng lúc chỉ làm tăng độ trễ và timeout dây chuyền; cấu hình qua FACE_REC_CONCURRENCY,
+// FACE_REC_QUEUE_SIZE và FACE_REC_QUEUE_TIMEOUT.
+var faceRecLimiter = newFaceRecPool(
+	envInt("FACE_REC_CONCURRENCY", 1),
+	envInt("FACE_REC_QUEUE_SIZE", 32),
+	envDuration("FACE_REC_QUEUE_TIMEOUT", 5*time.Second),
+)
+
+// faceRecPool là semaphore có hàng đợi theo mức ưu tiên: slot trống luôn được giao cho request
+// xác thực trực tiếp trước, request cùng mức ưu tiên được phục vụ theo thứ tự đến
+type faceRecPool struct {
+	mu        sync.Mutex
+	size      int
+	active    int
+	maxQueue  int
+	queued    int
+	queues    [numFaceRecPriorities][]*faceRecWaiter
+	waitLimit time.Duration
+}
+
+// faceRecWaiter là một request đang chờ slot; ready nhận nil khi được giao slot hoặc
+// errFaceRecBusy khi bị request ưu tiên cao hơn đẩy khỏi hàng đợi
+type faceRecWaiter struct {
+	priority faceRecPriority
+	ready    chan error
+}
+
+func newFaceRecPool(size, maxQueue int, waitLimit time.Duration) *faceRecPool {
+	return &faceRecPool{size: size, maxQueue: maxQueue, waitLimit: waitLimit}
+}
+
+// acquire chờ tới khi có slot trống và trả về hàm release phải gọi sau khi dùng xong.
+// Trả về errFaceRecBusy nếu hàng đợi đầy hoặc chờ quá waitLimit.
+func (p *faceRecPool) acquire(ctx context.Context, prio faceRecPriority) (func(), error) {
+	start := time.Now()
+	p.mu.Lock()
+	if p.active < p.size && p.queued == 0 {
+		p.active++
+		p.mu.Unlock()
+		observeQueueWait(prio, start)
+		return p.release, nil
+	}
+
+	if p.queued >= p.maxQueue && !p.evictLowerThan(prio) {
+		p.mu.Unlock()
+		faceRecShed.WithLabelValues(prio.String(), "queue_full").Inc()
+		return nil, errFaceRecBusy
+	}
+
+	w := &faceRecWaiter{priority: prio, ready: make(chan error, 1)}
+	p.queues[prio] = append(p.queues[prio], w)
+	p.queued++
+	p.mu.Unlock()
+
+	timer := time.NewTimer(p.waitLimit)
+	defer timer.Stop()
+
+	var waitErr error
+	select {
+	case err := <-w.ready:
+		if err != nil {
+			faceRecShed.WithLabelValues(prio.String(), "preempted").Inc()
+			return nil, err
+		}
+		observeQueueWait(prio, start)
+		return p.release, nil
+	case <-timer.C:
+		waitErr = errFaceRecBusy
+	case <-ctx.Done():
+		waitErr = ctx.Err()
+	}
+
+	p.mu.Lock()
+	removed := p.remove(w)
+	p.mu.Unlock()
+	if !removed {
+		// Slot đã được giao (hoặc request đã bị đẩy ra) ngay trước khi hết giờ
+		if err := <-w.ready; err == nil {
+			p.release()
+		}
+	}
+	if errors.Is(waitErr, errFaceRecBusy) {
+		faceRecShed.WithLabelValues(prio.String(), "timeout").Inc()
+	}
+	return nil, waitErr
+}
+
+// release trả slot, giao thẳng cho request đang chờ có mức ưu tiên cao nhất nếu có
+func (p *faceRecPool) release() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for prio := range p.queues {
+		if len(p.queues[prio]) == 0 {
+			continue
+		}
+		w := p.queues[prio][0]
+		p.queues[prio] = p.queues[prio][1:]
+		p.queued--
+		w.ready <- nil
+		return
+	}
+	p.active--
+}
+
+// evictLowerThan đẩy request đến sau cùng có mức ưu tiên thấp hơn prio ra khỏi hàng đợi đầy
+// để nhường chỗ, trả về false nếu không có request nào như vậy. Gọi khi đang giữ p.mu.
+func (p *faceRecPool) evictLowerThan(prio faceRecPriority) bool {
+	for lower := numFaceRecPriorities - 1; lower > prio; lower-- {
+		queue := p.queues[lower]
+		if len(queue) == 0 {
+			continue
+		}
+		w := queue[len(queue)-1]
+		p.queues[lower] = queue[:len(queue)-1]
+		p.queued--
+		w.ready <- errFaceRecBusy
+		return true
+	}
+	return false
+}
+
+// remove xóa w khỏi hàng đợi, trả về false nếu w không còn trong hàng đợi. Gọi khi đang giữ p.mu.
+func (p *faceRecPool) remove(w *faceRecWaiter) bool {
+	queue := p.queues[w.priority]
+	for i, q := range queue {
+		if q == w {
+			p.queues[w.priority] = append(queue[:i], queue[i+1:]...)
+			p.queued--
+			return true
+		}
+	}
+	return false
+}
+
+// inFlight trả về số request đang gọi Face Recognition
+func (p *faceRecPool) inFlight() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.active
+}
+
+// queueLen trả về số request đang chờ ở mức ưu tiên prio
+func (p *faceRecPool) queueLen(prio faceRecPriority) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.queues[prio])
+}
+
+// observeQueueWait ghi nhận thời gian một request chờ slot Face Recognition
+func observeQueueWait(prio faceRecPriority, start time.Time) {
+	faceRecQueueWait.WithLabelValues(prio.String()).Observe(time.Since(start).Seconds())
+}
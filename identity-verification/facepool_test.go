@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// acquireResult là kết quả của một lần acquire chạy trong goroutine riêng
+type acquireResult struct {
+	prio    faceRecPriority
+	release func()
+	err     error
+}
+
+// acquireAsync gọi acquire trong goroutine và chờ tới khi request đã vào hàng đợi
+func acquireAsync(t *testing.T, p *faceRecPool, ctx context.Context, prio faceRecPriority, results chan<- acquireResult) {
+	t.Helper()
+	queued := p.queueLen(prio)
+	go func() {
+		release, err := p.acquire(ctx, prio)
+		results <- acquireResult{prio: prio, release: release, err: err}
+	}()
+	waitFor(t, func() bool { return p.queueLen(prio) == queued+1 })
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met before deadline")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func receive(t *testing.T, results <-chan acquireResult) acquireResult {
+	t.Helper()
+	select {
+	case r := <-results:
+		return r
+	case <-time.After(2 * time.Second):
+		t.Fatal("acquire did not return")
+		return acquireResult{}
+	}
+}
+
+func TestFaceRecPoolReleasesToLiveFirst(t *testing.T) {
+	p := newFaceRecPool(1, 10, time.Minute)
+	release, err := p.acquire(context.Background(), priorityEnroll)
+	if err != nil {
+		t.Fatalf("acquire free slot: %v", err)
+	}
+
+	results := make(chan acquireResult, 3)
+	acquireAsync(t, p, context.Background(), priorityEnroll, results)
+	acquireAsync(t, p, context.Background(), priorityLive, results)
+	acquireAsync(t, p, context.Background(), priorityLive, results)
+
+	// Slot được giao thẳng cho request chờ, live trước enroll dù enroll đến trước
+	want := []faceRecPriority{priorityLive, priorityLive, priorityEnroll}
+	for i, prio := range want {
+		release()
+		r := receive(t, results)
+		if r.err != nil {
+			t.Fatalf("waiter %d: %v", i, r.err)
+		}
+		if r.prio != prio {
+			t.Fatalf("waiter %d got %v, want %v", i, r.prio, prio)
+		}
+		if got := p.inFlight(); got != 1 {
+			t.Fatalf("inFlight = %d, want 1", got)
+		}
+		release = r.release
+	}
+	release()
+	if got := p.inFlight(); got != 0 {
+		t.Fatalf("inFlight after last release = %d, want 0", got)
+	}
+}
+
+func TestFaceRecPoolQueueFull(t *testing.T) {
+	p := newFaceRecPool(1, 1, time.Minute)
+	release, err := p.acquire(context.Background(), priorityLive)
+	if err != nil {
+		t.Fatalf("acquire free slot: %v", err)
+	}
+	defer release()
+
+	results := make(chan acquireResult, 2)
+	acquireAsync(t, p, context.Background(), priorityEnroll, results)
+
+	// Request live đẩy request enroll đến sau cùng ra khỏi hàng đợi đầy
+	preempted := testutil.ToFloat64(faceRecShed.WithLabelValues("enroll", "preempted"))
+	acquireAsync(t, p, context.Background(), priorityLive, results)
+	if r := receive(t, results); r.prio != priorityEnroll || !errors.Is(r.err, errFaceRecBusy) {
+		t.Fatalf("evicted waiter = %v %v, want enroll %v", r.prio, r.err, errFaceRecBusy)
+	}
+	if got := testutil.ToFloat64(faceRecShed.WithLabelValues("enroll", "preempted")) - preempted; got != 1 {
+		t.Errorf("preempted shed count = %v, want 1", got)
+	}
+
+	// Hàng đợi chỉ còn request live nên không request nào bị đẩy ra được
+	for _, prio := range []faceRecPriority{priorityEnroll, priorityLive} {
+		full := testutil.ToFloat64(faceRecShed.WithLabelValues(prio.String(), "queue_full"))
+		if _, err := p.acquire(context.Background(), prio); !errors.Is(err, errFaceRecBusy) {
+			t.Fatalf("%v acquire on full queue = %v, want %v", prio, err, errFaceRecBusy)
+		}
+		if got := testutil.ToFloat64(faceRecShed.WithLabelValues(prio.String(), "queue_full")) - full; got != 1 {
+			t.Errorf("%v queue_full shed count = %v, want 1", prio, got)
+		}
+	}
+	if got := p.queueLen(priorityLive); got != 1 {
+		t.Fatalf("live queue = %d, want 1", got)
+	}
+}
+
+func TestFaceRecPoolWaitLimit(t *testing.T) {
+	p := newFaceRecPool(1, 10, 20*time.Millisecond)
+	release, err := p.acquire(context.Background(), priorityLive)
+	if err != nil {
+		t.Fatalf("acquire free slot: %v", err)
+	}
+
+	timeouts := testutil.ToFloat64(faceRecShed.WithLabelValues("live", "timeout"))
+	if _, err := p.acquire(context.Background(), priorityLive); !errors.Is(err, errFaceRecBusy) {
+		t.Fatalf("acquire = %v, want %v", err, errFaceRecBusy)
+	}
+	if got := testutil.ToFloat64(faceRecShed.WithLabelValues("live", "timeout")) - timeouts; got != 1 {
+		t.Errorf("timeout shed count = %v, want 1", got)
+	}
+	if got := p.queueLen(priorityLive); got != 0 {
+		t.Fatalf("queue after timeout = %d, want 0", got)
+	}
+
+	release()
+	if got := p.inFlight(); got != 0 {
+		t.Fatalf("inFlight = %d, want 0", got)
+	}
+}
+
+func TestFaceRecPoolContextCancel(t *testing.T) {
+	p := newFaceRecPool(1, 10, time.Minute)
+	release, err := p.acquire(context.Background(), priorityLive)
+	if err != nil {
+		t.Fatalf("acquire free slot: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	results := make(chan acquireResult, 1)
+	acquireAsync(t, p, ctx, priorityEnroll, results)
+	cancel()
+	if r := receive(t, results); !errors.Is(r.err, context.Canceled) {
+		t.Fatalf("acquire = %v, want %v", r.err, context.Canceled)
+	}
+	if got := p.queueLen(priorityEnroll); got != 0 {
+		t.Fatalf("queue after cancel = %d, want 0", got)
+	}
+
+	// Request đã hủy không giữ slot: slot trả về pool thay vì giao cho waiter đã bỏ đi
+	release()
+	if got := p.inFlight(); got != 0 {
+		t.Fatalf("inFlight = %d, want 0", got)
+	}
+}
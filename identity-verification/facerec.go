@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+
+	"isafe/shared/logging"
+	"isafe/shared/tracing"
+)
+
+// errNoEmbedding được trả về khi Face Recognition service không trích xuất được embedding
+var errNoEmbedding = errors.New("embedding not found in response")
+
+// errFaceRecResponse được trả về khi phản hồi của Face Recognition service không đọc được
+var errFaceRecResponse = errors.New("invalid Face Recognition response")
+
+// faceRecError là lỗi do Face Recognition service trả về, ví dụ không tìm thấy khuôn mặt
+type faceRecError struct {
+	message string
+}
+
+func (e *faceRecError) Error() string {
+	return e.message
+}
+
+// Is cho phép errors.Is(err, errNoEmbedding) nhận diện lỗi từ service
+func (e *faceRecError) Is(target error) bool {
+	return target == errNoEmbedding
+}
+
+// faceRecURL là địa chỉ endpoint xử lý ảnh của Face Recognition service
+var faceRecURL = faceRecognitionBaseURL() + "/process_image"
+
+// faceRecTimeout giới hạn thời gian một lần gọi Face Recognition tính từ lúc nhận slot, để một request
+// treo không giữ slot mãi mãi khi context của bên gọi không có hạn (camera worker, WebSocket)
+var faceRecTimeout = envDuration("FACE_REC_TIMEOUT", 10*time.Second)
+
+// faceRecClient gọi Face Recognition service, mỗi request mang header traceparent và X-Request-ID
+var faceRecClient = &http.Client{Transport: tracing.Transport(logging.Transport(nil))}
+
+// faceRecognitionBaseURL lấy địa chỉ Face Recognition service từ biến môi trường
+func faceRecognitionBaseURL() string {
+	if url := os.Getenv("FACE_RECOGNITION_URL"); url != "" {
+		return url
+	}
+	return "http://localhost:5001"
+}
+
+// fetchEmbedding gửi ảnh tới Face Recognition service và trả về embedding khuôn mặt.
+// Request chờ slot trong faceRecLimiter theo priority; trả về errFaceRecBusy nếu bị loại bỏ do quá tải.
+func fetchEmbedding(ctx context.Context, priority faceRecPriority, imageBytes []byte, filename string) (embedding []float64, err error) {
+	ctx, span := tracer.Start(ctx, "face_recognition.embed")
+	span.SetAttributes(attribute.Int("image.bytes", len(imageBytes)), attribute.String("priority", priority.String()))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	queued := time.Now()
+	release, err := faceRecLimiter.acquire(ctx, priority)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	span.SetAttributes(attribute.Int64("queue.wait_ms", time.Since(queued).Milliseconds()))
+
+	start := time.Now()
+	defer func() { observeFaceRecognition(start, err) }()
+
+	ctx, cancel := context.WithTimeout(ctx, faceRecTimeout)
+	defer cancel()
+
+	// Tạo multipart/form-data với trường 'image'
+	var requestBody bytes.Buffer
+	writer := multipart.NewWriter(&requestBody)
+	part, err := writer.CreateFormFile("image", filename)
+	if err != nil {
+		return nil, fmt.Errorf("create form file: %w", err)
+	}
+	if _, err := part.Write(imageBytes); err != nil {
+		return nil, fmt.Errorf("write image to form: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("close form writer: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, faceRecURL, &requestBody)
+	if err != nil {
+		return nil, fmt.Errorf("create Face Recognition request: %w", err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	resp, err := faceRecClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("communicate with Face Recognition service: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read Face Recognition response: %w", err)
+	}
+
+	var faceResp struct {
+		Embedding []float64 `json:"embedding"`
+		Error     string    `json:"error"`
+	}
+	if err := json.Unmarshal(body, &faceResp); err != nil {
+		return nil, fmt.Errorf("%w: %v", errFaceRecResponse, err)
+	}
+	if faceResp.Error != "" {
+		return nil, &faceRecError{message: faceResp.Error}
+	}
+	if len(faceResp.Embedding) == 0 {
+		return nil, errNoEmbedding
+	}
+	return faceResp.Embedding, nil
+}
+
+// observeFaceRecognition ghi nhận độ trễ và loại lỗi của một lần gọi Face Recognition service
+func observeFaceRecognition(start time.Time, err error) {
+	outcome := "ok"
+	var fe *faceRecError
+	switch {
+	case err == nil:
+	case errors.As(err, &fe), errors.Is(err, errNoEmbedding):
+		// Ảnh không có khuôn mặt là kết quả hợp lệ của service, không phải lỗi kết nối
+		outcome = "no_face"
+		faceRecErrors.WithLabelValues("no_face").Inc()
+	case errors.Is(err, errFaceRecResponse):
+		outcome = "error"
+		faceRecErrors.WithLabelValues("invalid_response").Inc()
+	default:
+		outcome = "error"
+		faceRecErrors.WithLabelValues("transport").Inc()
+	}
+	faceRecDuration.WithLabelValues(outcome).Observe(time.Since(start).Seconds())
+}
+
+// respondEmbeddingError trả lỗi trích xuất embedding cho client
+func respondEmbeddingError(c *gin.Context, err error) {
+	if errors.Is(err, errFaceRecBusy) {
+		slog.WarnContext(c.Request.Context(), "Face Recognition overloaded, request shed", "error", err)
+	} else {
+		slog.ErrorContext(c.Request.Context(), "Error extracting embedding", "error", err)
+	}
+
+	var fe *faceRecError
+	switch {
+	case errors.Is(err, errFaceRecBusy):
+		c.Header("Retry-After", "1")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Face Recognition service is busy, please retry"})
+	case errors.As(err, &fe):
+		c.JSON(http.StatusBadRequest, gin.H{"error": fe.message})
+	case errors.Is(err, errNoEmbedding):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Embedding not found in response"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to communicate with Face Recognition service"})
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"isafe/shared/logging"
+)
+
+// stubFaceRecognition trỏ faceRecURL tới handler trong thời gian chạy test
+func stubFaceRecognition(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	previous := faceRecURL
+	faceRecURL = srv.URL + "/process_image"
+	t.Cleanup(func() { faceRecURL = previous })
+}
+
+func TestFetchEmbeddingForwardsRequestID(t *testing.T) {
+	var got string
+	stubFaceRecognition(t, func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get(logging.RequestIDHeader)
+		w.Write([]byte(`{"embedding":[0.1,0.2,0.3]}`))
+	})
+
+	// Đăng ký khuôn mặt (addUserHandler, enrollVisitorHandler) gọi với priorityEnroll
+	ctx := logging.WithRequestID(context.Background(), "req-enroll-1")
+	embedding, err := fetchEmbedding(ctx, priorityEnroll, []byte("jpeg"), "capture.jpg")
+	if err != nil {
+		t.Fatalf("fetchEmbedding: %v", err)
+	}
+	if len(embedding) != 3 {
+		t.Fatalf("embedding has %d dimensions, want 3", len(embedding))
+	}
+	if got != "req-enroll-1" {
+		t.Errorf("%s = %q, want %q", logging.RequestIDHeader, got, "req-enroll-1")
+	}
+}
+
+func TestFetchEmbeddingPropagatesTraceContext(t *testing.T) {
+	previous := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTextMapPropagator(previous) })
+
+	var got string
+	stubFaceRecognition(t, func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("traceparent")
+		w.Write([]byte(`{"embedding":[0.1]}`))
+	})
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+		Remote:     true,
+	}))
+	if _, err := fetchEmbedding(ctx, priorityEnroll, []byte("jpeg"), "capture.jpg"); err != nil {
+		t.Fatalf("fetchEmbedding: %v", err)
+	}
+	if !strings.Contains(got, traceID.String()) {
+		t.Errorf("traceparent = %q, want trace id %s", got, traceID)
+	}
+}
+
+func TestFetchEmbeddingRecordsErrors(t *testing.T) {
+	stubFaceRecognition(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html>bad gateway</html>"))
+	})
+
+	before := testutil.ToFloat64(faceRecErrors.WithLabelValues("invalid_response"))
+	_, err := fetchEmbedding(context.Background(), priorityEnroll, []byte("jpeg"), "capture.jpg")
+	if !errors.Is(err, errFaceRecResponse) {
+		t.Fatalf("fetchEmbedding error = %v, want %v", err, errFaceRecResponse)
+	}
+	if after := testutil.ToFloat64(faceRecErrors.WithLabelValues("invalid_response")); after != before+1 {
+		t.Errorf("invalid_response errors = %v, want %v", after, before+1)
+	}
+}
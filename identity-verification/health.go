@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// healthCheckTimeout giới hạn thời gian mỗi phép kiểm tra của /readyz
+const healthCheckTimeout = 2 * time.Second
+
+// healthzHandler cho biết tiến trình còn chạy (liveness), không kiểm tra phụ thuộc
+func healthzHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// readyzHandler cho biết dịch vụ có nhận request được không: cơ sở dữ liệu và Face Recognition service
+// phải phản hồi, và dịch vụ chưa bắt đầu tắt
+func readyzHandler(c *gin.Context) {
+	checks := gin.H{
+		"database":         checkResult(checkDatabase(c.Request.Context())),
+		"face_recognition": checkResult(checkFaceRecognition(c.Request.Context())),
+	}
+	ready := true
+	for _, result := range checks {
+		if result != "ok" {
+			ready = false
+		}
+	}
+	if app.IsShuttingDown() {
+		checks["shutdown"] = "in progress"
+		ready = false
+	}
+
+	if !ready {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "checks": checks})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "checks": checks})
+}
+
+// checkResult chuyển kết quả kiểm tra thành chuỗi hiển thị
+func checkResult(err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return "ok"
+}
+
+// checkDatabase ping cơ sở dữ liệu
+func checkDatabase(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// checkFaceRecognition gọi endpoint /healthz của Face Recognition service
+func checkFaceRecognition(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, faceRecognitionBaseURL()+"/healthz", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := faceRecClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("unreachable: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("returned %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	gormlogger "gorm.io/gorm/logger"
+
+	"isafe/shared/logging"
+)
+
+// requestLogMiddleware gắn request ID (lấy từ header X-Request-ID hoặc tạo mới) vào context của request,
+// trả lại trong response và ghi một dòng log cho mỗi request. Log theo route đã khớp, không theo URL thật,
+// vì URL có thể chứa token.
+func requestLogMiddleware(c *gin.Context) {
+	id := logging.RequestIDFromHeader(c.GetHeader(logging.RequestIDHeader))
+	ctx := logging.WithRequestID(c.Request.Context(), id)
+	c.Request = c.Request.WithContext(ctx)
+	c.Header(logging.RequestIDHeader, id)
+
+	start := time.Now()
+	c.Next()
+
+	route := c.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+	status := c.Writer.Status()
+	level := slog.LevelInfo
+	switch {
+	case status >= 500:
+		level = slog.LevelError
+	case status >= 400:
+		level = slog.LevelWarn
+	case isProbePath(route):
+		level = slog.LevelDebug
+	}
+	slog.Log(ctx, level, "HTTP request",
+		"method", c.Request.Method,
+		"route", route,
+		"status", status,
+		"duration_ms", time.Since(start).Milliseconds(),
+		"client_ip", c.ClientIP(),
+	)
+}
+
+// isProbePath cho biết request là scrape metrics hoặc health check, không cần trace và chỉ log ở mức debug
+func isProbePath(path string) bool {
+	return path == "/metrics" || path == "/healthz" || path == "/readyz"
+}
+
+// dbSlowQueryThreshold là ngưỡng ghi log truy vấn chậm, cấu hình qua DB_SLOW_QUERY_THRESHOLD
+var dbSlowQueryThreshold = envDuration("DB_SLOW_QUERY_THRESHOLD", 200*time.Millisecond)
+
+// dbLogger ghi log của gorm qua slog. Câu SQL chỉ được ghi dạng tham số hóa vì giá trị chứa
+// embedding và ảnh chụp; không tìm thấy bản ghi không phải lỗi.
+func dbLogger() gormlogger.Interface {
+	return logging.NewGormLogger(gormlogger.Config{
+		SlowThreshold:             dbSlowQueryThreshold,
+		LogLevel:                  gormlogger.Warn,
+		IgnoreRecordNotFoundError: true,
+		ParameterizedQueries:      true,
+	})
+}
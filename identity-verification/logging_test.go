@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+
+	"isafe/shared/logging"
+)
+
+// captureLogs chuyển slog mặc định sang buffer trong thời gian chạy test
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(logging.NewHandler(&buf, slog.LevelDebug, true)))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
+
+func TestDBLoggerOmitsEmbedding(t *testing.T) {
+	previous := dbSlowQueryThreshold
+	dbSlowQueryThreshold = time.Nanosecond // mọi truy vấn đều "chậm" để bị ghi log
+	t.Cleanup(func() { dbSlowQueryThreshold = previous })
+
+	embedding := pq.Array([]float64{0.123456, 0.654321})
+	tests := []struct {
+		name   string
+		dryRun bool
+		want   string
+	}{
+		{"slow query", true, "Slow database query"},
+		// Không có Postgres ở cổng 1 nên truy vấn lỗi kết nối
+		{"failed query", false, "Database query failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := gorm.Open(postgres.Open("host=127.0.0.1 port=1 user=test dbname=test sslmode=disable connect_timeout=1"),
+				&gorm.Config{Logger: dbLogger(), DryRun: tt.dryRun, DisableAutomaticPing: true})
+			if err != nil {
+				t.Fatalf("open: %v", err)
+			}
+			logs := captureLogs(t)
+
+			var user User
+			conn.Where("face_embedding = ?", embedding).First(&user)
+
+			out := logs.String()
+			if !strings.Contains(out, tt.want) || !strings.Contains(out, "face_embedding = $1") {
+				t.Fatalf("log does not contain the parameterized query: %s", out)
+			}
+			if strings.Contains(out, "0.123456") {
+				t.Fatalf("log contains the embedding: %s", out)
+			}
+		})
+	}
+}
+
+func TestDBLoggerIgnoresRecordNotFound(t *testing.T) {
+	logs := captureLogs(t)
+	dbLogger().Trace(context.Background(), time.Now(), func() (string, int64) {
+		return `SELECT * FROM "users" WHERE face_embedding = $1`, 0
+	}, gorm.ErrRecordNotFound)
+	if logs.Len() != 0 {
+		t.Fatalf("record not found was logged: %s", logs.String())
+	}
+}
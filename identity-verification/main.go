@@ -1,47 +1,38 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"encoding/base64"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
-	"log"
+	"log/slog"
 	"math"
-	"mime/multipart"
 	"net/http"
 	"os"
-	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/lib/pq"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel/attribute"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	gormtracing "gorm.io/plugin/opentelemetry/tracing"
+
+	"isafe/shared/domain"
+	"isafe/shared/lifecycle"
+	"isafe/shared/logging"
+	"isafe/shared/tracing"
 )
 
-// User là mô hình người dùng trong cơ sở dữ liệu
-type User struct {
-	ID            uint `gorm:"primaryKey"`
-	Name          string
-	FaceEmbedding pq.Float64Array `gorm:"type:float8[]"`
-	Role          string
-	SnapshotPath  string `json:"snapshot_path"`
-	LastSeen      time.Time
-}
+// User là người dùng đã đăng ký khuôn mặt; identity-verification quản lý schema bảng users
+type User = domain.User
 
-// Alert là mô hình cảnh báo trong cơ sở dữ liệu
-type Alert struct {
-	ID           uint      `gorm:"primaryKey" json:"id"`
-	Similarity   float64   `json:"similarity"`
-	AlertMessage string    `json:"alert_message"`
-	FaceSnapshot string    `json:"face_snapshot"` // Base64 string
-	Timestamp    time.Time `json:"timestamp"`
-	Status       string    `json:"status"`
-}
+// Alert là cảnh báo gửi sang Alert Service. Bảng alerts do Alert Service quản lý schema,
+// dịch vụ này chỉ đọc để hiển thị nên không có trong migration của dịch vụ.
+type Alert = domain.Alert
 
 // VerificationRequest là yêu cầu xác thực khuôn mặt
 type VerificationRequest struct {
@@ -50,15 +41,34 @@ type VerificationRequest struct {
 
 // VerificationResponse là phản hồi sau khi xác thực khuôn mặt
 type VerificationResponse struct {
-	Match        bool    `json:"match"`
-	User         User    `json:"user,omitempty"`
-	Similarity   float64 `json:"similarity,omitempty"`
-	AlertMessage string  `json:"alert_message,omitempty"`
+	Match        bool     `json:"match"`
+	User         User     `json:"user,omitempty"`
+	Visitor      *Visitor `json:"visitor,omitempty"`
+	Similarity   float64  `json:"similarity,omitempty"`
+	AlertMessage string   `json:"alert_message,omitempty"`
 }
 
+// matchThreshold là ngưỡng độ tương tự để coi hai khuôn mặt là một người
+const matchThreshold = 0.7
+
+// allowedOrigins là các origin của frontend được phép gọi API
+var allowedOrigins = []string{"http://202.92.6.77:3000", "http://localhost:3000", "https://insight.io.vn"}
+
 var db *gorm.DB
 
+// serviceName là tên dịch vụ trong trace và metrics
+const serviceName = "identity-verification"
+
+// tracer tạo span cho các bước trong luồng xác thực
+var tracer = tracing.Tracer(serviceName)
+
+// app theo dõi worker nền và điều phối tắt dịch vụ; SHUTDOWN_TIMEOUT là thời gian drain tối đa
+var app = lifecycle.New(envDuration("SHUTDOWN_TIMEOUT", 30*time.Second))
+
 func main() {
+	// Log JSON có request_id, mức log theo LOG_LEVEL
+	logging.Setup(serviceName)
+
 	// Thiết lập các biến môi trường (có thể được thiết lập bên ngoài trong thực tế)
 	os.Setenv("DB_HOST", "localhost")
 	os.Setenv("DB_PORT", "5433")
@@ -75,53 +85,140 @@ func main() {
 
 	// Kiểm tra các biến môi trường
 	if host == "" || port == "" || user == "" || password == "" || dbname == "" {
-		log.Fatal("Database connection parameters are not set")
+		logging.Fatal("Database connection parameters are not set")
 	}
 
 	// Tạo chuỗi kết nối (DSN)
 	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable TimeZone=Asia/Ho_Chi_Minh",
 		host, user, password, dbname, port)
 
-	log.Println("Connecting to database with DSN:", dsn)
-	var err error
-	db, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	// Tracing OpenTelemetry, exporter cấu hình qua OTEL_TRACES_EXPORTER và OTEL_EXPORTER_OTLP_ENDPOINT
+	shutdownTracing, err := tracing.Init(context.Background(), serviceName)
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		logging.Fatal("Failed to configure tracing", "error", err)
 	}
 
-	// Tự động migrate schema
-	if err := db.AutoMigrate(&User{}, &Alert{}); err != nil {
-		log.Fatalf("AutoMigrate failed: %v", err)
+	slog.Info("Connecting to database", "host", host, "port", port, "user", user, "database", dbname)
+	db, err = gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: dbLogger()})
+	if err != nil {
+		logging.Fatal("Failed to connect to database", "error", err)
+	}
+	// Mỗi truy vấn có span riêng; không ghi giá trị tham số vì chứa embedding và ảnh
+	if err := db.Use(gormtracing.NewPlugin(gormtracing.WithoutMetrics(), gormtracing.WithoutQueryVariables())); err != nil {
+		logging.Fatal("Failed to enable database tracing", "error", err)
+	}
+
+	// Cập nhật schema bằng migration SQL có phiên bản (xem migrations/)
+	if runMigrations() {
+		return
 	}
 
 	// Thiết lập router với CORS
-	router := gin.Default()
+	router := gin.New()
+	router.Use(gin.Recovery())
+
+	// Chỉ tin X-Forwarded-For từ reverse proxy đã khai báo, để client không giả mạo IP và né giới hạn tần suất
+	if err := router.SetTrustedProxies(trustedProxies()); err != nil {
+		logging.Fatal("Invalid TRUSTED_PROXIES", "error", err)
+	}
 
 	config := cors.Config{
-		AllowOrigins:     []string{"http://202.92.6.77:3000", "http://localhost:3000", "https://insight.io.vn"},
+		AllowOrigins:     allowedOrigins,
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", logging.RequestIDHeader, deviceIDHeader},
+		ExposeHeaders:    []string{"Content-Length", logging.RequestIDHeader},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}
 
 	router.Use(cors.New(config))
+	router.Use(otelgin.Middleware(serviceName, otelgin.WithFilter(func(r *http.Request) bool {
+		return !isProbePath(r.URL.Path)
+	})))
+	router.Use(metricsMiddleware)
+	router.Use(requestLogMiddleware)
+
+	// Định kỳ xóa embedding của khách hết hạn
+	app.Go(runVisitorPurger)
+
+	// Nhận sự kiện cảnh báo từ Alert Service để đẩy lên dashboard
+	app.Go(func() { listenAlertEvents(dsn) })
+
+	// Chuyển cảnh báo trong outbox sang Alert Service, thử lại khi dịch vụ không sẵn sàng
+	app.Go(runAlertHandoff)
+
+	// Gửi sự kiện tới các webhook đã đăng ký của hệ thống bên ngoài; sự kiện xác thực được xếp hàng
+	// ngay khi xác thực, sự kiện cảnh báo được xếp hàng từ bảng alert_events của Alert Service
+	app.Go(runAlertEventWebhooks)
+	app.Go(runWebhookWorker)
+
+	// Thu nhận khung hình từ các camera IP đã cấu hình
+	app.Go(cameras.run)
 
 	// Định nghĩa các route
-	router.POST("/verify_face", verifyFaceHandler)
+	router.GET("/healthz", healthzHandler)
+	router.GET("/readyz", readyzHandler)
+	router.GET("/metrics", metricsHandler)
+	router.POST("/verify_face", verifyLimiter.middleware, limitBody(maxRequestBodyBytes), verifyFaceHandler)
 	router.GET("/alerts", getAlertsHandler)
-	router.POST("/add_user", addUserHandler)
+	router.GET("/events", streamEventsHandler)
+	router.GET("/ws/verify", verifyLimiter.middleware, verifyStreamHandler)
+	router.POST("/add_user", enrollLimiter.middleware, limitBody(maxRequestBodyBytes), addUserHandler)
 	router.GET("/users", getUsersHandler) // Thêm API để lấy danh sách người dùng
 	router.GET("/users/:id/snapshots", getUserSnapshotsHandler)
-	router.PUT("/users/:id", updateUserHandler)
+	router.PUT("/users/:id", enrollLimiter.middleware, limitBody(maxRequestBodyBytes), updateUserHandler)
 	router.DELETE("/users/:id", deleteUserHandler)
 	router.GET("/users/:id", getUserByIdHandler)
+	router.GET("/users/:id/visits", getHostVisitsHandler)
+
+	router.GET("/devices", getDevicesHandler)
+	router.POST("/devices", saveDeviceHandler)
+	router.PUT("/devices/:id", saveDeviceHandler)
+	router.DELETE("/devices/:id", deleteDeviceHandler)
+	router.GET("/cameras/health", getCameraHealthHandler)
+
+	router.GET("/sites", getSitesHandler)
+	router.POST("/sites", saveSiteHandler)
+	router.PUT("/sites/:id", saveSiteHandler)
+	router.DELETE("/sites/:id", deleteSiteHandler)
+
+	router.GET("/shifts", getShiftsHandler)
+	router.POST("/shifts", saveShiftHandler)
+	router.PUT("/shifts/:id", saveShiftHandler)
+	router.DELETE("/shifts/:id", deleteShiftHandler)
+
+	router.GET("/attendance/daily", getDailyAttendanceHandler)
+	router.GET("/attendance/monthly", getMonthlyAttendanceHandler)
+
+	router.POST("/visitors", enrollLimiter.middleware, limitBody(maxRequestBodyBytes), createVisitorHandler)
+	router.GET("/visitors", getVisitorsHandler)
+	router.GET("/visitors/:id", getVisitorByIdHandler)
+	router.DELETE("/visitors/:id", deleteVisitorHandler)
+	router.GET("/visitors/:id/checkins", getVisitorCheckInsHandler)
+	router.GET("/visitors/enroll/:token", getVisitorEnrollmentHandler)
+	router.POST("/visitors/enroll/:token", enrollLimiter.middleware, limitBody(maxRequestBodyBytes), enrollVisitorHandler)
+
+	router.GET("/webhooks", getWebhooksHandler)
+	router.POST("/webhooks", saveWebhookHandler)
+	router.PUT("/webhooks/:id", saveWebhookHandler)
+	router.DELETE("/webhooks/:id", deleteWebhookHandler)
+	router.GET("/webhooks/:id/deliveries", getWebhookDeliveriesHandler)
+	router.POST("/webhook_deliveries/:id/replay", replayWebhookDeliveryHandler)
+
+	// Chạy server trên cổng 8080 cho tới khi nhận SIGTERM, sau đó chờ request và outbox xử lý xong
+	srv := &http.Server{Addr: ":8080", Handler: router, ReadHeaderTimeout: 10 * time.Second}
+	if err := app.Run(srv, shutdownTracing, closeDatabase); err != nil {
+		logging.Fatal("Failed to run server", "error", err)
+	}
+}
 
-	// Chạy server trên cổng 8080
-	if err := router.Run(":8080"); err != nil {
-		log.Fatalf("Failed to run server: %v", err)
+// closeDatabase đóng các kết nối cơ sở dữ liệu khi tắt dịch vụ
+func closeDatabase(context.Context) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
 	}
+	return sqlDB.Close()
 }
 
 // verifyFaceHandler xử lý yêu cầu xác thực khuôn mặt
@@ -129,182 +226,58 @@ func verifyFaceHandler(c *gin.Context) {
 	// Lấy hình ảnh từ yêu cầu client
 	file, _, err := c.Request.FormFile("image")
 	if err != nil {
-		log.Printf("Error retrieving image from request: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Image is required"})
+		slog.WarnContext(c.Request.Context(), "Error retrieving image from request", "error", err)
+		respondImageError(c, err, "Image is required")
 		return
 	}
 	defer file.Close()
 
+	// Thiết bị gửi ảnh (tùy chọn), dùng để xác định khu vực
+	device := lookupDevice(requestDeviceID(c))
+
 	// Đọc dữ liệu hình ảnh
-	imageBytes, err := io.ReadAll(file)
-	if err != nil {
-		log.Printf("Error reading image data: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read image"})
+	ctx := c.Request.Context()
+	_, readSpan := tracer.Start(ctx, "verify.read_image")
+	imageBytes, err := readImage(file)
+	readSpan.SetAttributes(attribute.Int("image.bytes", len(imageBytes)))
+	readSpan.End()
+	if errors.Is(err, errImageTooLarge) {
+		respondTooLarge(c, maxImageBytes)
 		return
 	}
-
-	// Tạo một buffer để chứa dữ liệu multipart
-	var requestBody bytes.Buffer
-	writer := multipart.NewWriter(&requestBody)
-
-	// Thêm file hình ảnh vào multipart với trường 'image'
-	part, err := writer.CreateFormFile("image", filepath.Base("upload.jpg"))
 	if err != nil {
-		log.Printf("Error creating form file: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create form file"})
+		slog.ErrorContext(c.Request.Context(), "Error reading image data", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read image"})
 		return
 	}
 
-	_, err = part.Write(imageBytes)
+	// Lấy embedding từ Face Recognition service
+	embedding, err := fetchEmbedding(ctx, priorityLive, imageBytes, "upload.jpg")
 	if err != nil {
-		log.Printf("Error writing image to form file: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write image to form"})
+		respondEmbeddingError(c, err)
 		return
 	}
 
-	// Kết thúc việc tạo multipart
-	if err := writer.Close(); err != nil {
-		log.Printf("Error closing multipart writer: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to close form writer"})
-		return
-	}
-
-	// Gửi yêu cầu POST đến Flask service
-	faceRecURL := "http://localhost:5001/process_image"
-	resp, err := http.Post(faceRecURL, writer.FormDataContentType(), &requestBody)
+	id, err := identify(ctx, embedding)
 	if err != nil {
-		log.Printf("Error communicating with Face Recognition service: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to communicate with Face Recognition service"})
+		respondVerifyError(c, err)
 		return
 	}
-	defer resp.Body.Close()
 
-	// Xử lý phản hồi từ Flask
-	bodyResp, err := io.ReadAll(resp.Body)
+	resp, err := applyVerification(ctx, id, device, imageBytes)
 	if err != nil {
-		log.Printf("Error reading response from Face Recognition service: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read response from Face Recognition service"})
-		return
-	}
-
-	var faceResp map[string]interface{}
-	if err := json.Unmarshal(bodyResp, &faceResp); err != nil {
-		log.Printf("Error unmarshalling JSON response: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid response from Face Recognition service"})
-		return
-	}
-
-	if _, exists := faceResp["error"]; exists {
-		log.Printf("Error from Face Recognition service: %v", faceResp["error"])
-		c.JSON(http.StatusBadRequest, faceResp)
-		return
-	}
-
-	// Xử lý embedding nhận được
-	embeddingInterface, ok := faceResp["embedding"].([]interface{})
-	if !ok || len(embeddingInterface) == 0 {
-		log.Printf("Embedding not found or invalid in response: %v", faceResp)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Embedding not found in response"})
+		respondVerifyError(c, err)
 		return
 	}
 
-	// Chuyển []interface{} thành []float64
-	var embeddingFloat []float64
-	for _, v := range embeddingInterface {
-		if num, ok := v.(float64); ok {
-			embeddingFloat = append(embeddingFloat, num)
-		} else {
-			log.Printf("Invalid type in embedding: %v", v)
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid embedding data"})
-			return
-		}
-	}
-
-	// So sánh với tất cả các embeddings trong cơ sở dữ liệu
-	var users []User
-	if err := db.Find(&users).Error; err != nil {
-		log.Printf("Error fetching users from database: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
-		return
-	}
-
-	highestSimilarity := -1.0
-	var matchedUser User
-
-	for _, user := range users {
-		similarity := cosineSimilarity(embeddingFloat, user.FaceEmbedding)
-		if similarity > highestSimilarity {
-			highestSimilarity = similarity
-			matchedUser = user
-		}
-	}
-
-	threshold := 0.7
-	if highestSimilarity >= threshold {
-		// Cập nhật LastSeen
-		if err := db.Model(&matchedUser).Update("LastSeen", time.Now()).Error; err != nil {
-			log.Printf("Error updating LastSeen: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update LastSeen"})
-			return
-		}
-
-		// Lưu snapshot
-		if matchedUser.ID != 0 {
-			snapshotDir := fmt.Sprintf("./uploads/users/%d", matchedUser.ID)
-			os.MkdirAll(snapshotDir, os.ModePerm)
-
-			timestamp := time.Now().Format("20060102_150405")
-			filename := fmt.Sprintf("%s/%s_%s", snapshotDir, "snapshot", timestamp)
-			err := os.WriteFile(filename+".jpg", imageBytes, os.ModePerm)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save snapshot"})
-				return
-			}
-		}
-
-		c.JSON(http.StatusOK, VerificationResponse{
-			Match:      true,
-			User:       matchedUser,
-			Similarity: highestSimilarity,
-		})
-	} else {
-		// Gửi cảnh báo tới Alert Service
-		alertURL := "http://localhost:8081/send_alert"
-
-		alertData := map[string]interface{}{
-			"similarity":    highestSimilarity,
-			"alert_message": "Unrecognized face detected",
-			"face_snapshot": base64.StdEncoding.EncodeToString(imageBytes), // Encode image to base64
-			"timestamp":     time.Now().Format(time.RFC3339),               // ISO format
-			"status":        "unrecognized",
-		}
-		alertBytes, err := json.Marshal(alertData)
-		if err != nil {
-			log.Printf("Error marshalling alert data: %v", err)
-		}
-		alertBody := bytes.NewBuffer(alertBytes)
-
-		respAlert, err := http.Post(alertURL, "application/json", alertBody)
-		if err != nil {
-			log.Printf("Error sending alert: %v", err)
-		} else {
-			defer respAlert.Body.Close()
-			log.Printf("Alert sent successfully with status: %s", respAlert.Status)
-		}
-
-		c.JSON(http.StatusOK, VerificationResponse{
-			Match:        false,
-			Similarity:   highestSimilarity,
-			AlertMessage: "Unrecognized face detected",
-		})
-	}
+	c.JSON(http.StatusOK, resp)
 }
 
 // getAlertsHandler lấy danh sách cảnh báo từ cơ sở dữ liệu
 func getAlertsHandler(c *gin.Context) {
 	var alerts []Alert
 	if err := db.Find(&alerts).Error; err != nil {
-		log.Printf("Error fetching alerts from database: %v", err)
+		slog.ErrorContext(c.Request.Context(), "Error fetching alerts from database", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
 	}
@@ -320,108 +293,39 @@ func addUserHandler(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		log.Printf("Error binding JSON: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		slog.ErrorContext(c.Request.Context(), "Error binding JSON", "error", err)
+		respondImageError(c, err, err.Error())
 		return
 	}
 
 	if req.Name == "" || req.Role == "" || req.FaceSnapshot == "" {
-		log.Printf("Missing fields in request: %+v", req)
+		slog.WarnContext(c.Request.Context(), "Missing fields in add user request", "has_name", req.Name != "", "has_role", req.Role != "", "has_face_snapshot", req.FaceSnapshot != "")
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing fields"})
 		return
 	}
 
+	ctx := c.Request.Context()
+
 	// Giải mã base64
 	decodedImage, err := decodeBase64Image(req.FaceSnapshot)
 	if err != nil {
-		log.Printf("Error decoding base64 image: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid face_snapshot"})
-		return
-	}
-
-	// Tạo multipart/form-data
-	var requestBody bytes.Buffer
-	writer := multipart.NewWriter(&requestBody)
-	part, err := writer.CreateFormFile("image", "capture.jpg")
-	if err != nil {
-		log.Printf("Error creating form file: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create form file"})
-		return
-	}
-
-	_, err = io.Copy(part, bytes.NewReader(decodedImage))
-	if err != nil {
-		log.Printf("Error copying image data to form file: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to copy image data"})
-		return
-	}
-
-	// Kết thúc việc tạo multipart
-	if err := writer.Close(); err != nil {
-		log.Printf("Error closing multipart writer: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to close form writer"})
-		return
-	}
-
-	// Gửi ảnh tới face-recognition service
-	faceRecURL := "http://localhost:5001/process_image" // Đảm bảo URL đúng
-	log.Printf("Sending POST request to Face Recognition service: %s", faceRecURL)
-
-	resp, err := http.Post(faceRecURL, writer.FormDataContentType(), &requestBody)
-	if err != nil {
-		log.Printf("Error communicating with Face Recognition service: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to communicate with Face Recognition service"})
+		slog.WarnContext(c.Request.Context(), "Error decoding base64 image", "error", err)
+		respondImageError(c, err, "Invalid face_snapshot")
 		return
 	}
-	defer resp.Body.Close()
 
-	// Xử lý phản hồi từ Flask
-	body, err := io.ReadAll(resp.Body)
+	// Lấy embedding từ Face Recognition service; đăng ký nhường slot cho xác thực trực tiếp
+	embeddingFloat, err := fetchEmbedding(ctx, priorityEnroll, decodedImage, "capture.jpg")
 	if err != nil {
-		log.Printf("Error reading response from Face Recognition service: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read response from Face Recognition service"})
+		respondEmbeddingError(c, err)
 		return
 	}
 
-	log.Printf("Response from Face Recognition service: %s", string(body))
-
-	var faceResp map[string]interface{}
-	if err := json.Unmarshal(body, &faceResp); err != nil {
-		log.Printf("Error unmarshalling JSON response: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid response from Face Recognition service"})
-		return
-	}
-
-	if _, exists := faceResp["error"]; exists {
-		log.Printf("Error from Face Recognition service: %v", faceResp["error"])
-		c.JSON(http.StatusBadRequest, faceResp)
-		return
-	}
-
-	embeddingInterface, ok := faceResp["embedding"].([]interface{})
-	if !ok || len(embeddingInterface) == 0 {
-		log.Printf("Embedding not found or invalid in response: %v", faceResp)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Embedding not found in response"})
-		return
-	}
-
-	// Chuyển []interface{} thành []float64
-	var embeddingFloat []float64
-	for _, v := range embeddingInterface {
-		if num, ok := v.(float64); ok {
-			embeddingFloat = append(embeddingFloat, num)
-		} else {
-			log.Printf("Invalid type in embedding: %v", v)
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid embedding data"})
-			return
-		}
-	}
-
-	log.Printf("Received embedding: %v", embeddingFloat)
+	slog.DebugContext(c.Request.Context(), "Received embedding", "dimensions", len(embeddingFloat))
 
 	// Kiểm tra xem embedding đã tồn tại trong cơ sở dữ liệu hay chưa
 	var existingUser User
-	if err := db.Where("face_embedding = ?", pq.Array(embeddingFloat)).First(&existingUser).Error; err == nil {
+	if err := db.WithContext(ctx).Where("face_embedding = ?", pq.Array(embeddingFloat)).First(&existingUser).Error; err == nil {
 		// Nếu đã tồn tại, trả về thông tin người dùng
 		c.JSON(http.StatusOK, VerificationResponse{
 			Match:      true,
@@ -439,13 +343,13 @@ func addUserHandler(c *gin.Context) {
 		LastSeen:      time.Now(),
 	}
 
-	if err := db.Create(&newUser).Error; err != nil {
-		log.Printf("Error creating new user: %v", err)
+	if err := db.WithContext(ctx).Create(&newUser).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error creating new user", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
 		return
 	}
 
-	log.Printf("New user created: %+v", newUser)
+	slog.InfoContext(c.Request.Context(), "User created", "user_id", newUser.ID, "role", newUser.Role)
 
 	c.JSON(http.StatusOK, VerificationResponse{
 		Match:      true,
@@ -458,23 +362,30 @@ func addUserHandler(c *gin.Context) {
 func getUsersHandler(c *gin.Context) {
 	var users []User
 	if err := db.Find(&users).Error; err != nil {
-		log.Printf("Error fetching users from database: %v", err)
+		slog.ErrorContext(c.Request.Context(), "Error fetching users from database", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
 	}
 	c.JSON(http.StatusOK, users)
 }
 
-// decodeBase64Image giải mã hình ảnh từ chuỗi base64
+// decodeBase64Image giải mã hình ảnh từ chuỗi base64, trả về errImageTooLarge nếu ảnh vượt maxImageBytes
 func decodeBase64Image(encoded string) ([]byte, error) {
 	// Xóa tiền tố nếu có (ví dụ: "data:image/png;base64,")
 	if idx := strings.Index(encoded, ","); idx != -1 {
 		encoded = encoded[idx+1:]
 	}
+	// Kiểm tra trước khi giải mã để không cấp phát bộ nhớ cho ảnh quá lớn (DecodedLen tính cả padding)
+	if int64(base64.StdEncoding.DecodedLen(len(encoded))) > maxImageBytes+2 {
+		return nil, errImageTooLarge
+	}
 	decoded, err := base64.StdEncoding.DecodeString(encoded)
 	if err != nil {
 		return nil, errors.New("invalid base64 encoding")
 	}
+	if int64(len(decoded)) > maxImageBytes {
+		return nil, errImageTooLarge
+	}
 	return decoded, nil
 }
 
@@ -538,10 +449,11 @@ func updateUserHandler(c *gin.Context) {
 		Name         string `json:"name"`
 		Role         string `json:"role"`
 		FaceSnapshot string `json:"face_snapshot"`
+		ShiftID      *uint  `json:"shift_id"` // Tùy chọn, giữ nguyên ca hiện tại nếu bỏ trống
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		respondImageError(c, err, "Invalid request body")
 		return
 	}
 
@@ -554,6 +466,9 @@ func updateUserHandler(c *gin.Context) {
 	// Cập nhật thông tin
 	user.Name = req.Name
 	user.Role = req.Role
+	if req.ShiftID != nil {
+		user.ShiftID = req.ShiftID
+	}
 
 	if req.FaceSnapshot != "" {
 		// Lưu snapshot mới
@@ -565,7 +480,7 @@ func updateUserHandler(c *gin.Context) {
 
 		decodedImage, err := decodeBase64Image(req.FaceSnapshot)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid face snapshot"})
+			respondImageError(c, err, "Invalid face snapshot")
 			return
 		}
 
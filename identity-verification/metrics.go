@@ -0,0 +1,154 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Kết quả xác thực dùng làm nhãn result của isafe_verifications_total
+const (
+	resultMatched         = "matched"
+	resultVisitorAllowed  = "visitor_allowed"
+	resultVisitorRejected = "visitor_rejected"
+	resultUnrecognized    = "unrecognized"
+)
+
+var (
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "isafe_http_request_duration_seconds",
+		Help:    "HTTP request latency by route and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	faceRecDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "isafe_face_recognition_duration_seconds",
+		Help:    "Latency of calls to the face recognition service.",
+		Buckets: []float64{.05, .1, .25, .5, 1, 2, 5, 10},
+	}, []string{"outcome"})
+
+	faceRecQueueWait = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "isafe_face_recognition_queue_wait_seconds",
+		Help:    "Time spent waiting for a face recognition slot by priority.",
+		Buckets: []float64{.01, .05, .1, .25, .5, 1, 2, 5},
+	}, []string{"priority"})
+
+	faceRecShed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "isafe_face_recognition_shed_total",
+		Help: "Face recognition calls rejected without being sent by priority and reason (queue_full, timeout, preempted).",
+	}, []string{"priority", "reason"})
+
+	faceRecErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "isafe_face_recognition_errors_total",
+		Help: "Failed face recognition calls by reason (transport, invalid_response, no_face).",
+	}, []string{"reason"})
+
+	verificationSimilarity = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "isafe_verification_similarity",
+		Help:    "Best similarity score of each verification.",
+		Buckets: prometheus.LinearBuckets(0, 0.05, 21),
+	})
+
+	verificationResults = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "isafe_verifications_total",
+		Help: "Verification results by device (matched, visitor_allowed, visitor_rejected, unrecognized).",
+	}, []string{"device_id", "result"})
+
+	alertsRaised = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "isafe_alerts_raised_total",
+		Help: "Alerts queued for the alert service by alert status.",
+	}, []string{"status"})
+
+	alertHandoffs = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "isafe_alert_handoffs_total",
+		Help: "Attempts to hand alerts to the alert service by outcome (delivered, retry, rejected).",
+	}, []string{"outcome"})
+
+	requestsRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "isafe_requests_rejected_total",
+		Help: "Requests rejected before processing by route and reason (rate_limited, too_large).",
+	}, []string{"route", "reason"})
+
+	webhookDeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "isafe_webhook_deliveries_total",
+		Help: "Outbound webhook delivery attempts by event type and outcome (delivered, retry, failed).",
+	}, []string{"event_type", "outcome"})
+)
+
+func init() {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "isafe_face_recognition_in_flight",
+		Help: "Face recognition calls currently being processed.",
+	}, func() float64 {
+		return float64(faceRecLimiter.inFlight())
+	})
+	for prio := faceRecPriority(0); prio < numFaceRecPriorities; prio++ {
+		prio := prio
+		promauto.NewGaugeFunc(prometheus.GaugeOpts{
+			Name:        "isafe_face_recognition_queue_depth",
+			Help:        "Face recognition calls waiting for a slot.",
+			ConstLabels: prometheus.Labels{"priority": prio.String()},
+		}, func() float64 {
+			return float64(faceRecLimiter.queueLen(prio))
+		})
+	}
+
+	// Kích thước gallery được đếm khi Prometheus scrape để luôn khớp với cơ sở dữ liệu
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name:        "isafe_gallery_size",
+		Help:        "Number of enrolled face embeddings.",
+		ConstLabels: prometheus.Labels{"kind": "user"},
+	}, func() float64 {
+		return countRows(&User{}, "face_embedding IS NOT NULL")
+	})
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name:        "isafe_gallery_size",
+		Help:        "Number of enrolled face embeddings.",
+		ConstLabels: prometheus.Labels{"kind": "visitor"},
+	}, func() float64 {
+		now := time.Now()
+		return countRows(&Visitor{}, "purged_at IS NULL AND enrolled_at IS NOT NULL AND valid_from <= ? AND valid_until > ?", now, now)
+	})
+}
+
+// countRows đếm số bản ghi của truy vấn, trả về 0 khi chưa kết nối hoặc truy vấn lỗi
+func countRows(model interface{}, where string, args ...interface{}) float64 {
+	if db == nil {
+		return 0
+	}
+	var count int64
+	if err := db.Model(model).Where(where, args...).Count(&count).Error; err != nil {
+		return 0
+	}
+	return float64(count)
+}
+
+// metricsMiddleware đo thời gian xử lý mỗi request theo route đã khớp (không theo URL thật để tránh bùng nhãn)
+func metricsMiddleware(c *gin.Context) {
+	start := time.Now()
+	c.Next()
+
+	route := c.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+	httpRequestDuration.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).
+		Observe(time.Since(start).Seconds())
+}
+
+// metricsHandler trả metrics theo định dạng Prometheus
+var metricsHandler = gin.WrapH(promhttp.Handler())
+
+// recordVerification ghi nhận kết quả một lần xác thực
+func recordVerification(device *Device, result string, similarity float64) {
+	deviceLabel := deviceID(device)
+	if deviceLabel == "" {
+		deviceLabel = "unknown"
+	}
+	verificationResults.WithLabelValues(deviceLabel, result).Inc()
+	verificationSimilarity.Observe(similarity)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"os"
+
+	"isafe/shared/logging"
+	"isafe/shared/migrate"
+)
+
+// migrationFiles là các migration SQL của identity-verification, đánh số tăng dần
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// newMigrator tạo migrator cho các bảng do identity-verification quản lý
+func newMigrator() (*migrate.Migrator, error) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	return migrate.New(sqlDB, "identity-verification", migrationFiles, "migrations", logging.Infof)
+}
+
+// runMigrations xử lý lệnh "main migrate <command>" nếu có, trả về true khi chương trình nên thoát.
+// Khi khởi động bình thường thì chạy mọi migration còn thiếu, trừ khi MIGRATE_ON_START=false
+// (khi đó chạy "main migrate up" như một bước riêng trước khi deploy).
+func runMigrations() bool {
+	migrator, err := newMigrator()
+	if err != nil {
+		logging.Fatal("Failed to load migrations", "error", err)
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := migrator.RunCommand(context.Background(), os.Args[2:], os.Stdout); err != nil {
+			logging.Fatal("Migration failed", "error", err)
+		}
+		return true
+	}
+
+	if os.Getenv("MIGRATE_ON_START") == "false" {
+		return false
+	}
+	if err := migrator.Up(context.Background()); err != nil {
+		logging.Fatal("Migration failed", "error", err)
+	}
+	return false
+}
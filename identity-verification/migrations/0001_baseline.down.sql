@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS "webhook_deliveries";
+DROP TABLE IF EXISTS "webhook_subscriptions";
+DROP TABLE IF EXISTS "alert_handoffs";
+DROP TABLE IF EXISTS "shifts";
+DROP TABLE IF EXISTS "recognition_events";
+DROP TABLE IF EXISTS "visitor_check_ins";
+DROP TABLE IF EXISTS "visitors";
+DROP TABLE IF EXISTS "sites";
+DROP TABLE IF EXISTS "devices";
+DROP TABLE IF EXISTS "users";
@@ -0,0 +1,131 @@
+-- Schema của identity-verification tại thời điểm bỏ AutoMigrate.
+-- Dùng IF NOT EXISTS để cơ sở dữ liệu đã được AutoMigrate tạo trước đó chuyển sang migration mà không lỗi.
+-- Bảng alerts do alert-service quản lý.
+
+CREATE TABLE IF NOT EXISTS "users" (
+    "id" bigserial,
+    "name" text,
+    "face_embedding" float8[],
+    "role" text,
+    "snapshot_path" text,
+    "last_seen" timestamptz,
+    "shift_id" bigint,
+    PRIMARY KEY ("id")
+);
+
+CREATE TABLE IF NOT EXISTS "devices" (
+    "id" text,
+    "name" text,
+    "zone" text,
+    "site_id" bigint,
+    "stream_url" text,
+    "sample_fps" decimal,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_devices_site_id" ON "devices" ("site_id");
+
+CREATE TABLE IF NOT EXISTS "sites" (
+    "id" bigserial,
+    "name" text,
+    "timezone" text,
+    PRIMARY KEY ("id")
+);
+
+CREATE TABLE IF NOT EXISTS "visitors" (
+    "id" bigserial,
+    "name" text,
+    "company" text,
+    "phone" text,
+    "host_user_id" bigint,
+    "valid_from" timestamptz,
+    "valid_until" timestamptz,
+    "allowed_zones" text[],
+    "face_embedding" float8[],
+    "enroll_token" text,
+    "enrolled_at" timestamptz,
+    "purged_at" timestamptz,
+    "last_seen" timestamptz,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_visitors_enroll_token" ON "visitors" ("enroll_token");
+CREATE INDEX IF NOT EXISTS "idx_visitors_valid_until" ON "visitors" ("valid_until");
+CREATE INDEX IF NOT EXISTS "idx_visitors_host_user_id" ON "visitors" ("host_user_id");
+
+CREATE TABLE IF NOT EXISTS "visitor_check_ins" (
+    "id" bigserial,
+    "visitor_id" bigint,
+    "device_id" text,
+    "zone" text,
+    "similarity" decimal,
+    "allowed" boolean,
+    "timestamp" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_visitor_check_ins_visitor_id" ON "visitor_check_ins" ("visitor_id");
+
+CREATE TABLE IF NOT EXISTS "recognition_events" (
+    "id" bigserial,
+    "user_id" bigint,
+    "device_id" text,
+    "similarity" decimal,
+    "timestamp" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_recognition_events_device_id" ON "recognition_events" ("device_id");
+CREATE INDEX IF NOT EXISTS "idx_recognition_user_time" ON "recognition_events" ("user_id","timestamp");
+
+CREATE TABLE IF NOT EXISTS "shifts" (
+    "id" bigserial,
+    "name" text,
+    "start_time" text,
+    "end_time" text,
+    "late_grace_minutes" bigint,
+    "early_leave_grace_minutes" bigint,
+    PRIMARY KEY ("id")
+);
+
+CREATE TABLE IF NOT EXISTS "alert_handoffs" (
+    "id" bigserial,
+    "event_id" text,
+    "payload" text,
+    "status" text,
+    "attempts" bigint,
+    "next_attempt_at" timestamptz,
+    "last_error" text,
+    "delivered_at" timestamptz,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_handoff_due" ON "alert_handoffs" ("status","next_attempt_at");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_alert_handoffs_event_id" ON "alert_handoffs" ("event_id");
+
+CREATE TABLE IF NOT EXISTS "webhook_subscriptions" (
+    "id" bigserial,
+    "name" text,
+    "url" text,
+    "secret" text,
+    "event_types" text[],
+    "device_id" text,
+    "disabled" boolean,
+    "updated_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+
+CREATE TABLE IF NOT EXISTS "webhook_deliveries" (
+    "id" bigserial,
+    "subscription_id" bigint,
+    "event_type" text,
+    "payload" text,
+    "status" text,
+    "attempts" bigint,
+    "next_attempt_at" timestamptz,
+    "response_status" bigint,
+    "last_error" text,
+    "replay_of" bigint,
+    "delivered_at" timestamptz,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_webhook_due" ON "webhook_deliveries" ("status","next_attempt_at");
+CREATE INDEX IF NOT EXISTS "idx_webhook_deliveries_subscription_id" ON "webhook_deliveries" ("subscription_id");
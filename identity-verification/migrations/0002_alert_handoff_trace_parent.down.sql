@@ -0,0 +1 @@
+ALTER TABLE "alert_handoffs" DROP COLUMN IF EXISTS "trace_parent";
@@ -0,0 +1,2 @@
+-- Ngữ cảnh trace (W3C traceparent) của request tạo cảnh báo, để lần chuyển sang Alert Service nối tiếp cùng trace.
+ALTER TABLE "alert_handoffs" ADD COLUMN IF NOT EXISTS "trace_parent" text;
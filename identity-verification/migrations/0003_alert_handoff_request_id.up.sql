@@ -0,0 +1,2 @@
+-- Request ID của request tạo cảnh báo, gửi kèm khi chuyển sang Alert Service để nối log hai dịch vụ.
+ALTER TABLE "alert_handoffs" ADD COLUMN IF NOT EXISTS "request_id" text;
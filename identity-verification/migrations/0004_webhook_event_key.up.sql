@@ -0,0 +1,4 @@
+-- Mã sự kiện của lần gửi webhook. Mỗi sự kiện chỉ có một lần gửi gốc cho mỗi đăng ký (bản replay không tính),
+-- nên xếp hàng lại cùng một sự kiện không tạo lần gửi trùng.
+ALTER TABLE "webhook_deliveries" ADD COLUMN IF NOT EXISTS "event_key" text;
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_webhook_deliveries_event" ON "webhook_deliveries" ("subscription_id","event_key") WHERE "replay_of" IS NULL;
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+)
+
+// Giới hạn kích thước ảnh và body của request, cấu hình qua MAX_IMAGE_BYTES và MAX_REQUEST_BODY_BYTES.
+// Body mặc định lớn hơn ảnh vì ảnh trong JSON được mã hóa base64 (tăng khoảng 1/3).
+var (
+	maxImageBytes       = int64(envInt("MAX_IMAGE_BYTES", 5<<20))
+	maxRequestBodyBytes = int64(envInt("MAX_REQUEST_BODY_BYTES", 8<<20))
+)
+
+// errImageTooLarge được trả về khi ảnh vượt quá maxImageBytes
+var errImageTooLarge = errors.New("image exceeds maximum size")
+
+// rateLimitIdleTTL là thời gian một bucket không được dùng trước khi bị xóa khỏi bộ nhớ
+const rateLimitIdleTTL = 10 * time.Minute
+
+// Giới hạn tần suất cho các endpoint công khai. Xác thực khuôn mặt được gọi liên tục từ kiosk nên
+// cho phép nhiều hơn; đăng ký khuôn mặt ít khi dùng nên giới hạn chặt để không dồn tải lên Face Recognition.
+var (
+	verifyLimiter = newRateLimiter("VERIFY", 5, 10)
+	enrollLimiter = newRateLimiter("ENROLL", 0.2, 5)
+)
+
+// rateLimiter giới hạn tần suất theo token bucket riêng cho từng thiết bị hoặc địa chỉ IP
+type rateLimiter struct {
+	limit rate.Limit
+	burst int
+
+	mu        sync.Mutex
+	buckets   map[string]*rateBucket
+	lastSweep time.Time
+}
+
+type rateBucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// newRateLimiter đọc <prefix>_RATE_LIMIT (request/giây, 0 để tắt) và <prefix>_RATE_BURST
+func newRateLimiter(prefix string, defRate float64, defBurst int) *rateLimiter {
+	perSecond := defRate
+	if v, err := strconv.ParseFloat(os.Getenv(prefix+"_RATE_LIMIT"), 64); err == nil && v >= 0 {
+		perSecond = v
+	}
+	return &rateLimiter{
+		limit:   rate.Limit(perSecond),
+		burst:   envInt(prefix+"_RATE_BURST", defBurst),
+		buckets: make(map[string]*rateBucket),
+	}
+}
+
+// reserve lấy một token của key, trả về thời gian phải chờ nếu bucket đã hết (khi đó token không bị trừ)
+func (l *rateLimiter) reserve(key string, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > rateLimitIdleTTL {
+		for k, b := range l.buckets {
+			if now.Sub(b.lastSeen) > rateLimitIdleTTL {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &rateBucket{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.buckets[key] = b
+	}
+	b.lastSeen = now
+
+	r := b.limiter.ReserveN(now, 1)
+	if !r.OK() {
+		return rateLimitIdleTTL
+	}
+	if delay := r.DelayFrom(now); delay > 0 {
+		r.CancelAt(now)
+		return delay
+	}
+	return 0
+}
+
+// middleware trả 429 kèm Retry-After khi thiết bị hoặc IP gửi quá nhanh
+func (l *rateLimiter) middleware(c *gin.Context) {
+	if l.limit <= 0 {
+		c.Next()
+		return
+	}
+
+	now := time.Now()
+	delay := l.reserve(rateLimitKey(c, now), now)
+	if delay > 0 {
+		retryAfter := int(math.Ceil(delay.Seconds()))
+		requestsRejected.WithLabelValues(c.FullPath(), "rate_limited").Inc()
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests", "retry_after": retryAfter})
+		return
+	}
+	c.Next()
+}
+
+// rateLimitKey xác định bucket của request mà không truy vấn database, để request bị chặn không dồn tải
+// xuống Postgres. Thiết bị đã đăng ký (header X-Device-ID hoặc query device_id) có bucket riêng để nhiều
+// kiosk sau cùng một NAT không chia nhau giới hạn; bucket vẫn gắn với IP để client giả mạo device_id không
+// làm cạn giới hạn của thiết bị thật. Không đọc trường form device_id vì khi đó phải đọc cả body ảnh
+// trước khi kiểm tra giới hạn; client upload ảnh gửi thêm header X-Device-ID.
+func rateLimitKey(c *gin.Context, now time.Time) string {
+	id := c.GetHeader(deviceIDHeader)
+	if id == "" {
+		id = c.Query("device_id")
+	}
+	if knownDevices.contains(id, now) {
+		return "device:" + id + "@" + c.ClientIP()
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// limitBody từ chối request có body lớn hơn max với 413 và chặn đọc quá max với body không khai báo độ dài
+func limitBody(max int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.ContentLength > max {
+			respondTooLarge(c, max)
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, max)
+		c.Next()
+	}
+}
+
+// respondTooLarge trả 413 kèm giới hạn kích thước
+func respondTooLarge(c *gin.Context, max int64) {
+	requestsRejected.WithLabelValues(c.FullPath(), "too_large").Inc()
+	c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Request too large", "max_bytes": max})
+}
+
+// respondImageError trả 413 nếu ảnh hoặc body quá lớn, ngược lại trả 400 với message
+func respondImageError(c *gin.Context, err error, message string) {
+	var maxErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxErr):
+		respondTooLarge(c, maxErr.Limit)
+	case errors.Is(err, errImageTooLarge):
+		respondTooLarge(c, maxImageBytes)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": message})
+	}
+}
+
+// readImage đọc ảnh tải lên, trả về errImageTooLarge nếu vượt maxImageBytes
+func readImage(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxImageBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxImageBytes {
+		return nil, errImageTooLarge
+	}
+	return data, nil
+}
+
+// trustedProxies đọc danh sách IP/CIDR của reverse proxy từ TRUSTED_PROXIES (phân tách bằng dấu phẩy)
+func trustedProxies() []string {
+	var proxies []string
+	for _, p := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			proxies = append(proxies, p)
+		}
+	}
+	return proxies
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+)
+
+func TestRateLimiterReserve(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	l := &rateLimiter{limit: rate.Limit(2), burst: 3, buckets: make(map[string]*rateBucket)}
+
+	for i := 0; i < 3; i++ {
+		if delay := l.reserve("ip:10.0.0.1", now); delay != 0 {
+			t.Fatalf("request %d within burst: delay = %v, want 0", i+1, delay)
+		}
+	}
+	if delay := l.reserve("ip:10.0.0.1", now); delay != 500*time.Millisecond {
+		t.Fatalf("request over burst: delay = %v, want 500ms", delay)
+	}
+	// Request bị từ chối không trừ token nên lần thử lại sau đúng khoảng chờ được chấp nhận
+	if delay := l.reserve("ip:10.0.0.1", now.Add(250*time.Millisecond)); delay != 250*time.Millisecond {
+		t.Fatalf("retry too early: delay = %v, want 250ms", delay)
+	}
+	if delay := l.reserve("ip:10.0.0.1", now.Add(500*time.Millisecond)); delay != 0 {
+		t.Fatalf("retry after Retry-After: delay = %v, want 0", delay)
+	}
+
+	// Mỗi key có bucket riêng
+	if delay := l.reserve("device:kiosk-1@10.0.0.1", now); delay != 0 {
+		t.Fatalf("other key: delay = %v, want 0", delay)
+	}
+}
+
+func TestRateLimiterReserveZeroBurst(t *testing.T) {
+	l := &rateLimiter{limit: rate.Limit(1), burst: 0, buckets: make(map[string]*rateBucket)}
+	if delay := l.reserve("ip:10.0.0.1", time.Now()); delay != rateLimitIdleTTL {
+		t.Fatalf("delay = %v, want %v", delay, rateLimitIdleTTL)
+	}
+}
+
+func TestRateLimiterSweepsIdleBuckets(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	l := &rateLimiter{limit: rate.Limit(1), burst: 1, buckets: make(map[string]*rateBucket)}
+
+	l.reserve("ip:10.0.0.1", now)
+	l.reserve("ip:10.0.0.2", now.Add(rateLimitIdleTTL))
+	if len(l.buckets) != 2 {
+		t.Fatalf("buckets = %d, want 2", len(l.buckets))
+	}
+
+	// Bucket của 10.0.0.1 không được dùng quá rateLimitIdleTTL nên bị xóa, bucket còn lại được giữ
+	l.reserve("ip:10.0.0.3", now.Add(rateLimitIdleTTL+time.Second))
+	if _, ok := l.buckets["ip:10.0.0.1"]; ok {
+		t.Error("idle bucket was not swept")
+	}
+	if _, ok := l.buckets["ip:10.0.0.2"]; !ok {
+		t.Error("recently used bucket was swept")
+	}
+}
+
+// stubKnownDevices thay danh sách thiết bị đã đăng ký trong thời gian chạy test, trả về số lần nạp
+func stubKnownDevices(t *testing.T, ids ...string) *int {
+	t.Helper()
+	loads := 0
+	previous := knownDevices
+	knownDevices = &deviceSet{load: func() ([]string, error) {
+		loads++
+		return ids, nil
+	}}
+	t.Cleanup(func() { knownDevices = previous })
+	return &loads
+}
+
+// multipartUpload tạo request upload ảnh như /verify_face, device_id nằm trong form
+func multipartUpload(t *testing.T, target, formDeviceID string) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("image", "capture.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte("jpeg"))
+	if formDeviceID != "" {
+		form.WriteField("device_id", formDeviceID)
+	}
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, target, &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	return req
+}
+
+func TestRateLimitKey(t *testing.T) {
+	loads := stubKnownDevices(t, "kiosk-1")
+
+	tests := []struct {
+		name   string
+		header string
+		target string
+		want   string
+	}{
+		{"upload with device header", "kiosk-1", "/verify_face", "device:kiosk-1@192.0.2.1"},
+		{"unknown device falls back to IP", "spoofed", "/verify_face", "ip:192.0.2.1"},
+		{"websocket query", "", "/ws/verify?device_id=kiosk-1", "device:kiosk-1@192.0.2.1"},
+		{"no device", "", "/verify_face", "ip:192.0.2.1"},
+	}
+	now := time.Now()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = multipartUpload(t, tt.target, "kiosk-1")
+			if tt.header != "" {
+				c.Request.Header.Set(deviceIDHeader, tt.header)
+			}
+			if got := rateLimitKey(c, now); got != tt.want {
+				t.Errorf("rateLimitKey() = %q, want %q", got, tt.want)
+			}
+			// Body ảnh chưa được đọc khi kiểm tra giới hạn
+			if c.Request.MultipartForm != nil {
+				t.Error("rateLimitKey parsed the multipart body")
+			}
+		})
+	}
+	if *loads != 1 {
+		t.Errorf("device IDs loaded %d times, want 1", *loads)
+	}
+}
+
+func TestRateLimiterMiddlewarePerDevice(t *testing.T) {
+	stubKnownDevices(t, "kiosk-1", "kiosk-2")
+	l := &rateLimiter{limit: rate.Limit(0.001), burst: 1, buckets: make(map[string]*rateBucket)}
+
+	router := gin.New()
+	router.POST("/verify_face", l.middleware, func(c *gin.Context) {
+		c.String(http.StatusOK, requestDeviceID(c))
+	})
+
+	// Hai kiosk sau cùng một NAT có bucket riêng, request không khai báo thiết bị dùng bucket của IP
+	tests := []struct {
+		device string
+		want   int
+	}{
+		{"kiosk-1", http.StatusOK},
+		{"kiosk-1", http.StatusTooManyRequests},
+		{"kiosk-2", http.StatusOK},
+		{"", http.StatusOK},
+		{"", http.StatusTooManyRequests},
+	}
+	for i, tt := range tests {
+		req := multipartUpload(t, "/verify_face", tt.device)
+		if tt.device != "" {
+			req.Header.Set(deviceIDHeader, tt.device)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Fatalf("request %d (%q): status = %d, want %d", i+1, tt.device, w.Code, tt.want)
+		}
+		if w.Code == http.StatusOK && w.Body.String() != tt.device {
+			t.Fatalf("request %d: handler saw device %q, want %q", i+1, w.Body.String(), tt.device)
+		}
+	}
+}
+
+func TestDeviceSetReload(t *testing.T) {
+	ids := []string{"kiosk-1"}
+	var err error
+	loads := 0
+	s := &deviceSet{load: func() ([]string, error) {
+		loads++
+		return ids, err
+	}}
+	now := time.Unix(1_700_000_000, 0)
+
+	if !s.contains("kiosk-1", now) || s.contains("kiosk-2", now) {
+		t.Fatal("initial load")
+	}
+	ids = []string{"kiosk-1", "kiosk-2"}
+	if s.contains("kiosk-2", now.Add(deviceSetTTL)) {
+		t.Fatal("reloaded before deviceSetTTL")
+	}
+	if !s.contains("kiosk-2", now.Add(deviceSetTTL+time.Second)) {
+		t.Fatal("not reloaded after deviceSetTTL")
+	}
+
+	// Lỗi khi nạp lại giữ danh sách cũ
+	err = errors.New("connection refused")
+	if !s.contains("kiosk-2", now.Add(2*deviceSetTTL+2*time.Second)) {
+		t.Fatal("device list dropped after load error")
+	}
+
+	// Thêm hoặc xóa thiết bị nạp lại ngay
+	err = nil
+	ids = nil
+	s.invalidate()
+	if s.contains("kiosk-1", now.Add(2*deviceSetTTL+3*time.Second)) {
+		t.Fatal("not reloaded after invalidate")
+	}
+	if loads != 4 {
+		t.Errorf("loads = %d, want 4", loads)
+	}
+}
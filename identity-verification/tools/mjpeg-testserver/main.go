@@ -0,0 +1,68 @@
+// mjpeg-testserver phát một hoặc nhiều ảnh JPEG dưới dạng luồng MJPEG,
+// dùng để thử nghiệm việc thu nhận camera của identity-verification mà không cần camera thật.
+//
+//	go run ./tools/mjpeg-testserver -image ../test.jpg -fps 5
+//
+// Sau đó cấu hình thiết bị với stream_url là http://localhost:8090/stream
+// (hoặc http://localhost:8090/snapshot.jpg để thử chế độ ảnh tĩnh).
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+func main() {
+	addr := flag.String("addr", ":8090", "listen address")
+	images := flag.String("image", "test.jpg", "comma-separated list of JPEG files to loop")
+	fps := flag.Float64("fps", 5, "frames per second")
+	flag.Parse()
+
+	var frames [][]byte
+	for _, path := range strings.Split(*images, ",") {
+		data, err := os.ReadFile(strings.TrimSpace(path))
+		if err != nil {
+			log.Fatalf("Failed to read image: %v", err)
+		}
+		frames = append(frames, data)
+	}
+	interval := time.Duration(float64(time.Second) / *fps)
+
+	http.HandleFunc("/stream", func(w http.ResponseWriter, r *http.Request) {
+		const boundary = "frame"
+		w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary="+boundary)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for i := 0; ; i++ {
+			frame := frames[i%len(frames)]
+			if _, err := fmt.Fprintf(w, "--%s\r\nContent-Type: image/jpeg\r\nContent-Length: %d\r\n\r\n", boundary, len(frame)); err != nil {
+				return
+			}
+			if _, err := w.Write(append(frame, '\r', '\n')); err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+
+			select {
+			case <-r.Context().Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	})
+
+	http.HandleFunc("/snapshot.jpg", func(w http.ResponseWriter, r *http.Request) {
+		frame := frames[time.Now().Second()%len(frames)]
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write(frame)
+	})
+
+	log.Printf("Serving MJPEG test stream on %s (%d images at %.1f fps)", *addr, len(frames), *fps)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+
+	"isafe/shared/domain"
+)
+
+// identification là kết quả so khớp một embedding với người dùng và khách đã đăng ký
+type identification struct {
+	User       *User
+	Visitor    *Visitor
+	Similarity float64
+}
+
+// key định danh đối tượng được nhận diện, dùng để theo dõi qua nhiều khung hình
+func (id identification) key() string {
+	switch {
+	case id.User != nil:
+		return fmt.Sprintf("user:%d", id.User.ID)
+	case id.Visitor != nil:
+		return fmt.Sprintf("visitor:%d", id.Visitor.ID)
+	default:
+		return "unknown"
+	}
+}
+
+// verifyError là lỗi trong luồng xác thực kèm thông báo trả về cho client
+type verifyError struct {
+	Message string
+	Err     error
+}
+
+func (e *verifyError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Message, e.Err)
+}
+
+func (e *verifyError) Unwrap() error {
+	return e.Err
+}
+
+// respondVerifyError ghi log lỗi và trả thông báo tương ứng cho client
+func respondVerifyError(c *gin.Context, err error) {
+	slog.ErrorContext(c.Request.Context(), "Error verifying face", "error", err)
+
+	var ve *verifyError
+	if errors.As(err, &ve) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ve.Message})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+}
+
+// identify so khớp embedding với tất cả người dùng, sau đó với khách còn hiệu lực.
+// Hàm này không ghi nhận gì vào cơ sở dữ liệu.
+func identify(ctx context.Context, embedding []float64) (identification, error) {
+	ctx, span := tracer.Start(ctx, "identify")
+	defer span.End()
+
+	// So sánh với tất cả các embeddings trong cơ sở dữ liệu
+	var users []User
+	if err := db.WithContext(ctx).Find(&users).Error; err != nil {
+		return identification{}, &verifyError{Message: "Database error", Err: err}
+	}
+
+	highestSimilarity := -1.0
+	var matchedUser User
+
+	for _, user := range users {
+		similarity := cosineSimilarity(embedding, user.FaceEmbedding)
+		if similarity > highestSimilarity {
+			highestSimilarity = similarity
+			matchedUser = user
+		}
+	}
+
+	span.SetAttributes(attribute.Int("gallery.users", len(users)), attribute.Float64("similarity.user", highestSimilarity))
+	if highestSimilarity >= matchThreshold {
+		return identification{User: &matchedUser, Similarity: highestSimilarity}, nil
+	}
+
+	// Kiểm tra khách đã đăng ký trước còn hiệu lực
+	visitor, visitorSimilarity, err := matchVisitor(ctx, embedding)
+	if err != nil {
+		return identification{}, &verifyError{Message: "Database error", Err: err}
+	}
+	if visitor != nil {
+		return identification{Visitor: visitor, Similarity: visitorSimilarity}, nil
+	}
+
+	return identification{Similarity: highestSimilarity}, nil
+}
+
+// applyVerification ghi nhận kết quả nhận diện: cập nhật LastSeen, lưu snapshot,
+// chấm công, check-in khách, gửi cảnh báo và phát sự kiện cho dashboard.
+func applyVerification(ctx context.Context, id identification, device *Device, imageBytes []byte) (VerificationResponse, error) {
+	ctx, span := tracer.Start(ctx, "verify.apply")
+	span.SetAttributes(attribute.String("device.id", deviceID(device)), attribute.String("match", id.key()))
+	defer span.End()
+
+	switch {
+	case id.User != nil:
+		matchedUser := *id.User
+		now := time.Now()
+
+		// Cập nhật LastSeen và xếp hàng webhook trong cùng giao dịch
+		var event webhookEvent
+		err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&matchedUser).Update("LastSeen", now).Error; err != nil {
+				return err
+			}
+			var err error
+			event, err = recordEvent(tx, EventVerificationMatched, deviceID(device), gin.H{
+				"user_id":    matchedUser.ID,
+				"name":       matchedUser.Name,
+				"role":       matchedUser.Role,
+				"similarity": id.Similarity,
+			})
+			return err
+		})
+		if err != nil {
+			return VerificationResponse{}, &verifyError{Message: "Failed to update LastSeen", Err: err}
+		}
+
+		// Lưu lượt nhận diện để chấm công
+		if err := recordRecognitionEvent(matchedUser.ID, device, id.Similarity, now); err != nil {
+			slog.ErrorContext(ctx, "Error recording recognition event", "error", err)
+		}
+
+		// Lưu snapshot
+		if matchedUser.ID != 0 {
+			snapshotDir := fmt.Sprintf("./uploads/users/%d", matchedUser.ID)
+			os.MkdirAll(snapshotDir, os.ModePerm)
+
+			timestamp := now.Format("20060102_150405")
+			filename := fmt.Sprintf("%s/%s_%s", snapshotDir, "snapshot", timestamp)
+			if err := os.WriteFile(filename+".jpg", imageBytes, os.ModePerm); err != nil {
+				return VerificationResponse{}, &verifyError{Message: "Failed to save snapshot", Err: err}
+			}
+		}
+
+		recordVerification(device, resultMatched, id.Similarity)
+		publishEvent(event)
+
+		return VerificationResponse{
+			Match:      true,
+			User:       matchedUser,
+			Similarity: id.Similarity,
+		}, nil
+
+	case id.Visitor != nil:
+		allowed, recorded, err := recordVisitorCheckIn(ctx, id.Visitor, device, id.Similarity, imageBytes)
+		if err != nil {
+			return VerificationResponse{}, &verifyError{Message: "Failed to record visitor check-in", Err: err}
+		}
+
+		resp := VerificationResponse{
+			Match:      allowed,
+			Visitor:    id.Visitor,
+			Similarity: id.Similarity,
+		}
+		result := resultVisitorAllowed
+		if !allowed {
+			resp.AlertMessage = visitorZoneMessage
+			result = resultVisitorRejected
+		}
+		recordVerification(device, result, id.Similarity)
+		for _, e := range recorded {
+			publishEvent(e)
+		}
+		return resp, nil
+
+	default:
+		// Xếp cảnh báo cho Alert Service và webhook trong cùng giao dịch; không ghi được thì trả lỗi
+		// thay vì báo "Unrecognized face detected" cho một cảnh báo đã mất
+		alert := Alert{
+			Similarity:   id.Similarity,
+			AlertMessage: "Unrecognized face detected",
+			Status:       domain.AlertStatusUnrecognized,
+			DeviceID:     deviceID(device),
+			Zone:         deviceZone(device),
+		}
+		var event webhookEvent
+		err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := sendAlert(ctx, tx, alert, imageBytes); err != nil {
+				return err
+			}
+			var err error
+			event, err = recordEvent(tx, EventVerificationRejected, deviceID(device), gin.H{
+				"similarity":    id.Similarity,
+				"alert_message": alert.AlertMessage,
+			})
+			return err
+		})
+		if err != nil {
+			return VerificationResponse{}, &verifyError{Message: "Failed to record alert", Err: err}
+		}
+		alertQueued(alert.Status)
+
+		recordVerification(device, resultUnrecognized, id.Similarity)
+		publishEvent(event)
+
+		return VerificationResponse{
+			Match:        false,
+			Similarity:   id.Similarity,
+			AlertMessage: "Unrecognized face detected",
+		}, nil
+	}
+}
+
+const (
+	// trackRequiredVotes là số khung hình liên tiếp cùng kết quả trước khi ra quyết định
+	trackRequiredVotes = 3
+	// trackMaxMissedFrames là số khung hình liên tiếp không có khuôn mặt trước khi bỏ theo dõi
+	trackMaxMissedFrames = 5
+)
+
+// frameMessage là kết quả xử lý một khung hình trong luồng xác thực liên tục
+type frameMessage struct {
+	Type     string                `json:"type"` // progress, decision, tracking, no_face, track_lost, busy, error
+	Votes    int                   `json:"votes,omitempty"`
+	Required int                   `json:"required,omitempty"`
+	Result   *VerificationResponse `json:"result,omitempty"`
+	Error    string                `json:"error,omitempty"`
+}
+
+// faceTrack theo dõi một khuôn mặt qua nhiều khung hình liên tiếp
+type faceTrack struct {
+	embedding []float64
+	candidate string
+	votes     int
+	decided   bool
+	missed    int
+}
+
+// processFrame nhận diện một khung hình và cập nhật trạng thái theo dõi khuôn mặt.
+// Mỗi khung hình là một trace riêng vì luồng camera/WebSocket kéo dài hàng giờ,
+// liên kết tới span đang có trong ctx (request mở WebSocket) nếu có.
+func processFrame(ctx context.Context, track *faceTrack, device *Device, image []byte) frameMessage {
+	opts := []trace.SpanStartOption{trace.WithNewRoot()}
+	if parent := trace.SpanContextFromContext(ctx); parent.IsValid() {
+		opts = append(opts, trace.WithLinks(trace.Link{SpanContext: parent}))
+	}
+	ctx, span := tracer.Start(ctx, "verify.frame", opts...)
+	span.SetAttributes(attribute.String("device.id", deviceID(device)))
+	defer span.End()
+
+	embedding, err := fetchEmbedding(ctx, priorityLive, image, "frame.jpg")
+	if errors.Is(err, errNoEmbedding) {
+		track.missed++
+		if track.embedding != nil && track.missed >= trackMaxMissedFrames {
+			*track = faceTrack{}
+			return frameMessage{Type: "track_lost"}
+		}
+		return frameMessage{Type: "no_face"}
+	}
+	if errors.Is(err, errFaceRecBusy) {
+		// Bỏ khung hình khi quá tải, khung hình sau sẽ được thử lại
+		slog.DebugContext(ctx, "Frame dropped, Face Recognition overloaded")
+		return frameMessage{Type: "busy"}
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Error extracting frame embedding", "error", err)
+		return frameMessage{Type: "error", Error: "Failed to communicate with Face Recognition service"}
+	}
+
+	// Khuôn mặt khác với khuôn mặt đang theo dõi thì bắt đầu theo dõi lại
+	if track.embedding != nil && cosineSimilarity(embedding, track.embedding) < matchThreshold {
+		*track = faceTrack{}
+	}
+	track.embedding = embedding
+	track.missed = 0
+
+	if track.decided {
+		return frameMessage{Type: "tracking"}
+	}
+
+	id, err := identify(ctx, embedding)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error identifying frame", "error", err)
+		return frameMessage{Type: "error", Error: "Database error"}
+	}
+
+	if id.key() == track.candidate {
+		track.votes++
+	} else {
+		track.candidate = id.key()
+		track.votes = 1
+	}
+	if track.votes < trackRequiredVotes {
+		return frameMessage{Type: "progress", Votes: track.votes, Required: trackRequiredVotes}
+	}
+
+	resp, err := applyVerification(ctx, id, device, image)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error applying verification", "error", err)
+		var ve *verifyError
+		if errors.As(err, &ve) {
+			return frameMessage{Type: "error", Error: ve.Message}
+		}
+		return frameMessage{Type: "error", Error: "Internal server error"}
+	}
+	track.decided = true
+	return frameMessage{Type: "decision", Result: &resp}
+}
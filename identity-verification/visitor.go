@@ -0,0 +1,507 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+
+	"isafe/shared/domain"
+)
+
+// Visitor là khách/nhà thầu được đăng ký trước, chỉ được nhận diện trong khung thời gian hiệu lực
+type Visitor struct {
+	ID            uint            `gorm:"primaryKey" json:"id"`
+	Name          string          `json:"name"`
+	Company       string          `json:"company"`
+	Phone         string          `json:"phone"`
+	HostUserID    uint            `gorm:"index" json:"host_user_id"`
+	ValidFrom     time.Time       `json:"valid_from"`
+	ValidUntil    time.Time       `gorm:"index" json:"valid_until"`
+	AllowedZones  pq.StringArray  `gorm:"type:text[]" json:"allowed_zones"`
+	FaceEmbedding pq.Float64Array `gorm:"type:float8[]" json:"-"`
+	EnrollToken   *string         `gorm:"uniqueIndex" json:"-"` // Xóa khi khách tự đăng ký xong, link chỉ dùng được một lần
+	EnrolledAt    *time.Time      `json:"enrolled_at"`
+	PurgedAt      *time.Time      `json:"purged_at"`
+	LastSeen      *time.Time      `json:"last_seen"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+// VisitorCheckIn là một lần khách được nhận diện tại thiết bị
+type VisitorCheckIn struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	VisitorID  uint      `gorm:"index" json:"visitor_id"`
+	DeviceID   string    `json:"device_id"`
+	Zone       string    `json:"zone"`
+	Similarity float64   `json:"similarity"`
+	Allowed    bool      `json:"allowed"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// visitorPurgeInterval là chu kỳ xóa embedding của khách đã hết hạn
+const visitorPurgeInterval = time.Minute
+
+// isActive kiểm tra khách đã đăng ký khuôn mặt và còn trong khung thời gian hiệu lực
+func (v *Visitor) isActive(now time.Time) bool {
+	return v.PurgedAt == nil && len(v.FaceEmbedding) > 0 &&
+		!now.Before(v.ValidFrom) && now.Before(v.ValidUntil)
+}
+
+// allowsZone kiểm tra khách có được phép vào khu vực hay không.
+// Danh sách rỗng nghĩa là không giới hạn khu vực.
+func (v *Visitor) allowsZone(zone string) bool {
+	if len(v.AllowedZones) == 0 {
+		return true
+	}
+	for _, z := range v.AllowedZones {
+		if z == zone {
+			return true
+		}
+	}
+	return false
+}
+
+// newEnrollToken tạo token ngẫu nhiên cho link tự đăng ký khuôn mặt
+func newEnrollToken() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// enrollURL trả về link tự đăng ký khuôn mặt gửi cho khách
+func enrollURL(token string) string {
+	base := os.Getenv("PUBLIC_BASE_URL")
+	if base == "" {
+		base = "http://localhost:8080"
+	}
+	return fmt.Sprintf("%s/visitors/enroll/%s", strings.TrimRight(base, "/"), token)
+}
+
+// matchVisitor tìm khách đang hiệu lực có embedding giống nhất
+func matchVisitor(ctx context.Context, embedding []float64) (*Visitor, float64, error) {
+	now := time.Now()
+	var visitors []Visitor
+	if err := db.WithContext(ctx).Where("purged_at IS NULL AND enrolled_at IS NOT NULL AND valid_from <= ? AND valid_until > ?", now, now).
+		Find(&visitors).Error; err != nil {
+		return nil, 0, err
+	}
+
+	highestSimilarity := -1.0
+	var matched *Visitor
+	for i := range visitors {
+		if !visitors[i].isActive(now) {
+			continue
+		}
+		similarity := cosineSimilarity(embedding, visitors[i].FaceEmbedding)
+		if similarity > highestSimilarity {
+			highestSimilarity = similarity
+			matched = &visitors[i]
+		}
+	}
+	if matched == nil || highestSimilarity < matchThreshold {
+		return nil, highestSimilarity, nil
+	}
+	return matched, highestSimilarity, nil
+}
+
+// visitorZoneMessage là thông báo trả về khi khách vào khu vực không được phép
+const visitorZoneMessage = "Visitor is not allowed in this zone"
+
+// recordVisitorCheckIn lưu lượt check-in của khách cùng các sự kiện cần đẩy lên dashboard và webhook.
+// Khách vào đúng khu vực thì người tiếp đón được báo qua sự kiện visitor.checked_in, không qua luồng cảnh báo;
+// khách vào khu vực không được phép mới tạo cảnh báo an ninh, ghi cùng giao dịch với lượt check-in.
+func recordVisitorCheckIn(ctx context.Context, visitor *Visitor, device *Device, similarity float64, imageBytes []byte) (bool, []webhookEvent, error) {
+	now := time.Now()
+	checkIn := VisitorCheckIn{
+		VisitorID:  visitor.ID,
+		Similarity: similarity,
+		Allowed:    true,
+		Timestamp:  now,
+	}
+	if device != nil {
+		checkIn.DeviceID = device.ID
+		checkIn.Zone = device.Zone
+		checkIn.Allowed = visitor.allowsZone(device.Zone)
+	}
+
+	hostName := "unknown host"
+	var host User
+	if err := db.WithContext(ctx).First(&host, visitor.HostUserID).Error; err == nil {
+		hostName = host.Name
+	}
+
+	eventType, alertMessage := EventVerificationMatched, ""
+	if !checkIn.Allowed {
+		eventType, alertMessage = EventVerificationRejected, visitorZoneMessage
+	}
+	var recorded []webhookEvent
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&checkIn).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(visitor).Update("last_seen", now).Error; err != nil {
+			return err
+		}
+		event, err := recordEvent(tx, eventType, checkIn.DeviceID, gin.H{
+			"visitor_id":    visitor.ID,
+			"name":          visitor.Name,
+			"host_user_id":  visitor.HostUserID,
+			"similarity":    similarity,
+			"alert_message": alertMessage,
+		})
+		if err != nil {
+			return err
+		}
+		recorded = append(recorded, event)
+		if !checkIn.Allowed {
+			return sendAlert(ctx, tx, Alert{
+				Similarity:   similarity,
+				AlertMessage: fmt.Sprintf("Visitor %s is not allowed in zone %q (host: %s)", visitor.Name, checkIn.Zone, hostName),
+				Status:       domain.AlertStatusVisitorZoneViolation,
+				DeviceID:     checkIn.DeviceID,
+				Zone:         checkIn.Zone,
+			}, imageBytes)
+		}
+
+		event, err = recordEvent(tx, EventVisitorCheckedIn, checkIn.DeviceID, gin.H{
+			"visitor_id":   visitor.ID,
+			"name":         visitor.Name,
+			"company":      visitor.Company,
+			"host_user_id": visitor.HostUserID,
+			"host_name":    hostName,
+			"zone":         checkIn.Zone,
+			"check_in_id":  checkIn.ID,
+		})
+		if err != nil {
+			return err
+		}
+		recorded = append(recorded, event)
+		return nil
+	})
+	if err != nil {
+		return false, nil, err
+	}
+
+	if !checkIn.Allowed {
+		alertQueued(domain.AlertStatusVisitorZoneViolation)
+	}
+	return checkIn.Allowed, recorded, nil
+}
+
+// purgeExpiredVisitors xóa embedding của các khách đã hết hạn
+func purgeExpiredVisitors() {
+	now := time.Now()
+	result := db.Model(&Visitor{}).
+		Where("valid_until <= ? AND purged_at IS NULL", now).
+		Updates(map[string]interface{}{"face_embedding": nil, "purged_at": now})
+	if result.Error != nil {
+		slog.Error("Error purging expired visitors", "error", result.Error)
+		return
+	}
+	if result.RowsAffected > 0 {
+		slog.Info("Purged face embeddings of expired visitors", "count", result.RowsAffected)
+	}
+}
+
+// runVisitorPurger chạy định kỳ việc xóa embedding của khách hết hạn
+func runVisitorPurger() {
+	ticker := time.NewTicker(visitorPurgeInterval)
+	defer ticker.Stop()
+	for {
+		purgeExpiredVisitors()
+		select {
+		case <-ticker.C:
+		case <-app.Stopping():
+			return
+		}
+	}
+}
+
+// createVisitorHandler đăng ký trước một khách và trả về link tự đăng ký khuôn mặt
+func createVisitorHandler(c *gin.Context) {
+	var req struct {
+		Name         string    `json:"name"`
+		Company      string    `json:"company"`
+		Phone        string    `json:"phone"`
+		HostUserID   uint      `json:"host_user_id"`
+		ValidFrom    time.Time `json:"valid_from"`
+		ValidUntil   time.Time `json:"valid_until"`
+		AllowedZones []string  `json:"allowed_zones"`
+		FaceSnapshot string    `json:"face_snapshot"` // Tùy chọn, có thể đăng ký sau qua link
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondImageError(c, err, "Invalid request body")
+		return
+	}
+
+	if req.Name == "" || req.HostUserID == 0 || req.ValidUntil.IsZero() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing fields"})
+		return
+	}
+	if req.ValidFrom.IsZero() {
+		req.ValidFrom = time.Now()
+	}
+	if !req.ValidUntil.After(req.ValidFrom) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "valid_until must be after valid_from"})
+		return
+	}
+
+	var host User
+	if err := db.First(&host, req.HostUserID).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Host user not found"})
+		return
+	}
+
+	token, err := newEnrollToken()
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error generating enroll token", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create visitor"})
+		return
+	}
+
+	visitor := Visitor{
+		Name:         req.Name,
+		Company:      req.Company,
+		Phone:        req.Phone,
+		HostUserID:   host.ID,
+		ValidFrom:    req.ValidFrom,
+		ValidUntil:   req.ValidUntil,
+		AllowedZones: pq.StringArray(req.AllowedZones),
+		EnrollToken:  &token,
+	}
+
+	if req.FaceSnapshot != "" {
+		decodedImage, err := decodeBase64Image(req.FaceSnapshot)
+		if err != nil {
+			respondImageError(c, err, "Invalid face_snapshot")
+			return
+		}
+		if !enrollVisitorFace(c, &visitor, decodedImage) {
+			return
+		}
+		// Đã có ảnh khuôn mặt thì không cần link tự đăng ký
+		visitor.EnrollToken = nil
+	}
+
+	if err := db.Create(&visitor).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error creating visitor", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create visitor"})
+		return
+	}
+
+	resp := gin.H{"visitor": visitor}
+	if visitor.EnrollToken != nil {
+		resp["enroll_url"] = enrollURL(*visitor.EnrollToken)
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// enrollVisitorFace trích xuất embedding từ ảnh và gắn vào khách, trả về false nếu đã phản hồi lỗi
+func enrollVisitorFace(c *gin.Context, visitor *Visitor, imageBytes []byte) bool {
+	embedding, err := fetchEmbedding(c.Request.Context(), priorityEnroll, imageBytes, "visitor.jpg")
+	if err != nil {
+		respondEmbeddingError(c, err)
+		return false
+	}
+	now := time.Now()
+	visitor.FaceEmbedding = pq.Float64Array(embedding)
+	visitor.EnrolledAt = &now
+	return true
+}
+
+// findEnrollableVisitor tìm khách theo token tự đăng ký còn hiệu lực
+func findEnrollableVisitor(c *gin.Context) (*Visitor, bool) {
+	var visitor Visitor
+	if err := db.Where("enroll_token = ?", c.Param("token")).First(&visitor).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Enrollment link not found"})
+		return nil, false
+	}
+	if visitor.PurgedAt != nil || !time.Now().Before(visitor.ValidUntil) {
+		c.JSON(http.StatusGone, gin.H{"error": "Enrollment link has expired"})
+		return nil, false
+	}
+	return &visitor, true
+}
+
+// getVisitorEnrollmentHandler trả về thông tin hiển thị trên trang tự đăng ký
+func getVisitorEnrollmentHandler(c *gin.Context) {
+	visitor, ok := findEnrollableVisitor(c)
+	if !ok {
+		return
+	}
+
+	var host User
+	db.First(&host, visitor.HostUserID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"name":        visitor.Name,
+		"company":     visitor.Company,
+		"host_name":   host.Name,
+		"valid_from":  visitor.ValidFrom,
+		"valid_until": visitor.ValidUntil,
+		"enrolled":    visitor.EnrolledAt != nil,
+	})
+}
+
+// enrollVisitorHandler nhận ảnh khuôn mặt khách tải lên qua link tự đăng ký
+func enrollVisitorHandler(c *gin.Context) {
+	visitor, ok := findEnrollableVisitor(c)
+	if !ok {
+		return
+	}
+
+	// Chấp nhận cả multipart 'image' lẫn JSON face_snapshot (base64)
+	var imageBytes []byte
+	if file, _, err := c.Request.FormFile("image"); err == nil {
+		defer file.Close()
+		imageBytes, err = readImage(file)
+		if errors.Is(err, errImageTooLarge) {
+			respondTooLarge(c, maxImageBytes)
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read image"})
+			return
+		}
+	} else {
+		var req struct {
+			FaceSnapshot string `json:"face_snapshot"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil || req.FaceSnapshot == "" {
+			respondImageError(c, err, "Image is required")
+			return
+		}
+		imageBytes, err = decodeBase64Image(req.FaceSnapshot)
+		if err != nil {
+			respondImageError(c, err, "Invalid face_snapshot")
+			return
+		}
+	}
+
+	if !enrollVisitorFace(c, visitor, imageBytes) {
+		return
+	}
+
+	// Xóa token cùng lúc lưu khuôn mặt để link không dùng lại được; điều kiện trên token chặn hai lần gửi đồng thời
+	result := db.WithContext(c.Request.Context()).Model(visitor).
+		Where("enroll_token = ?", c.Param("token")).
+		Updates(map[string]interface{}{
+			"face_embedding": visitor.FaceEmbedding,
+			"enrolled_at":    visitor.EnrolledAt,
+			"enroll_token":   nil,
+		})
+	if result.Error != nil {
+		slog.ErrorContext(c.Request.Context(), "Error saving visitor enrollment", "error", result.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save enrollment"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusGone, gin.H{"error": "Enrollment link has already been used"})
+		return
+	}
+	visitor.EnrollToken = nil
+
+	c.JSON(http.StatusOK, gin.H{"message": "Enrollment completed", "visitor": visitor})
+}
+
+// getVisitorsHandler lấy danh sách khách, có thể lọc theo người tiếp đón
+func getVisitorsHandler(c *gin.Context) {
+	query := db.Order("valid_from DESC")
+	if hostID := c.Query("host_user_id"); hostID != "" {
+		query = query.Where("host_user_id = ?", hostID)
+	}
+	if c.Query("active") == "true" {
+		now := time.Now()
+		query = query.Where("purged_at IS NULL AND valid_from <= ? AND valid_until > ?", now, now)
+	}
+
+	var visitors []Visitor
+	if err := query.Find(&visitors).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error fetching visitors from database", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, visitors)
+}
+
+// getVisitorByIdHandler lấy thông tin một khách
+func getVisitorByIdHandler(c *gin.Context) {
+	var visitor Visitor
+	if err := db.First(&visitor, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Visitor not found"})
+		return
+	}
+	c.JSON(http.StatusOK, visitor)
+}
+
+// deleteVisitorHandler hủy đăng ký khách cùng lịch sử check-in
+func deleteVisitorHandler(c *gin.Context) {
+	visitorID := c.Param("id")
+
+	if err := db.Where("visitor_id = ?", visitorID).Delete(&VisitorCheckIn{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete visitor check-ins"})
+		return
+	}
+	if err := db.Delete(&Visitor{}, visitorID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete visitor"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Visitor deleted successfully"})
+}
+
+// getVisitorCheckInsHandler lấy lịch sử check-in của một khách
+func getVisitorCheckInsHandler(c *gin.Context) {
+	var checkIns []VisitorCheckIn
+	if err := db.Where("visitor_id = ?", c.Param("id")).Order("timestamp DESC").Find(&checkIns).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error fetching visitor check-ins", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, checkIns)
+}
+
+// getHostVisitsHandler báo cáo cho người tiếp đón các khách của họ cùng lượt check-in
+func getHostVisitsHandler(c *gin.Context) {
+	var host User
+	if err := db.First(&host, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	var visitors []Visitor
+	if err := db.Where("host_user_id = ?", host.ID).Order("valid_from DESC").Find(&visitors).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error fetching host visitors", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	type visit struct {
+		Visitor  Visitor          `json:"visitor"`
+		CheckIns []VisitorCheckIn `json:"check_ins"`
+	}
+	visits := make([]visit, 0, len(visitors))
+	for _, v := range visitors {
+		var checkIns []VisitorCheckIn
+		if err := db.Where("visitor_id = ?", v.ID).Order("timestamp").Find(&checkIns).Error; err != nil {
+			slog.ErrorContext(c.Request.Context(), "Error fetching visitor check-ins", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		visits = append(visits, visit{Visitor: v, CheckIns: checkIns})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"host": host.Name, "visits": visits})
+}
@@ -0,0 +1,544 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"isafe/shared/domain"
+	"isafe/shared/signing"
+)
+
+// Các trạng thái của một lần gửi webhook
+const (
+	WebhookPending   = "pending"
+	WebhookDelivered = "delivered"
+	WebhookFailed    = "failed" // Đã thử hết số lần, chỉ gửi lại bằng replay
+)
+
+// Header gắn vào mỗi lần gửi webhook. Chữ ký là HMAC-SHA256 của "<timestamp>.<body>"
+// với secret của đăng ký, dạng "t=<unix>,v1=<hex>" (xem isafe/shared/signing); bên nhận nên từ chối timestamp quá cũ.
+const (
+	webhookSignatureHeader = "X-Isafe-Signature"
+	webhookEventHeader     = "X-Isafe-Event"
+	webhookDeliveryHeader  = "X-Isafe-Delivery"
+)
+
+const (
+	webhookPollInterval = 2 * time.Second
+	// webhookLease là thời gian giữ một lần gửi đang xử lý trước khi cho phép gửi lại
+	webhookLease      = time.Minute
+	webhookMinBackoff = 5 * time.Second
+	webhookMaxBackoff = time.Hour
+)
+
+// webhookEventTypes là các loại sự kiện có thể đăng ký
+var webhookEventTypes = []string{EventVerificationMatched, EventVerificationRejected, EventAlertCreated, EventAlertUpdated, EventVisitorCheckedIn}
+
+// webhookMaxAttempts là số lần gửi tối đa trước khi đánh dấu thất bại
+var webhookMaxAttempts = envInt("WEBHOOK_MAX_ATTEMPTS", 8)
+
+// webhookClient gửi webhook với timeout để hệ thống bên ngoài treo không chặn worker
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// alertEventBatchSize là số sự kiện cảnh báo xếp hàng webhook trong một giao dịch
+const alertEventBatchSize = 100
+
+// webhookWake đánh thức worker khi có lần gửi mới
+var webhookWake = make(chan struct{}, 1)
+
+// alertEventWake đánh thức worker xếp hàng webhook khi nhận NOTIFY sự kiện cảnh báo
+var alertEventWake = make(chan struct{}, 1)
+
+// WebhookSubscription là đăng ký nhận sự kiện của hệ thống bên ngoài (mở cửa, nhân sự, ticket...)
+type WebhookSubscription struct {
+	ID         uint           `gorm:"primaryKey" json:"id"`
+	Name       string         `json:"name"`
+	URL        string         `json:"url"`
+	Secret     string         `json:"secret,omitempty"` // Chỉ trả về khi tạo mới
+	EventTypes pq.StringArray `gorm:"type:text[]" json:"event_types"`
+	DeviceID   string         `json:"device_id"` // Chỉ nhận sự kiện của thiết bị này, trống là mọi thiết bị
+	Disabled   bool           `json:"disabled"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+}
+
+// webhookEvent là nội dung gửi tới webhook. ID giữ nguyên qua các lần thử lại và replay,
+// bên nhận dùng để bỏ qua sự kiện đã xử lý.
+type webhookEvent struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	DeviceID  string      `json:"device_id,omitempty"`
+	Timestamp time.Time   `json:"timestamp"`
+	Data      interface{} `json:"data"`
+}
+
+// WebhookDelivery là một lần gửi sự kiện tới một đăng ký, giữ lại payload để xem lại và replay
+type WebhookDelivery struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	SubscriptionID uint       `gorm:"index" json:"subscription_id"`
+	EventType      string     `json:"event_type"`
+	EventKey       string     `json:"event_key"` // ID của webhookEvent trong payload
+	Payload        string     `gorm:"type:text" json:"payload"`
+	Status         string     `gorm:"index:idx_webhook_due" json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  time.Time  `gorm:"index:idx_webhook_due" json:"next_attempt_at"`
+	ResponseStatus int        `json:"response_status,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	ReplayOf       *uint      `json:"replay_of,omitempty"` // Lần gửi gốc nếu đây là bản replay
+	DeliveredAt    *time.Time `json:"delivered_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// envInt đọc biến môi trường kiểu số nguyên dương, dùng giá trị mặc định nếu không hợp lệ
+func envInt(key string, def int) int {
+	if n, err := strconv.Atoi(os.Getenv(key)); err == nil && n > 0 {
+		return n
+	}
+	return def
+}
+
+// envDuration đọc biến môi trường kiểu thời lượng (ví dụ "30s"), dùng giá trị mặc định nếu không hợp lệ
+func envDuration(key string, def time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(key)); err == nil && d > 0 {
+		return d
+	}
+	return def
+}
+
+// validate kiểm tra cấu hình đăng ký webhook
+func (s *WebhookSubscription) validate() error {
+	if s.Name == "" {
+		return errors.New("name is required")
+	}
+	u, err := url.Parse(s.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url must be an absolute http or https URL")
+	}
+	if len(s.EventTypes) == 0 {
+		return errors.New("at least one event type is required")
+	}
+	for _, t := range s.EventTypes {
+		if !containsString(webhookEventTypes, t) {
+			return fmt.Errorf("unknown event type %q", t)
+		}
+	}
+	return nil
+}
+
+// matches kiểm tra đăng ký có nhận sự kiện eventType của thiết bị deviceID hay không
+func (s *WebhookSubscription) matches(eventType, deviceID string) bool {
+	if s.DeviceID != "" && s.DeviceID != deviceID {
+		return false
+	}
+	return containsString(s.EventTypes, eventType)
+}
+
+// containsString kiểm tra list có chứa value hay không
+func containsString(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// newWebhookEvent tạo sự kiện xác thực với mã ngẫu nhiên; sự kiện vẫn đủ thông tin để đẩy lên dashboard khi không tạo được mã
+func newWebhookEvent(eventType, deviceID string, data interface{}) (webhookEvent, error) {
+	id, err := newEventID()
+	return webhookEvent{ID: id, Type: eventType, DeviceID: deviceID, Timestamp: time.Now(), Data: data}, err
+}
+
+// recordEvent xếp hàng webhook cho một sự kiện xác thực trong giao dịch tx, cùng giao dịch với dữ liệu
+// tạo ra sự kiện. Sau khi tx commit, bên gọi đẩy sự kiện trả về lên dashboard bằng events.publish.
+func recordEvent(tx *gorm.DB, eventType, deviceID string, data interface{}) (webhookEvent, error) {
+	e, err := newWebhookEvent(eventType, deviceID, data)
+	if err != nil {
+		return e, err
+	}
+	return e, enqueueWebhooks(tx, e)
+}
+
+// enqueueWebhooks tạo một lần gửi cho mỗi đăng ký đang bật nhận sự kiện e.
+// Sự kiện đã được xếp hàng cho một đăng ký thì bỏ qua, nhờ chỉ mục duy nhất (subscription_id, event_key).
+func enqueueWebhooks(tx *gorm.DB, e webhookEvent) error {
+	var subs []WebhookSubscription
+	if err := tx.Where("disabled = ? AND ? = ANY(event_types)", false, e.Type).Find(&subs).Error; err != nil {
+		return fmt.Errorf("load webhook subscriptions: %w", err)
+	}
+
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	var deliveries []WebhookDelivery
+	for _, s := range subs {
+		if !s.matches(e.Type, e.DeviceID) {
+			continue
+		}
+		deliveries = append(deliveries, WebhookDelivery{
+			SubscriptionID: s.ID,
+			EventType:      e.Type,
+			EventKey:       e.ID,
+			Payload:        string(payload),
+			Status:         WebhookPending,
+			NextAttemptAt:  time.Now(),
+		})
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+	err = tx.Clauses(clause.OnConflict{
+		Columns:     []clause.Column{{Name: "subscription_id"}, {Name: "event_key"}},
+		TargetWhere: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "replay_of IS NULL"}}},
+		DoNothing:   true,
+	}).Create(&deliveries).Error
+	if err != nil {
+		return fmt.Errorf("queue webhook deliveries: %w", err)
+	}
+	return nil
+}
+
+// publishEvent đẩy sự kiện đã ghi bằng recordEvent lên dashboard và đánh thức worker webhook.
+// Gọi sau khi giao dịch commit để worker thấy các lần gửi mới.
+func publishEvent(e webhookEvent) {
+	events.publish(e.Type, e.DeviceID, e.Data)
+	wakeWebhooks()
+}
+
+// runAlertEventWebhooks xếp hàng webhook cho các sự kiện cảnh báo alert-service ghi vào alert_events.
+// Mỗi sự kiện được nhận bằng SKIP LOCKED và đánh dấu trong cùng giao dịch với các lần gửi, nên dù mọi bản sao
+// đều chạy worker này, mỗi sự kiện chỉ được xếp hàng một lần. NOTIFY chỉ dùng để đánh thức worker sớm.
+func runAlertEventWebhooks() {
+	for !app.IsStopping() {
+		n, err := enqueueAlertEventWebhooks()
+		if err != nil {
+			slog.Error("Error queueing webhooks for alert events", "error", err)
+		}
+		if n > 0 && err == nil {
+			continue
+		}
+		select {
+		case <-alertEventWake:
+		case <-time.After(webhookPollInterval):
+		case <-app.Stopping():
+		}
+	}
+}
+
+// enqueueAlertEventWebhooks xếp hàng webhook cho một lô sự kiện cảnh báo chưa xử lý, trả về số sự kiện đã xử lý
+func enqueueAlertEventWebhooks() (int, error) {
+	var records []domain.AlertEventRecord
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("webhooks_enqueued_at IS NULL").
+			Order("id").
+			Limit(alertEventBatchSize).
+			Find(&records).Error
+		if err != nil || len(records) == 0 {
+			return err
+		}
+
+		ids := make([]uint64, 0, len(records))
+		for _, r := range records {
+			var payload domain.AlertEvent
+			if err := json.Unmarshal([]byte(r.Payload), &payload); err != nil {
+				// Payload hỏng không thể gửi được, đánh dấu để không chặn các sự kiện sau
+				slog.Error("Invalid alert event record", "alert_event_id", r.ID, "error", err)
+			} else if err := enqueueWebhooks(tx, webhookEvent{
+				ID:        fmt.Sprintf("alert-event-%d", r.ID),
+				Type:      payload.Type,
+				DeviceID:  payload.Alert.DeviceID,
+				Timestamp: r.CreatedAt,
+				Data:      payload.Alert,
+			}); err != nil {
+				return err
+			}
+			ids = append(ids, r.ID)
+		}
+		return tx.Model(&domain.AlertEventRecord{}).Where("id IN ?", ids).Update("webhooks_enqueued_at", time.Now()).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	if len(records) > 0 {
+		wakeWebhooks()
+	}
+	return len(records), nil
+}
+
+// wakeAlertEventWebhooks báo cho worker có sự kiện cảnh báo mới
+func wakeAlertEventWebhooks() {
+	select {
+	case alertEventWake <- struct{}{}:
+	default:
+	}
+}
+
+// wakeWebhooks báo cho worker có lần gửi mới
+func wakeWebhooks() {
+	select {
+	case webhookWake <- struct{}{}:
+	default:
+	}
+}
+
+// runWebhookWorker liên tục gửi các webhook đến hạn; khi dịch vụ tắt thì gửi nốt các webhook đến hạn rồi thoát
+func runWebhookWorker() {
+	for !app.DrainExpired() {
+		delivery, ok, err := claimWebhookDelivery()
+		if err != nil {
+			slog.Error("Error claiming webhook delivery", "error", err)
+		}
+		if !ok {
+			if app.IsStopping() {
+				return
+			}
+			select {
+			case <-webhookWake:
+			case <-time.After(webhookPollInterval):
+			case <-app.Stopping():
+			}
+			continue
+		}
+		processWebhookDelivery(delivery)
+	}
+}
+
+// claimWebhookDelivery nhận một lần gửi đến hạn, dùng SKIP LOCKED để nhiều bản sao dịch vụ không gửi trùng
+func claimWebhookDelivery() (WebhookDelivery, bool, error) {
+	var delivery WebhookDelivery
+	found := false
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", WebhookPending, time.Now()).
+			Order("next_attempt_at").
+			Limit(1).
+			Find(&delivery)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		found = true
+		return tx.Model(&delivery).Update("next_attempt_at", time.Now().Add(webhookLease)).Error
+	})
+	return delivery, found, err
+}
+
+// processWebhookDelivery gửi webhook và cập nhật kết quả, hẹn thử lại nếu lỗi
+func processWebhookDelivery(delivery WebhookDelivery) {
+	delivery.Attempts++
+	updates := map[string]interface{}{"attempts": delivery.Attempts}
+
+	var sub WebhookSubscription
+	err := db.First(&sub, delivery.SubscriptionID).Error
+	status := 0
+	if err == nil {
+		status, err = postWebhook(sub, delivery)
+	}
+	updates["response_status"] = status
+
+	switch {
+	case err == nil:
+		updates["status"] = WebhookDelivered
+		updates["delivered_at"] = time.Now()
+		updates["last_error"] = ""
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		updates["status"] = WebhookFailed
+		updates["last_error"] = "subscription deleted"
+	case delivery.Attempts >= webhookMaxAttempts:
+		updates["status"] = WebhookFailed
+		updates["last_error"] = err.Error()
+		slog.Error("Webhook delivery failed permanently", "delivery_id", delivery.ID, "subscription_id", delivery.SubscriptionID, "error", err)
+	default:
+		updates["next_attempt_at"] = time.Now().Add(webhookBackoff(delivery.Attempts))
+		updates["last_error"] = err.Error()
+		slog.Warn("Webhook delivery failed", "delivery_id", delivery.ID, "subscription_id", delivery.SubscriptionID,
+			"attempt", delivery.Attempts, "max_attempts", webhookMaxAttempts, "error", err)
+	}
+
+	outcome := "retry"
+	if status, ok := updates["status"].(string); ok {
+		outcome = status
+	}
+	webhookDeliveries.WithLabelValues(delivery.EventType, outcome).Inc()
+
+	if err := db.Model(&delivery).Updates(updates).Error; err != nil {
+		slog.Error("Error updating webhook delivery", "delivery_id", delivery.ID, "error", err)
+	}
+}
+
+// postWebhook gửi payload đã ký tới URL của đăng ký, trả về mã HTTP nhận được
+func postWebhook(sub WebhookSubscription, delivery WebhookDelivery) (int, error) {
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequest(http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "isafe-webhooks/1.0")
+	req.Header.Set(webhookEventHeader, delivery.EventType)
+	req.Header.Set(webhookDeliveryHeader, strconv.FormatUint(uint64(delivery.ID), 10))
+	// Ký lại mỗi lần gửi để timestamp luôn mới, kể cả khi thử lại hoặc replay
+	req.Header.Set(webhookSignatureHeader, signing.Sign(sub.Secret, time.Now(), body))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		io.Copy(io.Discard, resp.Body)
+		return resp.StatusCode, nil
+	}
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return resp.StatusCode, fmt.Errorf("endpoint returned %s: %s", resp.Status, strings.TrimSpace(string(respBody)))
+}
+
+// webhookBackoff tăng thời gian chờ theo lũy thừa 2, tối đa webhookMaxBackoff
+func webhookBackoff(attempts int) time.Duration {
+	backoff := webhookMinBackoff << (attempts - 1)
+	if backoff <= 0 || backoff > webhookMaxBackoff {
+		return webhookMaxBackoff
+	}
+	return backoff
+}
+
+// getWebhooksHandler lấy danh sách đăng ký webhook (không kèm secret)
+func getWebhooksHandler(c *gin.Context) {
+	var subs []WebhookSubscription
+	if err := db.Order("id").Find(&subs).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error fetching webhook subscriptions", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	for i := range subs {
+		subs[i].Secret = ""
+	}
+	c.JSON(http.StatusOK, subs)
+}
+
+// saveWebhookHandler tạo mới hoặc cập nhật đăng ký webhook.
+// Tạo mới không kèm secret thì sinh secret ngẫu nhiên; cập nhật không kèm secret thì giữ secret cũ.
+func saveWebhookHandler(c *gin.Context) {
+	var sub WebhookSubscription
+	if err := c.ShouldBindJSON(&sub); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if id := c.Param("id"); id != "" {
+		if _, err := fmt.Sscan(id, &sub.ID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook id"})
+			return
+		}
+	}
+	if err := sub.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	created := sub.ID == 0
+	if sub.Secret == "" {
+		if created {
+			secret, err := newEventID()
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+				return
+			}
+			sub.Secret = secret
+		} else {
+			var existing WebhookSubscription
+			if err := db.First(&existing, sub.ID).Error; err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+				return
+			}
+			sub.Secret = existing.Secret
+		}
+	}
+
+	if err := db.Save(&sub).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error saving webhook subscription", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save webhook"})
+		return
+	}
+	if !created {
+		sub.Secret = ""
+	}
+	c.JSON(http.StatusOK, sub)
+}
+
+// deleteWebhookHandler xóa đăng ký webhook, các lần gửi còn chờ sẽ bị đánh dấu thất bại
+func deleteWebhookHandler(c *gin.Context) {
+	if err := db.Delete(&WebhookSubscription{}, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete webhook"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted successfully"})
+}
+
+// getWebhookDeliveriesHandler lấy nhật ký gửi của một đăng ký, mới nhất trước, lọc theo ?status
+func getWebhookDeliveriesHandler(c *gin.Context) {
+	query := db.Where("subscription_id = ?", c.Param("id"))
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+
+	var deliveries []WebhookDelivery
+	if err := query.Order("id DESC").Limit(limit).Find(&deliveries).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error fetching webhook deliveries", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, deliveries)
+}
+
+// replayWebhookDeliveryHandler gửi lại payload của một lần gửi trước đó dưới dạng lần gửi mới,
+// được ký lại bằng secret hiện tại của đăng ký
+func replayWebhookDeliveryHandler(c *gin.Context) {
+	var original WebhookDelivery
+	if err := db.First(&original, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook delivery not found"})
+		return
+	}
+	if err := db.First(&WebhookSubscription{}, original.SubscriptionID).Error; err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Webhook subscription no longer exists"})
+		return
+	}
+
+	replay := WebhookDelivery{
+		SubscriptionID: original.SubscriptionID,
+		EventType:      original.EventType,
+		EventKey:       original.EventKey,
+		Payload:        original.Payload,
+		Status:         WebhookPending,
+		NextAttemptAt:  time.Now(),
+		ReplayOf:       &original.ID,
+	}
+	if err := db.Create(&replay).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error queueing webhook replay", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue replay"})
+		return
+	}
+	wakeWebhooks()
+	c.JSON(http.StatusAccepted, replay)
+}
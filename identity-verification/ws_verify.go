@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// wsFrameInterval là khoảng cách tối thiểu giữa hai khung hình được xử lý,
+	// các khung hình đến trong khoảng này chỉ giữ lại khung mới nhất
+	wsFrameInterval = 300 * time.Millisecond
+	wsWriteTimeout  = 5 * time.Second
+	wsPongTimeout   = 60 * time.Second
+	wsPingInterval  = 25 * time.Second
+)
+
+// wsMaxMessageSize giới hạn kích thước một message: đủ cho ảnh maxImageBytes ở dạng base64 trong JSON.
+// Khung hình vượt maxImageBytes nhưng dưới giới hạn này được báo lỗi và giữ kết nối;
+// vượt giới hạn này thì kết nối bị đóng với mã 1009 (message too big).
+var wsMaxMessageSize = int64(base64.StdEncoding.EncodedLen(int(maxImageBytes))) + 1<<10
+
+var wsUpgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+		for _, o := range allowedOrigins {
+			if o == origin {
+				return true
+			}
+		}
+		return false
+	},
+}
+
+// wsFrame là một khung hình hoặc lệnh điều khiển nhận từ trình duyệt
+type wsFrame struct {
+	image []byte
+	reset bool
+}
+
+// verifyStreamHandler mở phiên WebSocket xác thực liên tục từ camera trình duyệt.
+// Trình duyệt gửi khung hình dạng binary (JPEG) hoặc JSON {"type":"frame","image":"<base64>"};
+// server chỉ ra quyết định (và gửi cảnh báo) một lần cho mỗi khuôn mặt được theo dõi.
+func verifyStreamHandler(c *gin.Context) {
+	// ctx của request mở phiên mang request_id và trace, dùng cho mọi khung hình của phiên
+	ctx := c.Request.Context()
+	device := lookupDevice(c.Query("device_id"))
+
+	conn, err := wsUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error upgrading to WebSocket", "error", err)
+		return
+	}
+	defer conn.Close()
+
+	conn.SetReadLimit(wsMaxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	})
+
+	// Kênh chỉ chứa khung hình mới nhất chưa xử lý; rejected chứa lỗi khung hình bị từ chối chưa gửi
+	frames := make(chan wsFrame, 1)
+	rejected := make(chan frameMessage, 1)
+	done := make(chan struct{})
+	go readFrames(ctx, conn, frames, rejected, done)
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+
+	// Điều tiết bằng timer thay vì sleep để ping và tắt server không bị chặn khi đang chờ
+	throttle := time.NewTimer(wsFrameInterval)
+	throttle.Stop()
+	defer throttle.Stop()
+	var throttleC <-chan time.Time // Khác nil khi đang chờ đủ wsFrameInterval để xử lý pending
+
+	var track faceTrack
+	var pending []byte
+	var lastProcessed time.Time
+
+	write := func(msg frameMessage) bool {
+		conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+		if err := conn.WriteJSON(msg); err != nil {
+			slog.ErrorContext(ctx, "Error writing WebSocket message", "error", err)
+			return false
+		}
+		return true
+	}
+	process := func() bool {
+		image := pending
+		pending = nil
+		lastProcessed = time.Now()
+		return write(processFrame(ctx, &track, device, image))
+	}
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-app.ShuttingDown():
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"), time.Now().Add(wsWriteTimeout))
+			return
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout)); err != nil {
+				return
+			}
+		case msg := <-rejected:
+			if !write(msg) {
+				return
+			}
+		case <-throttleC:
+			throttleC = nil
+			if pending != nil && !process() {
+				return
+			}
+		case frame := <-frames:
+			if frame.reset {
+				track = faceTrack{}
+				pending = nil
+				continue
+			}
+
+			// Đang chờ thì khung hình mới thay khung đang chờ
+			pending = frame.image
+			if throttleC != nil {
+				continue
+			}
+			if wait := wsFrameInterval - time.Since(lastProcessed); wait > 0 {
+				throttle.Reset(wait)
+				throttleC = throttle.C
+				continue
+			}
+			if !process() {
+				return
+			}
+		}
+	}
+}
+
+// readFrames đọc khung hình từ trình duyệt, thay khung chưa xử lý bằng khung mới nhất.
+// Khung hình không dùng được được báo lại qua rejected để vòng chính gửi lỗi cho trình duyệt.
+func readFrames(ctx context.Context, conn *websocket.Conn, frames chan wsFrame, rejected chan frameMessage, done chan struct{}) {
+	defer close(done)
+	reject := func(message string) {
+		// Đã có lỗi chờ gửi thì bỏ qua, trình duyệt chỉ cần biết khung hình bị từ chối
+		select {
+		case rejected <- frameMessage{Type: "error", Error: message}:
+		default:
+		}
+	}
+
+	for {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				slog.ErrorContext(ctx, "Error reading WebSocket frame", "error", err)
+			}
+			return
+		}
+
+		var frame wsFrame
+		if messageType == websocket.BinaryMessage {
+			if int64(len(data)) > maxImageBytes {
+				requestsRejected.WithLabelValues("/ws/verify", "too_large").Inc()
+				reject(fmt.Sprintf("Image too large (max %d bytes)", maxImageBytes))
+				continue
+			}
+			frame.image = data
+		} else {
+			var msg struct {
+				Type  string `json:"type"`
+				Image string `json:"image"`
+			}
+			if err := json.Unmarshal(data, &msg); err != nil {
+				reject("Invalid message")
+				continue
+			}
+			switch msg.Type {
+			case "reset":
+				frame.reset = true
+			case "frame":
+				image, err := decodeBase64Image(msg.Image)
+				if errors.Is(err, errImageTooLarge) {
+					requestsRejected.WithLabelValues("/ws/verify", "too_large").Inc()
+					reject(fmt.Sprintf("Image too large (max %d bytes)", maxImageBytes))
+					continue
+				}
+				if err != nil {
+					reject("Invalid image encoding")
+					continue
+				}
+				frame.image = image
+			default:
+				reject(fmt.Sprintf("Unknown message type %q", msg.Type))
+				continue
+			}
+		}
+
+		// Bỏ khung hình cũ chưa kịp xử lý
+		select {
+		case <-frames:
+		default:
+		}
+		frames <- frame
+	}
+}
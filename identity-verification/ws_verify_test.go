@@ -0,0 +1,136 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"isafe/shared/logging"
+)
+
+// dialVerifyStream mở phiên /ws/verify tới handler thật; request mở phiên mang request ID "req-ws-1"
+func dialVerifyStream(t *testing.T) *websocket.Conn {
+	t.Helper()
+	router := gin.New()
+	router.GET("/ws/verify", func(c *gin.Context) {
+		c.Request = c.Request.WithContext(logging.WithRequestID(c.Request.Context(), "req-ws-1"))
+	}, verifyStreamHandler)
+	srv := httptest.NewServer(router)
+	t.Cleanup(srv.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws/verify", nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func readFrameMessage(t *testing.T, conn *websocket.Conn) frameMessage {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var msg frameMessage
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	return msg
+}
+
+// stubNoFace trả về "không có khuôn mặt" cho mọi khung hình, ghi lại request ID và số khung hình đã gửi
+func stubNoFace(t *testing.T) func() (int, []string) {
+	var mu sync.Mutex
+	var ids []string
+	stubFaceRecognition(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ids = append(ids, r.Header.Get(logging.RequestIDHeader))
+		mu.Unlock()
+		w.Write([]byte(`{"embedding":[]}`))
+	})
+	return func() (int, []string) {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(ids), append([]string(nil), ids...)
+	}
+}
+
+func TestVerifyStreamRejectsFrames(t *testing.T) {
+	calls := stubNoFace(t)
+	previous := maxImageBytes
+	maxImageBytes = 16
+	t.Cleanup(func() { maxImageBytes = previous })
+	conn := dialVerifyStream(t)
+
+	tests := []struct {
+		name        string
+		messageType int
+		data        string
+		want        string
+	}{
+		{"oversized binary frame", websocket.BinaryMessage, strings.Repeat("x", 17), "Image too large (max 16 bytes)"},
+		{"oversized base64 frame", websocket.TextMessage, `{"type":"frame","image":"` + strings.Repeat("QUFB", 8) + `"}`,
+			"Image too large (max 16 bytes)"},
+		{"invalid base64", websocket.TextMessage, `{"type":"frame","image":"not base64!"}`, "Invalid image encoding"},
+		{"invalid JSON", websocket.TextMessage, `{"type":`, "Invalid message"},
+		{"unknown type", websocket.TextMessage, `{"type":"hello"}`, `Unknown message type "hello"`},
+	}
+	for _, tt := range tests {
+		if err := conn.WriteMessage(tt.messageType, []byte(tt.data)); err != nil {
+			t.Fatalf("%s: write: %v", tt.name, err)
+		}
+		if msg := readFrameMessage(t, conn); msg.Type != "error" || msg.Error != tt.want {
+			t.Errorf("%s: got %+v, want error %q", tt.name, msg, tt.want)
+		}
+	}
+
+	// Kết nối vẫn mở sau khung hình bị từ chối, khung hợp lệ vẫn được xử lý với request ID của phiên
+	conn.WriteMessage(websocket.BinaryMessage, []byte("jpeg"))
+	if msg := readFrameMessage(t, conn); msg.Type != "no_face" {
+		t.Fatalf("valid frame after rejections = %+v, want no_face", msg)
+	}
+	if n, ids := calls(); n != 1 || ids[0] != "req-ws-1" {
+		t.Errorf("face recognition calls = %d with request IDs %v, want 1 with req-ws-1", n, ids)
+	}
+}
+
+func TestVerifyStreamThrottle(t *testing.T) {
+	calls := stubNoFace(t)
+	conn := dialVerifyStream(t)
+
+	conn.WriteMessage(websocket.BinaryMessage, []byte("frame-1"))
+	if msg := readFrameMessage(t, conn); msg.Type != "no_face" {
+		t.Fatalf("first frame = %+v, want no_face", msg)
+	}
+	start := time.Now()
+	conn.WriteMessage(websocket.BinaryMessage, []byte("frame-2"))
+	conn.WriteMessage(websocket.BinaryMessage, []byte("frame-3"))
+
+	// Vòng chính không bị chặn khi đang chờ điều tiết: lỗi được trả ngay, trước kết quả khung hình đang chờ
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"hello"}`))
+	if msg := readFrameMessage(t, conn); msg.Type != "error" {
+		t.Fatalf("message during throttle = %+v, want error", msg)
+	}
+	if elapsed := time.Since(start); elapsed >= wsFrameInterval {
+		t.Errorf("error reply took %v, blocked by the throttle", elapsed)
+	}
+
+	// Chỉ khung hình mới nhất được xử lý sau wsFrameInterval
+	if msg := readFrameMessage(t, conn); msg.Type != "no_face" {
+		t.Fatalf("throttled frame = %+v, want no_face", msg)
+	}
+	if elapsed := time.Since(start); elapsed < wsFrameInterval*2/3 {
+		t.Errorf("throttled frame processed after %v, want about %v", elapsed, wsFrameInterval)
+	}
+	conn.SetReadDeadline(time.Now().Add(2 * wsFrameInterval))
+	if _, _, err := conn.ReadMessage(); err == nil {
+		t.Error("dropped frame was processed")
+	}
+	if n, _ := calls(); n != 2 {
+		t.Errorf("face recognition calls = %d, want 2", n)
+	}
+}
@@ -0,0 +1,2 @@
+-- Schema không khai báo ở đây: mỗi dịch vụ tự chạy migration SQL của mình khi khởi động
+-- (identity-verification/migrations, alert-service/migrations) và ghi phiên bản vào bảng schema_version.
@@ -0,0 +1,106 @@
+package alertapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"isafe/shared/logging"
+	"isafe/shared/signing"
+	"isafe/shared/tracing"
+)
+
+// Client gửi cảnh báo đã ký tới alert-service
+type Client struct {
+	BaseURL    string
+	Secret     string
+	HTTPClient *http.Client
+}
+
+// NewClient tạo client với timeout mặc định để một lần gửi treo không chặn bên gọi.
+// Request mang ngữ cảnh trace và request ID của ctx để alert-service nối tiếp cùng trace và log.
+func NewClient(baseURL, secret string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		Secret:     secret,
+		HTTPClient: &http.Client{Timeout: 10 * time.Second, Transport: tracing.Transport(logging.Transport(nil))},
+	}
+}
+
+// Error là lỗi alert-service trả về kèm mã HTTP
+type Error struct {
+	StatusCode int
+	ErrorResponse
+}
+
+func (e *Error) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("alert service returned %d %s: %s", e.StatusCode, e.Code, e.ErrorResponse.Error)
+	}
+	return fmt.Sprintf("alert service returned %d: %s", e.StatusCode, e.ErrorResponse.Error)
+}
+
+// Retryable cho biết gửi lại có thể thành công hay không. Lỗi 4xx là payload không hợp lệ,
+// trừ timeout, quá tải và sai chữ ký (thường do secret lệch giữa hai dịch vụ, sửa cấu hình là gửi được).
+func (e *Error) Retryable() bool {
+	switch {
+	case e.StatusCode >= 500:
+		return true
+	case e.StatusCode == http.StatusRequestTimeout, e.StatusCode == http.StatusTooManyRequests:
+		return true
+	case e.StatusCode == http.StatusUnauthorized:
+		return true
+	}
+	return false
+}
+
+// SendAlert gửi một cảnh báo; SchemaVersion được điền nếu để trống
+func (c *Client) SendAlert(ctx context.Context, req SendAlertRequest) (*SendAlertResponse, error) {
+	if req.SchemaVersion == 0 {
+		req.SchemaVersion = SchemaVersion
+	}
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	return c.Post(ctx, payload)
+}
+
+// Post gửi payload đã mã hóa sẵn (ví dụ lấy từ outbox), ký lại với timestamp hiện tại
+func (c *Client) Post(ctx context.Context, payload []byte) (*SendAlertResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+SendAlertPath, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, signing.Sign(c.Secret, time.Now(), payload))
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		apiErr := &Error{StatusCode: resp.StatusCode}
+		if json.Unmarshal(body, &apiErr.ErrorResponse) != nil || apiErr.ErrorResponse.Error == "" {
+			apiErr.ErrorResponse.Error = strings.TrimSpace(string(body))
+		}
+		return nil, apiErr
+	}
+
+	var out SendAlertResponse
+	if err := json.Unmarshal(body, &out); err != nil {
+		return nil, fmt.Errorf("invalid alert service response: %w", err)
+	}
+	return &out, nil
+}
@@ -0,0 +1,55 @@
+// Package alertapi là hợp đồng giữa identity-verification và alert-service cho endpoint /send_alert:
+// payload có phiên bản, mã lỗi và client đã ký sẵn.
+package alertapi
+
+// SchemaVersion là phiên bản hiện tại của payload /send_alert
+const SchemaVersion = 1
+
+// SignatureHeader chứa chữ ký HMAC của body (xem package signing)
+const SignatureHeader = "X-Isafe-Signature"
+
+// SendAlertPath là đường dẫn nhận cảnh báo của alert-service
+const SendAlertPath = "/send_alert"
+
+// SendAlertRequest là payload /send_alert phiên bản 1
+type SendAlertRequest struct {
+	SchemaVersion int      `json:"schema_version"`
+	EventID       string   `json:"event_id"`   // Mã sự kiện do bên gửi tạo, dùng để chống trùng khi gửi lại
+	Similarity    *float64 `json:"similarity"` // Bắt buộc, con trỏ để phân biệt 0 với thiếu trường
+	AlertMessage  string   `json:"alert_message"`
+	FaceSnapshot  string   `json:"face_snapshot"` // Ảnh JPEG/PNG mã hóa base64
+	Timestamp     string   `json:"timestamp"`     // RFC 3339
+	Status        string   `json:"status"`        // Loại cảnh báo, ví dụ "unrecognized"
+	DeviceID      string   `json:"device_id,omitempty"`
+	Zone          string   `json:"zone,omitempty"`
+	Severity      string   `json:"severity,omitempty"` // Mặc định suy ra từ status
+}
+
+// SendAlertResponse là phản hồi khi alert-service đã nhận cảnh báo
+type SendAlertResponse struct {
+	Status       string `json:"status"`
+	ID           uint   `json:"id"`
+	SuppressedBy string `json:"suppressed_by,omitempty"`
+}
+
+// Mã lỗi khi alert-service từ chối payload
+const (
+	ErrCodeMissingSignature   = "missing_signature"
+	ErrCodeInvalidSignature   = "invalid_signature"
+	ErrCodeSignatureExpired   = "signature_expired"
+	ErrCodeIngressDisabled    = "ingress_not_configured"
+	ErrCodePayloadTooLarge    = "payload_too_large"
+	ErrCodeInvalidJSON        = "invalid_json"
+	ErrCodeUnsupportedVersion = "unsupported_schema_version"
+	ErrCodeMissingField       = "missing_field"
+	ErrCodeInvalidField       = "invalid_field"
+	ErrCodeSnapshotTooLarge   = "snapshot_too_large"
+	ErrCodeInvalidSnapshot    = "invalid_snapshot"
+)
+
+// ErrorResponse là body lỗi của alert-service
+type ErrorResponse struct {
+	Error string `json:"error"`
+	Code  string `json:"code,omitempty"`
+	Field string `json:"field,omitempty"`
+}
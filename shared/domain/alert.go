@@ -0,0 +1,50 @@
+package domain
+
+import "time"
+
+// Alert là mô hình cảnh báo trong cơ sở dữ liệu. Schema do alert-service quản lý.
+type Alert struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	EventID      *string   `gorm:"uniqueIndex" json:"event_id,omitempty"` // Mã sự kiện từ bên gửi, chống tạo trùng khi gửi lại
+	Similarity   float64   `json:"similarity"`
+	AlertMessage string    `json:"alert_message"`
+	FaceSnapshot string    `json:"face_snapshot"` // Base64 string
+	Timestamp    time.Time `json:"timestamp"`
+	Status       string    `json:"status"`
+	DeviceID     string    `json:"device_id"`
+	Zone         string    `json:"zone"`
+	Severity     string    `json:"severity"`                  // low, medium, high, critical
+	SuppressedBy string    `json:"suppressed_by,omitempty"`   // Silence hoặc khung bảo trì đã chặn thông báo
+	State        string    `gorm:"default:open" json:"state"` // open, acknowledged, resolved, false_positive
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// Trạng thái xử lý của cảnh báo
+const (
+	AlertStateOpen          = "open"
+	AlertStateAcknowledged  = "acknowledged"
+	AlertStateResolved      = "resolved"
+	AlertStateFalsePositive = "false_positive"
+)
+
+// Loại cảnh báo do identity-verification phát hiện
+const (
+	AlertStatusUnrecognized         = "unrecognized"
+	AlertStatusVisitorZoneViolation = "visitor_zone_violation"
+)
+
+// Mức độ nghiêm trọng của cảnh báo, theo thứ tự tăng dần
+const (
+	SeverityLow      = "low"
+	SeverityMedium   = "medium"
+	SeverityHigh     = "high"
+	SeverityCritical = "critical"
+)
+
+// SeverityRank là thứ hạng của từng mức độ nghiêm trọng để so sánh
+var SeverityRank = map[string]int{
+	SeverityLow:      1,
+	SeverityMedium:   2,
+	SeverityHigh:     3,
+	SeverityCritical: 4,
+}
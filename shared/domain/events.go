@@ -0,0 +1,66 @@
+package domain
+
+import "time"
+
+// Các loại sự kiện thời gian thực (SSE, webhook)
+const (
+	EventVerificationMatched  = "verification.matched"
+	EventVerificationRejected = "verification.rejected"
+	EventAlertCreated         = "alert.created"
+	EventAlertUpdated         = "alert.updated"
+	// EventVisitorCheckedIn báo cho người tiếp đón khi khách đến; chỉ là thông tin, không tạo cảnh báo
+	EventVisitorCheckedIn = "visitor.checked_in"
+)
+
+// AlertEventsChannel là kênh Postgres LISTEN/NOTIFY mà alert-service phát sự kiện cảnh báo
+const AlertEventsChannel = "alert_events"
+
+// AlertEvent là payload NOTIFY trên AlertEventsChannel
+type AlertEvent struct {
+	Type  string       `json:"type"`
+	Alert AlertSummary `json:"alert"`
+}
+
+// AlertEventRecord là sự kiện cảnh báo alert-service ghi vào bảng alert_events trong cùng giao dịch
+// với thay đổi cảnh báo. identity-verification xếp hàng webhook từ bảng này rồi đánh dấu WebhooksEnqueuedAt,
+// nên sự kiện không mất khi NOTIFY bị lỡ và không bị xếp hàng nhiều lần khi có nhiều bản sao dịch vụ.
+type AlertEventRecord struct {
+	ID                 uint64 `gorm:"primaryKey"`
+	Type               string
+	Payload            string `gorm:"type:text"` // AlertEvent dạng JSON
+	CreatedAt          time.Time
+	WebhooksEnqueuedAt *time.Time
+}
+
+// TableName trả về tên bảng do alert-service quản lý
+func (AlertEventRecord) TableName() string {
+	return "alert_events"
+}
+
+// AlertSummary là cảnh báo không kèm ảnh chụp, vì NOTIFY giới hạn payload 8000 byte
+type AlertSummary struct {
+	ID           uint      `json:"id"`
+	Similarity   float64   `json:"similarity"`
+	AlertMessage string    `json:"alert_message"`
+	Timestamp    time.Time `json:"timestamp"`
+	Status       string    `json:"status"`
+	DeviceID     string    `json:"device_id"`
+	Zone         string    `json:"zone"`
+	Severity     string    `json:"severity"`
+	State        string    `json:"state"`
+}
+
+// Summary trả về bản tóm tắt của cảnh báo để phát sự kiện
+func (a Alert) Summary() AlertSummary {
+	return AlertSummary{
+		ID:           a.ID,
+		Similarity:   a.Similarity,
+		AlertMessage: a.AlertMessage,
+		Timestamp:    a.Timestamp,
+		Status:       a.Status,
+		DeviceID:     a.DeviceID,
+		Zone:         a.Zone,
+		Severity:     a.Severity,
+		State:        a.State,
+	}
+}
@@ -0,0 +1,22 @@
+// Package domain chứa các kiểu dữ liệu nghiệp vụ dùng chung giữa các dịch vụ isafe.
+//
+// Mỗi bảng chỉ do một dịch vụ quản lý schema (migration SQL): users thuộc identity-verification,
+// alerts thuộc alert-service. Dịch vụ còn lại chỉ đọc hoặc giao tiếp qua API.
+package domain
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// User là người dùng đã đăng ký khuôn mặt. Schema do identity-verification quản lý.
+type User struct {
+	ID            uint `gorm:"primaryKey"`
+	Name          string
+	FaceEmbedding pq.Float64Array `gorm:"type:float8[]"`
+	Role          string
+	SnapshotPath  string `json:"snapshot_path"`
+	LastSeen      time.Time
+	ShiftID       *uint
+}
@@ -0,0 +1,147 @@
+// Package lifecycle điều phối việc tắt dịch vụ an toàn khi nhận SIGTERM hoặc SIGINT.
+//
+// Trình tự tắt:
+//  1. ShuttingDown đóng: /readyz trả 503 để load balancer ngừng gửi request mới, các kết nối
+//     SSE/WebSocket kết thúc;
+//  2. HTTP server chờ các request đang xử lý xong;
+//  3. Stopping đóng: worker nền ngừng chờ việc mới, xả nốt các việc đã đến hạn rồi thoát;
+//  4. chạy các hàm dọn dẹp (đẩy nốt span tracing, đóng kết nối cơ sở dữ liệu).
+//
+// Toàn bộ quá trình giới hạn bởi drain timeout. Hết thời gian thì DrainExpired trả về true để worker
+// ngừng nhận thêm việc; việc chưa xong vẫn nằm trong outbox và được xử lý ở lần chạy sau.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// cleanupTimeout là thời gian tối thiểu dành cho các hàm dọn dẹp, kể cả khi drain đã hết giờ
+const cleanupTimeout = 5 * time.Second
+
+// Service theo dõi các worker nền và trạng thái tắt của một dịch vụ
+type Service struct {
+	drainTimeout time.Duration
+
+	shuttingDown  context.Context
+	beginShutdown context.CancelFunc
+	stopping      context.Context
+	stopWorkers   context.CancelFunc
+	drain         context.Context
+	expireDrain   context.CancelFunc
+
+	workers sync.WaitGroup
+}
+
+// New tạo Service với thời gian drain tối đa drainTimeout
+func New(drainTimeout time.Duration) *Service {
+	s := &Service{drainTimeout: drainTimeout}
+	s.shuttingDown, s.beginShutdown = context.WithCancel(context.Background())
+	s.stopping, s.stopWorkers = context.WithCancel(context.Background())
+	s.drain, s.expireDrain = context.WithCancel(context.Background())
+	return s
+}
+
+// ShuttingDown đóng khi dịch vụ bắt đầu tắt
+func (s *Service) ShuttingDown() <-chan struct{} {
+	return s.shuttingDown.Done()
+}
+
+// IsShuttingDown cho biết dịch vụ đã bắt đầu tắt hay chưa
+func (s *Service) IsShuttingDown() bool {
+	return s.shuttingDown.Err() != nil
+}
+
+// Stopping đóng khi HTTP server đã dừng và worker nền cần xả hàng đợi rồi thoát
+func (s *Service) Stopping() <-chan struct{} {
+	return s.stopping.Done()
+}
+
+// StoppingContext bị hủy cùng lúc với Stopping, dùng cho các vòng lặp chờ I/O (long polling, LISTEN)
+func (s *Service) StoppingContext() context.Context {
+	return s.stopping
+}
+
+// IsStopping cho biết worker nền có cần thoát sau khi xả hàng đợi hay không
+func (s *Service) IsStopping() bool {
+	return s.stopping.Err() != nil
+}
+
+// DrainExpired cho biết thời gian drain đã hết, worker không được nhận thêm việc
+func (s *Service) DrainExpired() bool {
+	return s.drain.Err() != nil
+}
+
+// Go chạy worker nền; khi tắt, Run chờ worker trả về trong thời gian drain
+func (s *Service) Go(fn func()) {
+	s.workers.Add(1)
+	go func() {
+		defer s.workers.Done()
+		fn()
+	}()
+}
+
+// Run chạy srv cho tới khi nhận SIGTERM/SIGINT rồi tắt theo trình tự trên.
+// cleanups chạy sau cùng theo thứ tự truyền vào.
+func (s *Service) Run(srv *http.Server, cleanups ...func(context.Context) error) error {
+	signals, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		slog.Info("HTTP server listening", "addr", srv.Addr)
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	var runErr error
+	select {
+	case err := <-serveErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			runErr = err
+		}
+	case <-signals.Done():
+		slog.Info("Shutdown signal received, draining", "timeout", s.drainTimeout.String())
+	}
+	stopSignals()
+
+	started := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), s.drainTimeout)
+	defer cancel()
+
+	s.beginShutdown()
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.Warn("HTTP server did not drain in time", "error", err)
+	}
+
+	s.stopWorkers()
+	done := make(chan struct{})
+	go func() {
+		s.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		s.expireDrain()
+		slog.Warn("Background workers did not finish in time, leaving remaining work queued")
+	}
+	s.expireDrain()
+
+	cleanupCtx, cancelCleanup := context.WithTimeout(context.Background(), cleanupTimeout)
+	defer cancelCleanup()
+	for _, cleanup := range cleanups {
+		if err := cleanup(cleanupCtx); err != nil {
+			slog.Warn("Error during shutdown cleanup", "error", err)
+		}
+	}
+
+	slog.Info("Shutdown complete", "duration", time.Since(started).Round(time.Millisecond).String())
+	return runErr
+}
@@ -0,0 +1,79 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// gormLogger ghi log của gorm qua slog để có request_id và đi qua handler che dữ liệu nhạy cảm,
+// thay cho logger mặc định của gorm ghi văn bản thẳng ra stdout
+type gormLogger struct {
+	gormlogger.Config
+}
+
+// NewGormLogger trả về logger cho gorm.Config. Nên bật ParameterizedQueries để câu SQL trong log
+// không chứa giá trị tham số (embedding, ảnh base64) và IgnoreRecordNotFoundError vì First
+// không tìm thấy bản ghi là luồng bình thường.
+func NewGormLogger(config gormlogger.Config) gormlogger.Interface {
+	return &gormLogger{Config: config}
+}
+
+func (l *gormLogger) LogMode(level gormlogger.LogLevel) gormlogger.Interface {
+	logger := *l
+	logger.LogLevel = level
+	return &logger
+}
+
+func (l *gormLogger) Info(ctx context.Context, msg string, data ...interface{}) {
+	if l.LogLevel >= gormlogger.Info {
+		slog.InfoContext(ctx, fmt.Sprintf(msg, data...))
+	}
+}
+
+func (l *gormLogger) Warn(ctx context.Context, msg string, data ...interface{}) {
+	if l.LogLevel >= gormlogger.Warn {
+		slog.WarnContext(ctx, fmt.Sprintf(msg, data...))
+	}
+}
+
+func (l *gormLogger) Error(ctx context.Context, msg string, data ...interface{}) {
+	if l.LogLevel >= gormlogger.Error {
+		slog.ErrorContext(ctx, fmt.Sprintf(msg, data...))
+	}
+}
+
+// Trace ghi truy vấn lỗi ở mức error, truy vấn chậm hơn SlowThreshold ở mức warn
+// và mọi truy vấn ở mức debug khi LogLevel là Info
+func (l *gormLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	if l.LogLevel <= gormlogger.Silent {
+		return
+	}
+
+	elapsed := time.Since(begin)
+	switch {
+	case err != nil && l.LogLevel >= gormlogger.Error && (!errors.Is(err, gorm.ErrRecordNotFound) || !l.IgnoreRecordNotFoundError):
+		sql, rows := fc()
+		slog.ErrorContext(ctx, "Database query failed", "error", err, "sql", sql, "rows", rows, "duration_ms", elapsed.Milliseconds())
+	case l.SlowThreshold != 0 && elapsed > l.SlowThreshold && l.LogLevel >= gormlogger.Warn:
+		sql, rows := fc()
+		slog.WarnContext(ctx, "Slow database query", "sql", sql, "rows", rows, "duration_ms", elapsed.Milliseconds(),
+			"threshold_ms", l.SlowThreshold.Milliseconds())
+	case l.LogLevel >= gormlogger.Info:
+		sql, rows := fc()
+		slog.DebugContext(ctx, "Database query", "sql", sql, "rows", rows, "duration_ms", elapsed.Milliseconds())
+	}
+}
+
+// ParamsFilter bỏ giá trị tham số khỏi câu SQL được log khi bật ParameterizedQueries
+func (l *gormLogger) ParamsFilter(ctx context.Context, sql string, params ...interface{}) (string, []interface{}) {
+	if l.ParameterizedQueries {
+		return sql, nil
+	}
+	return sql, params
+}
@@ -0,0 +1,216 @@
+// Package logging cấu hình slog cho các dịch vụ: log JSON, mức log theo LOG_LEVEL,
+// gắn request_id từ context và tự động che embedding, ảnh và thông tin đăng nhập.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// RequestIDHeader là header mang request ID giữa client và các dịch vụ
+const RequestIDHeader = "X-Request-ID"
+
+// Redacted thay cho giá trị nhạy cảm trong log
+const Redacted = "[REDACTED]"
+
+// sensitiveKeys là các phần tên khóa có giá trị không được ghi ra log
+var sensitiveKeys = []string{
+	"password", "secret", "token", "authorization", "signature", "dsn", "api_key", "apikey",
+	"embedding", "snapshot", "image", "photo",
+}
+
+// maxFloatSlice là số phần tử tối đa của mảng số thực được ghi ra; mảng dài hơn gần như chắc chắn là embedding
+const maxFloatSlice = 8
+
+var (
+	// credentialPattern che giá trị của password=..., secret=... trong chuỗi, ví dụ DSN trong thông báo lỗi
+	credentialPattern = regexp.MustCompile(`(?i)\b(password|secret|token|api_key)=([^\s&]+)`)
+	// telegramTokenPattern che bot token trong URL Telegram, xuất hiện trong lỗi của http.Client
+	telegramTokenPattern = regexp.MustCompile(`\bbot\d+:[A-Za-z0-9_-]+`)
+	// base64Pattern che chuỗi base64 dài (ảnh mã hóa)
+	base64Pattern = regexp.MustCompile(`[A-Za-z0-9+/]{256,}={0,2}`)
+	// floatListPattern che danh sách số thực dài kiểu "[0.12 -0.3 ...]" do %v in ra
+	floatListPattern = regexp.MustCompile(`\[(?:-?\d+(?:\.\d+)?(?:e[-+]?\d+)?[ ,]+){8,}-?\d+(?:\.\d+)?(?:e[-+]?\d+)?\]`)
+)
+
+type ctxKey struct{}
+
+// Setup đặt logger mặc định của slog và gói log chuẩn cho dịch vụ service.
+// LOG_LEVEL nhận debug, info, warn, error (mặc định info); LOG_FORMAT=text để đọc dễ hơn khi chạy local.
+func Setup(service string) *slog.Logger {
+	format := strings.ToLower(os.Getenv("LOG_FORMAT"))
+	logger := slog.New(NewHandler(os.Stdout, ParseLevel(os.Getenv("LOG_LEVEL")), format != "text")).
+		With(slog.String("service", service))
+	slog.SetDefault(logger)
+	// Các log.Printf còn lại cũng đi qua handler ở mức info nên vẫn là JSON và được che
+	log.SetFlags(0)
+	return logger
+}
+
+// ParseLevel đọc mức log, giá trị không hợp lệ coi như info
+func ParseLevel(value string) slog.Level {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(strings.TrimSpace(value))); err != nil {
+		return slog.LevelInfo
+	}
+	return level
+}
+
+// NewHandler tạo handler ghi ra w, che dữ liệu nhạy cảm và gắn request_id lấy từ context
+func NewHandler(w io.Writer, level slog.Leveler, json bool) slog.Handler {
+	opts := &slog.HandlerOptions{Level: level, ReplaceAttr: redactAttr}
+	if json {
+		return &handler{Handler: slog.NewJSONHandler(w, opts)}
+	}
+	return &handler{Handler: slog.NewTextHandler(w, opts)}
+}
+
+type handler struct {
+	slog.Handler
+}
+
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+	r.Message = RedactString(r.Message)
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &handler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	return &handler{Handler: h.Handler.WithGroup(name)}
+}
+
+// redactAttr che giá trị theo tên khóa, mảng số thực dài và chuỗi chứa thông tin nhạy cảm
+func redactAttr(_ []string, a slog.Attr) slog.Attr {
+	if a.Value.Kind() == slog.KindGroup {
+		return a
+	}
+	if isSensitiveKey(a.Key) {
+		return slog.String(a.Key, Redacted)
+	}
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, RedactString(a.Value.String()))
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			return slog.String(a.Key, RedactString(err.Error()))
+		}
+		v := reflect.ValueOf(a.Value.Any())
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Float64 && v.Len() > maxFloatSlice {
+			return slog.String(a.Key, Redacted)
+		}
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			return slog.String(a.Key, Redacted)
+		}
+	}
+	return a
+}
+
+func isSensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, s := range sensitiveKeys {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactString che mật khẩu, token, chuỗi base64 dài và danh sách số thực dài trong s
+func RedactString(s string) string {
+	s = credentialPattern.ReplaceAllString(s, "$1="+Redacted)
+	s = telegramTokenPattern.ReplaceAllString(s, "bot"+Redacted)
+	s = base64Pattern.ReplaceAllString(s, Redacted)
+	return floatListPattern.ReplaceAllString(s, Redacted)
+}
+
+// NewRequestID tạo request ID ngẫu nhiên
+func NewRequestID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(buf)
+}
+
+// RequestIDFromHeader dùng request ID client gửi lên nếu hợp lệ, ngược lại tạo mới.
+// Chỉ nhận chữ, số và "-_." tối đa 64 ký tự để không ghi được nội dung tùy ý vào log.
+func RequestIDFromHeader(value string) string {
+	if value == "" || len(value) > 64 {
+		return NewRequestID()
+	}
+	for _, r := range value {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+		default:
+			return NewRequestID()
+		}
+	}
+	return value
+}
+
+// WithRequestID gắn request ID vào ctx
+func WithRequestID(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// RequestID lấy request ID trong ctx, rỗng nếu không có
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(ctxKey{}).(string)
+	return id
+}
+
+// Transport bọc base để request đi ra mang header X-Request-ID của ctx
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return roundTripper{base: base}
+}
+
+type roundTripper struct {
+	base http.RoundTripper
+}
+
+func (t roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	id := RequestID(req.Context())
+	if id == "" || req.Header.Get(RequestIDHeader) != "" {
+		return t.base.RoundTrip(req)
+	}
+	// RoundTripper không được sửa request gốc
+	req = req.Clone(req.Context())
+	req.Header.Set(RequestIDHeader, id)
+	return t.base.RoundTrip(req)
+}
+
+// Fatal ghi log mức error rồi thoát, thay cho log.Fatalf khi khởi động dịch vụ
+func Fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// Infof ghi log mức info theo định dạng printf, dùng cho thư viện nhận hàm log kiểu log.Printf
+func Infof(format string, args ...any) {
+	slog.Info(fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,64 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// Usage mô tả các lệnh của RunCommand
+const Usage = `usage: migrate <command>
+  up            apply all pending migrations
+  down [n]      revert the last n migrations (default 1)
+  to <version>  migrate up or down to the given version (0 reverts everything)
+  status        list migrations and when they were applied`
+
+// RunCommand thực thi lệnh migrate từ dòng lệnh, ví dụ "./main migrate down 1"
+func (m *Migrator) RunCommand(ctx context.Context, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing command\n%s", Usage)
+	}
+
+	switch args[0] {
+	case "up":
+		return m.Up(ctx)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n <= 0 {
+				return fmt.Errorf("invalid step count %q", args[1])
+			}
+			steps = n
+		}
+		return m.Down(ctx, steps)
+	case "to":
+		if len(args) < 2 {
+			return fmt.Errorf("missing target version\n%s", Usage)
+		}
+		target, err := strconv.Atoi(args[1])
+		if err != nil || target < 0 {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		return m.To(ctx, target)
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "VERSION\tNAME\tAPPLIED AT\n")
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		return w.Flush()
+	}
+	return fmt.Errorf("unknown command %q\n%s", args[0], Usage)
+}
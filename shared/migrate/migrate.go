@@ -0,0 +1,315 @@
+// Package migrate chạy các migration SQL có phiên bản cho từng dịch vụ.
+//
+// Migration là cặp file "<version>_<name>.up.sql" và "<version>_<name>.down.sql" (down có thể thiếu
+// nếu migration không đảo ngược được). Các phiên bản đã chạy được ghi trong bảng schema_version theo
+// tên dịch vụ. Mọi thao tác giữ pg_advisory_lock nên nhiều bản sao khởi động cùng lúc vẫn an toàn:
+// bản sao đến sau chờ rồi thấy schema đã cập nhật.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// lockKey là khóa pg_advisory_lock dùng chung cho mọi dịch vụ, để hai dịch vụ không đổi schema cùng lúc
+const lockKey int64 = 0x69736166650001
+
+// Migration là một bước thay đổi schema
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string // Rỗng nếu không đảo ngược được
+}
+
+// Status là trạng thái của một migration
+type Status struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Migrator chạy migration của một dịch vụ trên cơ sở dữ liệu
+type Migrator struct {
+	db         *sql.DB
+	service    string
+	migrations []Migration
+	logf       func(format string, args ...interface{})
+}
+
+// New đọc các file migration trong dir của fsys (thường là embed.FS)
+func New(db *sql.DB, service string, fsys fs.FS, dir string, logf func(string, ...interface{})) (*Migrator, error) {
+	migrations, err := Load(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	if logf == nil {
+		logf = func(string, ...interface{}) {}
+	}
+	return &Migrator{db: db, service: service, migrations: migrations, logf: logf}, nil
+}
+
+// Load đọc và sắp xếp các migration theo phiên bản
+func Load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		name := entry.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+
+		base := strings.TrimSuffix(name, "."+direction+".sql")
+		rawVersion, label, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(rawVersion)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration file name %q, expected <version>_<name>.%s.sql", name, direction)
+		}
+		content, err := fs.ReadFile(fsys, path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: label}
+			byVersion[version] = m
+		} else if m.Name != label {
+			return nil, fmt.Errorf("migration %d has mismatched names %q and %q", version, m.Name, label)
+		}
+		if direction == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Latest là phiên bản mới nhất có trong các file migration
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Up chạy mọi migration chưa áp dụng
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.To(ctx, m.Latest())
+}
+
+// Down đảo ngược steps migration gần nhất
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		return m.run(ctx, conn, planDown(m.migrations, applied, steps))
+	})
+}
+
+// To đưa schema về đúng phiên bản target: chạy up các migration <= target chưa áp dụng
+// và down các migration > target đã áp dụng
+func (m *Migrator) To(ctx context.Context, target int) error {
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		return m.run(ctx, conn, planTo(m.migrations, applied, target))
+	})
+}
+
+// step là một migration cần chạy theo hướng up hoặc down
+type step struct {
+	Migration
+	up bool
+}
+
+// planDown chọn steps migration đã áp dụng gần nhất để đảo ngược, mới nhất trước
+func planDown(migrations []Migration, applied map[int]time.Time, steps int) []step {
+	var plan []step
+	for i := len(migrations) - 1; i >= 0 && len(plan) < steps; i-- {
+		if _, ok := applied[migrations[i].Version]; ok {
+			plan = append(plan, step{Migration: migrations[i]})
+		}
+	}
+	return plan
+}
+
+// planTo chọn các bước đưa schema về phiên bản target: đảo ngược các migration > target đã áp dụng
+// (mới nhất trước), rồi chạy các migration <= target chưa áp dụng (cũ nhất trước)
+func planTo(migrations []Migration, applied map[int]time.Time, target int) []step {
+	var plan []step
+	for i := len(migrations) - 1; i >= 0; i-- {
+		if _, ok := applied[migrations[i].Version]; ok && migrations[i].Version > target {
+			plan = append(plan, step{Migration: migrations[i]})
+		}
+	}
+	for _, mig := range migrations {
+		if _, ok := applied[mig.Version]; !ok && mig.Version <= target {
+			plan = append(plan, step{Migration: mig, up: true})
+		}
+	}
+	return plan
+}
+
+// run chạy lần lượt các bước, dừng ở bước lỗi đầu tiên
+func (m *Migrator) run(ctx context.Context, conn *sql.Conn, plan []step) error {
+	for _, s := range plan {
+		var err error
+		if s.up {
+			err = m.apply(ctx, conn, s.Migration)
+		} else {
+			err = m.revert(ctx, conn, s.Migration)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Status liệt kê các migration cùng thời điểm đã áp dụng
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var statuses []Status
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, mig := range m.migrations {
+			s := Status{Migration: mig}
+			if at, ok := applied[mig.Version]; ok {
+				s.AppliedAt = &at
+			}
+			statuses = append(statuses, s)
+		}
+		return nil
+	})
+	return statuses, err
+}
+
+// withLock giữ advisory lock trên một kết nối riêng trong suốt fn; lock tự nhả khi kết nối đóng
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockKey); err != nil {
+		return fmt.Errorf("acquire migration lock: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", lockKey)
+
+	if _, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_version (
+		service    text        NOT NULL,
+		version    integer     NOT NULL,
+		name       text        NOT NULL,
+		applied_at timestamptz NOT NULL DEFAULT now(),
+		PRIMARY KEY (service, version)
+	)`); err != nil {
+		return fmt.Errorf("create schema_version table: %w", err)
+	}
+	return fn(conn)
+}
+
+// applied trả về các phiên bản đã áp dụng của dịch vụ
+func (m *Migrator) applied(ctx context.Context, conn *sql.Conn) (map[int]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, applied_at FROM schema_version WHERE service = $1", m.service)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+	return applied, rows.Err()
+}
+
+// apply chạy một migration và ghi phiên bản trong cùng giao dịch
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, mig Migration) error {
+	started := time.Now()
+	err := inTx(ctx, conn, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, mig.Up); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "INSERT INTO schema_version (service, version, name) VALUES ($1, $2, $3)",
+			m.service, mig.Version, mig.Name)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("migration %d_%s up: %w", mig.Version, mig.Name, err)
+	}
+	m.logf("Applied migration %s %d_%s in %s", m.service, mig.Version, mig.Name, time.Since(started).Round(time.Millisecond))
+	return nil
+}
+
+// revert đảo ngược một migration và xóa phiên bản trong cùng giao dịch
+func (m *Migrator) revert(ctx context.Context, conn *sql.Conn, mig Migration) error {
+	if mig.Down == "" {
+		return fmt.Errorf("migration %d_%s is irreversible", mig.Version, mig.Name)
+	}
+	err := inTx(ctx, conn, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, mig.Down); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "DELETE FROM schema_version WHERE service = $1 AND version = $2", m.service, mig.Version)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("migration %d_%s down: %w", mig.Version, mig.Name, err)
+	}
+	m.logf("Reverted migration %s %d_%s", m.service, mig.Version, mig.Name)
+	return nil
+}
+
+func inTx(ctx context.Context, conn *sql.Conn, fn func(tx *sql.Tx) error) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil && !errors.Is(rbErr, sql.ErrTxDone) {
+			return fmt.Errorf("%w (rollback: %v)", err, rbErr)
+		}
+		return err
+	}
+	return tx.Commit()
+}
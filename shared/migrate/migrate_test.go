@@ -0,0 +1,173 @@
+package migrate
+
+import (
+	"io/fs"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func file(content string) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte(content)}
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   fstest.MapFS
+		want    []Migration
+		wantErr string
+	}{
+		{
+			name: "pairs up and down files and sorts by version",
+			files: fstest.MapFS{
+				"migrations/0010_add_index.up.sql":   file("CREATE INDEX"),
+				"migrations/0002_backfill.up.sql":    file("UPDATE"),
+				"migrations/0001_baseline.down.sql":  file("DROP TABLE"),
+				"migrations/0001_baseline.up.sql":    file("CREATE TABLE"),
+				"migrations/0010_add_index.down.sql": file("DROP INDEX"),
+			},
+			want: []Migration{
+				{Version: 1, Name: "baseline", Up: "CREATE TABLE", Down: "DROP TABLE"},
+				{Version: 2, Name: "backfill", Up: "UPDATE"},
+				{Version: 10, Name: "add_index", Up: "CREATE INDEX", Down: "DROP INDEX"},
+			},
+		},
+		{
+			name: "ignores files that are not migrations",
+			files: fstest.MapFS{
+				"migrations/0001_baseline.up.sql": file("CREATE TABLE"),
+				"migrations/README.md":            file("notes"),
+				"migrations/0002_draft.sql":       file("SELECT 1"),
+			},
+			want: []Migration{{Version: 1, Name: "baseline", Up: "CREATE TABLE"}},
+		},
+		{
+			name:  "empty directory",
+			files: fstest.MapFS{"migrations": &fstest.MapFile{Mode: fs.ModeDir | 0o755}},
+			want:  []Migration{},
+		},
+		{
+			name:    "missing directory",
+			files:   fstest.MapFS{},
+			wantErr: "file does not exist",
+		},
+		{
+			name:    "down without up",
+			files:   fstest.MapFS{"migrations/0003_orphan.down.sql": file("DROP")},
+			wantErr: "migration 3_orphan has no up file",
+		},
+		{
+			name: "mismatched names for one version",
+			files: fstest.MapFS{
+				"migrations/0001_baseline.up.sql":  file("CREATE"),
+				"migrations/0001_initial.down.sql": file("DROP"),
+			},
+			wantErr: "mismatched names",
+		},
+		{
+			name:    "missing name",
+			files:   fstest.MapFS{"migrations/0001.up.sql": file("CREATE")},
+			wantErr: `invalid migration file name "0001.up.sql"`,
+		},
+		{
+			name:    "non-numeric version",
+			files:   fstest.MapFS{"migrations/v1_baseline.up.sql": file("CREATE")},
+			wantErr: `invalid migration file name "v1_baseline.up.sql"`,
+		},
+		{
+			name:    "version zero",
+			files:   fstest.MapFS{"migrations/0000_baseline.up.sql": file("CREATE")},
+			wantErr: `invalid migration file name "0000_baseline.up.sql"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Load(tt.files, "migrations")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Load() error = %v, want error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Load() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// describe trả về kế hoạch dạng "up 1", "down 3" để so sánh dễ đọc
+func describe(plan []step) []string {
+	out := []string{}
+	for _, s := range plan {
+		direction := "down"
+		if s.up {
+			direction = "up"
+		}
+		out = append(out, direction+" "+strings.TrimLeft(s.Name, "m"))
+	}
+	return out
+}
+
+func TestPlan(t *testing.T) {
+	migrations := []Migration{
+		{Version: 1, Name: "m1"},
+		{Version: 2, Name: "m2"},
+		{Version: 3, Name: "m3"},
+		{Version: 5, Name: "m5"},
+	}
+	applied := func(versions ...int) map[int]time.Time {
+		m := map[int]time.Time{}
+		for _, v := range versions {
+			m[v] = time.Unix(0, 0)
+		}
+		return m
+	}
+
+	toTests := []struct {
+		name    string
+		applied map[int]time.Time
+		target  int
+		want    []string
+	}{
+		{"fresh database to latest", applied(), 5, []string{"up 1", "up 2", "up 3", "up 5"}},
+		{"already at target", applied(1, 2, 3, 5), 5, []string{}},
+		{"fills a gap left by a late merged migration", applied(1, 3, 5), 5, []string{"up 2"}},
+		{"down to an earlier version, newest first", applied(1, 2, 3, 5), 1, []string{"down 5", "down 3", "down 2"}},
+		{"revert everything", applied(1, 2, 3, 5), 0, []string{"down 5", "down 3", "down 2", "down 1"}},
+		{"target between versions", applied(1), 4, []string{"up 2", "up 3"}},
+		{"reverts before applying", applied(1, 3, 5), 2, []string{"down 5", "down 3", "up 2"}},
+	}
+	for _, tt := range toTests {
+		t.Run("to/"+tt.name, func(t *testing.T) {
+			if got := describe(planTo(migrations, tt.applied, tt.target)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("planTo(%d) = %v, want %v", tt.target, got, tt.want)
+			}
+		})
+	}
+
+	downTests := []struct {
+		name    string
+		applied map[int]time.Time
+		steps   int
+		want    []string
+	}{
+		{"one step", applied(1, 2, 3, 5), 1, []string{"down 5"}},
+		{"skips versions that were never applied", applied(1, 3), 2, []string{"down 3", "down 1"}},
+		{"more steps than applied", applied(1, 2), 5, []string{"down 2", "down 1"}},
+		{"nothing applied", applied(), 1, []string{}},
+	}
+	for _, tt := range downTests {
+		t.Run("down/"+tt.name, func(t *testing.T) {
+			if got := describe(planDown(migrations, tt.applied, tt.steps)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("planDown(%d) = %v, want %v", tt.steps, got, tt.want)
+			}
+		})
+	}
+}
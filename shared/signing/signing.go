@@ -0,0 +1,76 @@
+// Package signing ký và kiểm tra payload HTTP bằng HMAC-SHA256.
+//
+// Header chữ ký có dạng "t=<unix>,v1=<hex>", trong đó v1 là HMAC-SHA256 của "<t>.<body>".
+// Bên nhận kiểm tra timestamp để chặn gửi lại payload cũ.
+package signing
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Các lỗi khi kiểm tra chữ ký
+var (
+	ErrMissing   = errors.New("missing signature")
+	ErrMalformed = errors.New("malformed signature header")
+	ErrExpired   = errors.New("signature timestamp is outside the allowed window")
+	ErrMismatch  = errors.New("signature does not match")
+)
+
+// Sign tính header chữ ký cho body tại thời điểm ts
+func Sign(secret string, ts time.Time, body []byte) string {
+	timestamp := strconv.FormatInt(ts.Unix(), 10)
+	return "t=" + timestamp + ",v1=" + hex.EncodeToString(mac(secret, timestamp, body))
+}
+
+// Verify kiểm tra header chữ ký với một trong các secret (cho phép xoay vòng secret)
+// và timestamp lệch không quá tolerance so với now
+func Verify(header string, body []byte, secrets []string, tolerance time.Duration, now time.Time) error {
+	if header == "" {
+		return ErrMissing
+	}
+
+	var timestamp string
+	var signatures [][]byte
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			if sig, err := hex.DecodeString(value); err == nil {
+				signatures = append(signatures, sig)
+			}
+		}
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return ErrMalformed
+	}
+	if skew := now.Sub(time.Unix(ts, 0)); skew > tolerance || skew < -tolerance {
+		return ErrExpired
+	}
+
+	for _, secret := range secrets {
+		expected := mac(secret, timestamp, body)
+		for _, sig := range signatures {
+			if hmac.Equal(sig, expected) {
+				return nil
+			}
+		}
+	}
+	return ErrMismatch
+}
+
+func mac(secret, timestamp string, body []byte) []byte {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(timestamp))
+	h.Write([]byte("."))
+	h.Write(body)
+	return h.Sum(nil)
+}
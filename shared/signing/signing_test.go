@@ -0,0 +1,55 @@
+package signing
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSignVerify(t *testing.T) {
+	body := []byte(`{"event_id":"abc"}`)
+	signedAt := time.Unix(1_700_000_000, 0)
+	header := Sign("current", signedAt, body)
+
+	tests := []struct {
+		name    string
+		header  string
+		body    []byte
+		secrets []string
+		now     time.Time
+		want    error
+	}{
+		{"valid", header, body, []string{"current"}, signedAt, nil},
+		{"rotated secret still accepted", header, body, []string{"next", "current"}, signedAt, nil},
+		{"within tolerance", header, body, []string{"current"}, signedAt.Add(5 * time.Minute), nil},
+		{"clock skew ahead within tolerance", header, body, []string{"current"}, signedAt.Add(-5 * time.Minute), nil},
+		{"too old", header, body, []string{"current"}, signedAt.Add(5*time.Minute + time.Second), ErrExpired},
+		{"from the future", header, body, []string{"current"}, signedAt.Add(-6 * time.Minute), ErrExpired},
+		{"wrong secret", header, body, []string{"other"}, signedAt, ErrMismatch},
+		{"no secrets configured", header, body, nil, signedAt, ErrMismatch},
+		{"tampered body", header, []byte(`{"event_id":"abd"}`), []string{"current"}, signedAt, ErrMismatch},
+		{"missing header", "", body, []string{"current"}, signedAt, ErrMissing},
+		{"missing signature", "t=" + strconv.FormatInt(signedAt.Unix(), 10), body, []string{"current"}, signedAt, ErrMalformed},
+		{"missing timestamp", "v1=00ff", body, []string{"current"}, signedAt, ErrMalformed},
+		{"signature not hex", "t=1700000000,v1=zz", body, []string{"current"}, signedAt, ErrMalformed},
+		{
+			// Timestamp là một phần của dữ liệu được ký nên không thể đổi để kéo dài hiệu lực
+			"replayed with new timestamp",
+			"t=" + strconv.FormatInt(signedAt.Add(time.Hour).Unix(), 10) + header[len("t=1700000000"):],
+			body, []string{"current"}, signedAt.Add(time.Hour), ErrMismatch,
+		},
+		{
+			"extra signatures are tolerated",
+			header + ",v1=" + "00", body, []string{"current"}, signedAt, nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(tt.header, tt.body, tt.secrets, 5*time.Minute, tt.now)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Verify() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
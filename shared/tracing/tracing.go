@@ -0,0 +1,104 @@
+// Package tracing cấu hình OpenTelemetry cho các dịch vụ.
+//
+// Exporter chọn qua OTEL_TRACES_EXPORTER: "otlp" (gửi tới collector theo OTEL_EXPORTER_OTLP_ENDPOINT),
+// "stdout" (in span ra stdout khi chạy local) hoặc "none". Để trống thì dùng otlp nếu đã khai báo
+// endpoint, ngược lại tắt tracing. Ngữ cảnh trace truyền giữa các dịch vụ theo chuẩn W3C traceparent.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Init đăng ký TracerProvider và propagator toàn cục cho dịch vụ service.
+// Hàm trả về shutdown để đẩy nốt các span còn trong bộ đệm trước khi thoát.
+func Init(ctx context.Context, service string) (shutdown func(context.Context) error, err error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	exporter, err := newExporter(ctx)
+	if err != nil || exporter == nil {
+		return func(context.Context) error { return nil }, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(service)))
+	if err != nil {
+		return nil, err
+	}
+	// OTEL_SERVICE_NAME và OTEL_RESOURCE_ATTRIBUTES được ưu tiên hơn tên mặc định
+	if fromEnv, err := resource.New(ctx, resource.WithFromEnv()); err == nil {
+		if merged, err := resource.Merge(res, fromEnv); err == nil {
+			res = merged
+		}
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// newExporter tạo exporter theo OTEL_TRACES_EXPORTER, trả về nil khi tắt tracing
+func newExporter(ctx context.Context) (sdktrace.SpanExporter, error) {
+	kind := strings.ToLower(strings.TrimSpace(os.Getenv("OTEL_TRACES_EXPORTER")))
+	if kind == "" {
+		if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+			return nil, nil
+		}
+		kind = "otlp"
+	}
+
+	switch kind {
+	case "none":
+		return nil, nil
+	case "stdout", "console":
+		return stdouttrace.New(stdouttrace.WithPrettyPrint())
+	case "otlp":
+		// Endpoint, header và TLS lấy từ các biến OTEL_EXPORTER_OTLP_* chuẩn
+		return otlptracehttp.New(ctx)
+	}
+	return nil, fmt.Errorf("unknown OTEL_TRACES_EXPORTER %q, expected otlp, stdout or none", kind)
+}
+
+// Tracer trả về tracer của thư viện hoặc dịch vụ name
+func Tracer(name string) trace.Tracer {
+	return otel.Tracer(name)
+}
+
+// Transport bọc base để mỗi request đi ra có span riêng và mang header traceparent
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return otelhttp.NewTransport(base)
+}
+
+// Inject ghi ngữ cảnh trace của ctx thành chuỗi "traceparent" để lưu cùng bản ghi (ví dụ outbox)
+// và tiếp tục trace khi worker xử lý sau này. Trả về rỗng nếu ctx không có span.
+func Inject(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	return carrier.Get("traceparent")
+}
+
+// Extract khôi phục ngữ cảnh trace từ chuỗi do Inject tạo ra
+func Extract(ctx context.Context, traceparent string) context.Context {
+	if traceparent == "" {
+		return ctx
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier{"traceparent": traceparent})
+}